@@ -0,0 +1,60 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// attributeFilter selects the ATA attributes exported, by id or
+// case-insensitive name.
+type attributeFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// parseAttributeList parses a comma separated list of attribute ids or names.
+func parseAttributeList(list string) map[string]bool {
+	if list == "" {
+		return nil
+	}
+	attributes := map[string]bool{}
+	for _, attribute := range strings.Split(list, ",") {
+		if attribute = strings.TrimSpace(attribute); attribute != "" {
+			attributes[strings.ToLower(attribute)] = true
+		}
+	}
+	return attributes
+}
+
+func newAttributeFilter(include, exclude string) (attributeFilter, error) {
+	if include != "" && exclude != "" {
+		return attributeFilter{}, fmt.Errorf("attribute include and exclude lists are mutually exclusive")
+	}
+	return attributeFilter{
+		include: parseAttributeList(include),
+		exclude: parseAttributeList(exclude),
+	}, nil
+}
+
+// ignored returns whether the attribute should not be exported.
+func (f attributeFilter) ignored(id, name string) bool {
+	if f.include != nil {
+		_, ok := attributeConfigFor(f.include, id, name)
+		return !ok
+	}
+	_, ok := attributeConfigFor(f.exclude, id, name)
+	return ok
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+)
+
+func TestParseAttributeList(t *testing.T) {
+	if got := parseAttributeList(""); got != nil {
+		t.Errorf("empty list = %v, want nil", got)
+	}
+	want := map[string]bool{"5": true, "power_on_hours": true}
+	if got := parseAttributeList(" 5, Power_On_Hours,,"); !reflect.DeepEqual(got, want) {
+		t.Errorf("list = %v, want %v", got, want)
+	}
+}
+
+func TestAttributeFilter(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newAttributeFilter("5", "9"); err == nil {
+		t.Error("include and exclude lists accepted together")
+	}
+	for _, test := range []struct {
+		include, exclude string
+		want             map[string]bool
+	}{
+		{"", "", map[string]bool{"5": true, "9": true, "241": true}},
+		{"5,total_lbas_written", "", map[string]bool{"5": true, "241": true}},
+		{"", "Power_On_Hours", map[string]bool{"5": true, "241": true}},
+		{"", "5,9,241", map[string]bool{}},
+	} {
+		filter, err := newAttributeFilter(test.include, test.exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved := exportedAttributes
+		exportedAttributes = filter
+		series := collectedSeries(t, attributesJSON)
+		exportedAttributes = saved
+		if got := attributeSeries(series); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("include %q exclude %q: attributes %v, want %v", test.include, test.exclude, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// attributeScale divides a raw attribute value by an integer factor. Raw
+// values are integers of up to 48 bits in the smartctl JSON, converting them
+// to float64 loses precision above 2^53. The division is therefore done on
+// the integer value, only the scaled result is converted to float64.
+type attributeScale struct {
+	factor uint64
+	unit   string
+}
+
+// parseAttributeScales parses attribute id or name to "factor:unit" pairs.
+func parseAttributeScales(flags map[string]string) (map[string]attributeScale, error) {
+	scales := map[string]attributeScale{}
+	for attribute, spec := range flags {
+		factor, unit, found := strings.Cut(spec, ":")
+		if !found || unit == "" {
+			return nil, fmt.Errorf("attribute scale %q of %q is not in factor:unit format", spec, attribute)
+		}
+		f, err := strconv.ParseUint(factor, 10, 64)
+		if err != nil || f == 0 {
+			return nil, fmt.Errorf("attribute scale factor %q of %q is not a positive integer", factor, attribute)
+		}
+		scales[strings.ToLower(attribute)] = attributeScale{factor: f, unit: unit}
+	}
+	return scales, nil
+}
+
+// attributeConfigFor returns the configuration given for the attribute id or
+// its case-insensitive name.
+func attributeConfigFor[T any](configs map[string]T, id, name string) (T, bool) {
+	if config, ok := configs[id]; ok {
+		return config, true
+	}
+	config, ok := configs[strings.ToLower(name)]
+	return config, ok
+}
+
+func (s attributeScale) apply(raw gjson.Result) float64 {
+	value := raw.Uint()
+	return float64(value/s.factor) + float64(value%s.factor)/float64(s.factor)
+}
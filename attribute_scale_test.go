@@ -0,0 +1,77 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestParseAttributeScales(t *testing.T) {
+	scales, err := parseAttributeScales(map[string]string{"241": "1000000000:giga_lbas", "Power_On_Hours": "24:days"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scale, ok := attributeConfigFor(scales, "241", "Total_LBAs_Written"); !ok || scale != (attributeScale{1000000000, "giga_lbas"}) {
+		t.Errorf("scale of 241 = %+v (%t)", scale, ok)
+	}
+	if scale, ok := attributeConfigFor(scales, "9", "power_on_hours"); !ok || scale != (attributeScale{24, "days"}) {
+		t.Errorf("scale of Power_On_Hours = %+v (%t)", scale, ok)
+	}
+	if _, ok := attributeConfigFor(scales, "5", "Reallocated_Sector_Ct"); ok {
+		t.Error("unconfigured attribute scaled")
+	}
+
+	for _, spec := range []string{"1000", "1000:", "0:unit", "-1:unit", "1.5:unit", "x:unit"} {
+		if _, err := parseAttributeScales(map[string]string{"241": spec}); err == nil {
+			t.Errorf("scale %q accepted", spec)
+		}
+	}
+}
+
+func TestAttributeScaleApply(t *testing.T) {
+	for _, test := range []struct {
+		raw    string
+		factor uint64
+		want   float64
+	}{
+		{"3500000000", 1000000000, 3.5},
+		{"48", 24, 2},
+		{"7", 2, 3.5},
+		{"281474976710655", 1000000, 281474976.710655},
+	} {
+		if got := (attributeScale{factor: test.factor}).apply(gjson.Parse(test.raw)); got != test.want {
+			t.Errorf("%s / %d = %v, want %v", test.raw, test.factor, got, test.want)
+		}
+	}
+}
+
+func TestAttributeScaleCollected(t *testing.T) {
+	saved := attributeScales
+	defer func() { attributeScales = saved }()
+	attributeScales = map[string]attributeScale{"241": {factor: 1000000000, unit: "giga_lbas"}}
+	series := collectedSeries(t, attributesJSON)
+	for key, want := range map[string]float64{
+		"smartctl_device_attribute{updated_online,event_count,auto_keep,-O--CK,241,Total_LBAs_Written,raw_giga_lbas}": 3.5,
+		"smartctl_device_attribute{updated_online,event_count,auto_keep,-O--CK,9,Power_On_Hours,raw}":                 9000,
+	} {
+		if got, ok := series[key]; !ok || got != want {
+			t.Errorf("%s = %v (%t), want %v", key, got, ok, want)
+		}
+	}
+	if _, ok := series["smartctl_device_attribute{updated_online,event_count,auto_keep,-O--CK,241,Total_LBAs_Written,raw}"]; ok {
+		t.Error("unscaled raw value of a scaled attribute exported")
+	}
+}
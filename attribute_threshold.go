@@ -0,0 +1,56 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// attributeThreshold is a user defined warning threshold of an attribute. A
+// raw threshold is exceeded when the raw value is above it, a value
+// threshold when the normalized value is at or below it, like the
+// thresholds defined by the drive.
+type attributeThreshold struct {
+	valueType string
+	limit     float64
+}
+
+// parseAttributeThresholds parses attribute id or name to "raw:N" or
+// "value:N" pairs.
+func parseAttributeThresholds(flags map[string]string) (map[string]attributeThreshold, error) {
+	thresholds := map[string]attributeThreshold{}
+	for attribute, spec := range flags {
+		valueType, limit, _ := strings.Cut(spec, ":")
+		if valueType != "raw" && valueType != "value" {
+			return nil, fmt.Errorf("attribute threshold %q of %q is not in raw:N or value:N format", spec, attribute)
+		}
+		l, err := strconv.ParseFloat(limit, 64)
+		if err != nil {
+			return nil, fmt.Errorf("attribute threshold %q of %q is not a number", limit, attribute)
+		}
+		thresholds[strings.ToLower(attribute)] = attributeThreshold{valueType: valueType, limit: l}
+	}
+	return thresholds, nil
+}
+
+func (t attributeThreshold) exceeded(attribute gjson.Result) bool {
+	if t.valueType == "raw" {
+		return attribute.Get("raw.value").Float() > t.limit
+	}
+	return attribute.Get("value").Float() <= t.limit
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestParseAttributeThresholds(t *testing.T) {
+	thresholds, err := parseAttributeThresholds(map[string]string{"5": "raw:10", "Wear_Leveling_Count": "value:20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if threshold, ok := attributeConfigFor(thresholds, "5", "Reallocated_Sector_Ct"); !ok || threshold != (attributeThreshold{"raw", 10}) {
+		t.Errorf("threshold of 5 = %+v (%t)", threshold, ok)
+	}
+	if threshold, ok := attributeConfigFor(thresholds, "177", "wear_leveling_count"); !ok || threshold != (attributeThreshold{"value", 20}) {
+		t.Errorf("threshold of Wear_Leveling_Count = %+v (%t)", threshold, ok)
+	}
+
+	for _, spec := range []string{"10", "raw", "raw:", "worst:10", "raw:ten"} {
+		if _, err := parseAttributeThresholds(map[string]string{"5": spec}); err == nil {
+			t.Errorf("threshold %q accepted", spec)
+		}
+	}
+}
+
+func TestAttributeThresholdExceeded(t *testing.T) {
+	attribute := gjson.Parse(`{"id":5,"value":20,"raw":{"value":10}}`)
+	for threshold, want := range map[attributeThreshold]bool{
+		{"raw", 9}:    true,
+		{"raw", 10}:   false,
+		{"value", 21}: true,
+		{"value", 20}: true,
+		{"value", 19}: false,
+	} {
+		if got := threshold.exceeded(attribute); got != want {
+			t.Errorf("%+v exceeded %t, want %t", threshold, got, want)
+		}
+	}
+}
+
+func TestAttributeThresholdCollected(t *testing.T) {
+	saved := attributeThresholds
+	defer func() { attributeThresholds = saved }()
+	attributeThresholds = map[string]attributeThreshold{"5": {"raw", 10}, "power_on_hours": {"raw", 10000}}
+	series := collectedSeries(t, attributesJSON)
+	for key, want := range map[string]float64{
+		"smartctl_device_attribute_over_user_threshold{5,Reallocated_Sector_Ct}": 1,
+		"smartctl_device_attribute_over_user_threshold{9,Power_On_Hours}":        0,
+	} {
+		if got, ok := series[key]; !ok || got != want {
+			t.Errorf("%s = %v (%t), want %v", key, got, ok, want)
+		}
+	}
+	if _, ok := series["smartctl_device_attribute_over_user_threshold{241,Total_LBAs_Written}"]; ok {
+		t.Error("attribute without a threshold exported")
+	}
+}
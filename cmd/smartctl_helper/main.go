@@ -0,0 +1,104 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// smartctl_helper runs smartctl on behalf of an unprivileged
+// smartctl_exporter. It is meant to be installed setuid root (or with
+// CAP_SYS_RAWIO and CAP_SYS_ADMIN) and executable only by the exporter's
+// group. The JSON output of smartctl is passed back on stdout.
+//
+// The caller is untrusted: only the read-only smartctl options used by the
+// exporter and device paths below /dev are accepted, the smartctl path is
+// fixed at build time and the environment is not passed on.
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// smartctlPath can be changed with -ldflags "-X main.smartctlPath=...".
+var smartctlPath = "/usr/sbin/smartctl"
+
+var (
+	allowedArgs = map[string]bool{
+		"--json":         true,
+		"-a":             true,
+		"--info":         true,
+		"--health":       true,
+		"--attributes":   true,
+		"--capabilities": true,
+		"--format=brief": true,
+		"--log=error":    true,
+		"--log=selftest": true,
+		"--log=sataphy":  true,
+		"--scan":         true,
+		"--version":      true,
+	}
+	allowedPrefixes = []string{
+		"--tolerance=",
+		"--nocheck=",
+	}
+	deviceTypeRe = regexp.MustCompile(`^[a-z0-9+,]+$`)
+	logPageRe    = regexp.MustCompile(`^--log=gplog,0x[0-9a-f]{2}$`)
+)
+
+// validateArgs returns an error for any argument the exporter never passes.
+func validateArgs(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case allowedArgs[arg]:
+		case hasAllowedPrefix(arg):
+		case logPageRe.MatchString(arg):
+		case arg == "-d" && i+1 < len(args) && deviceTypeRe.MatchString(args[i+1]):
+			i++
+		case strings.HasPrefix(arg, "/dev/") && !strings.Contains(arg, ".."):
+		default:
+			return fmt.Errorf("argument not allowed: %q", arg)
+		}
+	}
+	return nil
+}
+
+func hasAllowedPrefix(arg string) bool {
+	for _, prefix := range allowedPrefixes {
+		if strings.HasPrefix(arg, prefix) && !strings.ContainsAny(arg, " \t") {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	args := os.Args[1:]
+	if err := validateArgs(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	cmd := exec.Command(smartctlPath, args...)
+	cmd.Env = []string{}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if exiterr, ok := err.(*exec.ExitError); ok {
+		// Keep the smartctl exit status, the exporter decodes its bits.
+		os.Exit(exiterr.ExitCode())
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateArgs(t *testing.T) {
+	tests := []struct {
+		args           []string
+		expectedResult bool
+	}{
+		{[]string{"--json", "--scan"}, true},
+		{[]string{"--json", "--version"}, true},
+		{[]string{"--json", "--info", "--tolerance=verypermissive", "--nocheck=standby", "/dev/sda"}, true},
+		{[]string{"--json", "--info", "/dev/bus/0", "-d", "megaraid,5"}, true},
+		{[]string{"--log=gplog,0xc0", "/dev/sda"}, true},
+		{[]string{"-a", "--nocheck=standby", "/dev/sda"}, true},
+		{[]string{"--log=gplog,0xc0,0-255", "/dev/sda"}, false},
+		{[]string{"--json", "--test=long", "/dev/sda"}, false},
+		{[]string{"--json", "-s", "off", "/dev/sda"}, false},
+		{[]string{"--json", "/dev/../etc/shadow"}, false},
+		{[]string{"--json", "/dev/sda", "-d"}, false},
+		{[]string{"--json", "/dev/sda", "-d", "sat;rm"}, false},
+	}
+
+	for _, test := range tests {
+		err := validateArgs(test.args)
+		if (err == nil) != test.expectedResult {
+			t.Errorf("args=%v expected=%v err=%v", test.args, test.expectedResult, err)
+		}
+	}
+}
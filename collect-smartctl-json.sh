@@ -8,8 +8,9 @@ data_dir="${script_dir}/smartctl-data"
 
 # The original script used --xall but that doesn't work
 # This matches the command in readSMARTctl()
-smartctl_args="--json --info --health --attributes --tolerance=verypermissive \
---nocheck=standby --format=brief --log=error"
+smartctl_args="--json --info --health --attributes --capabilities \
+--tolerance=verypermissive --nocheck=standby --format=brief --log=error \
+--log=selftest --log=sataphy"
 
 # Ignore this devices
 smartctl_ignore_dev_regex="^(/dev/bus)"
@@ -0,0 +1,113 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// Reasons why the data of a device could not be read.
+const (
+	CollectReasonFailed           = "failed"
+	CollectReasonLocked           = "locked"
+	CollectReasonPermissionDenied = "permission_denied"
+	CollectReasonTimeout          = "timeout"
+	CollectReasonStandby          = "standby"
+	CollectReasonSudo             = "sudo"
+)
+
+// CollectError is returned when smartctl did not provide the device data.
+type CollectError struct {
+	Reason string
+	Time   time.Time
+	// PowerMode is the low-power mode smartctl found the device in, for
+	// CollectReasonStandby.
+	PowerMode string
+}
+
+func (e *CollectError) Error() string {
+	return "S.M.A.R.T. data not readable: " + e.Reason
+}
+
+var powerModeRe = regexp.MustCompile(`^Device is in (\S+) mode`)
+
+// collectErrors keeps the last CollectError per Device, successful reads
+// remove the entry.
+var collectErrors sync.Map
+
+// newCollectError classifies the failed smartctl output.
+func newCollectError(json gjson.Result) *CollectError {
+	for _, message := range json.Get("smartctl.messages").Array() {
+		// smartctl.nocheck skips devices in a low-power mode with e.g.
+		// "Device is in STANDBY mode, exit(2)".
+		if match := powerModeRe.FindStringSubmatch(message.Get("string").String()); match != nil {
+			return &CollectError{Reason: CollectReasonStandby, Time: time.Now(), PowerMode: strings.ToLower(match[1])}
+		}
+	}
+	return &CollectError{Reason: collectErrorReason(json), Time: time.Now()}
+}
+
+func collectErrorReason(json gjson.Result) string {
+	// Drives with ATA security enabled reject SMART commands until they are
+	// unlocked, SCSI devices report a "data protect" sense key instead.
+	if json.Get("ata_security.locked").Bool() {
+		return CollectReasonLocked
+	}
+	for _, message := range json.Get("smartctl.messages").Array() {
+		text := strings.ToLower(message.Get("string").String())
+		if strings.Contains(text, "data protect") || strings.Contains(text, "security locked") {
+			return CollectReasonLocked
+		}
+		// Opening the device fails like this without root or CAP_SYS_RAWIO.
+		if strings.Contains(text, "permission denied") || strings.Contains(text, "operation not permitted") {
+			return CollectReasonPermissionDenied
+		}
+	}
+	return CollectReasonFailed
+}
+
+// lastCollectError returns the error of the last read of the device, if it
+// failed.
+func lastCollectError(device Device) (*CollectError, bool) {
+	err, ok := collectErrors.Load(device)
+	if !ok {
+		return nil, false
+	}
+	return err.(*CollectError), true
+}
+
+// transientCollectError returns whether the failed read may succeed when
+// retried, e.g. with USB bridges failing intermittently. Missing devices,
+// locked or sleeping drives, permission problems and timeouts are not
+// retried, nor are runs without smartctl output, e.g. with the binary
+// missing.
+func transientCollectError(json gjson.Result, err error) bool {
+	var collectErr *CollectError
+	if !errors.As(err, &collectErr) || collectErr.Reason != CollectReasonFailed || !json.Get("smartctl").Exists() {
+		return false
+	}
+	for _, message := range json.Get("smartctl.messages").Array() {
+		text := strings.ToLower(message.Get("string").String())
+		if strings.Contains(text, "no such device") || strings.Contains(text, "no such file") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/tidwall/gjson"
+)
+
+func TestCollectErrorReason(t *testing.T) {
+	locked, err := os.ReadFile("testdata/ST4000NM0245-1Z2107_30.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"ATA security locked", string(locked), CollectReasonLocked},
+		{"SCSI data protect", `{"smartctl":{"messages":[{"severity":"error","string":"scsi error data protect"}]}}`, CollectReasonLocked},
+		{"permission denied", `{"smartctl":{"messages":[{"severity":"error","string":"Smartctl open device: /dev/sda failed: Permission denied"}]}}`, CollectReasonPermissionDenied},
+		{"generic failure", `{"smartctl":{"messages":[{"severity":"error","string":"Smartctl open device: /dev/sdx failed: No such device"}]}}`, CollectReasonFailed},
+		{"no output", `{}`, CollectReasonFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collectErrorReason(gjson.Parse(tt.json)); got != tt.want {
+				t.Errorf("collectErrorReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransientCollectError(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		err  error
+		want bool
+	}{
+		{"bridge failure", `{"smartctl":{"messages":[{"severity":"error","string":"Read Device Identity failed: scsi error"}]}}`, &CollectError{Reason: CollectReasonFailed}, true},
+		{"no output", `{}`, &CollectError{Reason: CollectReasonFailed}, false},
+		{"no such device", `{"smartctl":{"messages":[{"severity":"error","string":"Smartctl open device: /dev/sdx failed: No such device"}]}}`, &CollectError{Reason: CollectReasonFailed}, false},
+		{"locked", `{}`, &CollectError{Reason: CollectReasonLocked}, false},
+		{"timeout", `{}`, &CollectError{Reason: CollectReasonTimeout}, false},
+		{"success", `{}`, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transientCollectError(gjson.Parse(tt.json), tt.err); got != tt.want {
+				t.Errorf("transientCollectError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRetryBudget retries a failing device until the backoff budget is
+// spent, however many retries are configured.
+func TestRetryBudget(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	smartctl := filepath.Join(t.TempDir(), "smartctl")
+	script := `#!/bin/sh
+echo '{"smartctl":{"exit_status":4,"messages":[{"severity":"error","string":"Read Device Identity failed: scsi error"}]}}'
+exit 4
+`
+	if err := os.WriteFile(smartctl, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved, retries := *smartctlPath, *smartctlRetries
+	*smartctlPath, *smartctlRetries = smartctl, 10
+	defer func() { *smartctlPath, *smartctlRetries = saved, retries }()
+	device := Device{Name: "/dev/sdx", Info_Name: "sdx"}
+	defer forgetDevice(device)
+
+	start := time.Now()
+	readData(log.NewNopLogger(), device)
+	if elapsed := time.Since(start); elapsed > retryBudget+time.Second {
+		t.Errorf("reading took %s, want at most the retry budget of %s", elapsed, retryBudget)
+	}
+	count, ok := collectRetries.Load(device)
+	if !ok || count.(*atomic.Uint64).Load() != 2 {
+		t.Errorf("retries not counted as 2 within the budget: %v", count)
+	}
+}
+
+// TestCheckPermissions checks that the misconfiguration error is only
+// logged when every device failed with permission denied.
+func TestCheckPermissions(t *testing.T) {
+	sda := Device{Name: "/dev/sda", Info_Name: "sda"}
+	sdb := Device{Name: "/dev/sdb", Info_Name: "sdb"}
+	defer forgetDevice(sda)
+	defer forgetDevice(sdb)
+	logged := func(devices []Device) bool {
+		var buf bytes.Buffer
+		checkPermissions(log.NewLogfmtLogger(&buf), devices)
+		return strings.Contains(buf.String(), "Permission denied reading all devices")
+	}
+
+	if logged(nil) {
+		t.Error("logged without devices")
+	}
+	collectErrors.Store(sda, &CollectError{Reason: CollectReasonPermissionDenied})
+	if logged([]Device{sda, sdb}) {
+		t.Error("logged with a device read successfully")
+	}
+	collectErrors.Store(sdb, &CollectError{Reason: CollectReasonTimeout})
+	if logged([]Device{sda, sdb}) {
+		t.Error("logged with a device failing for another reason")
+	}
+	collectErrors.Store(sdb, &CollectError{Reason: CollectReasonPermissionDenied})
+	if !logged([]Device{sda, sdb}) {
+		t.Error("not logged with every device denied")
+	}
+}
+
+// TestNocheckStandby checks that smartctl.nocheck is passed on and devices
+// skipped in a low-power mode are reported with the mode, without retries.
+func TestNocheckStandby(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--smartctl.nocheck=idle", "--smartctl.retries=3"}); err != nil {
+		t.Fatal(err)
+	}
+	defer kingpin.CommandLine.Parse(nil)
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	saved := *smartctlPath
+	*smartctlPath = writeShim(t, dir, "smartctl", `echo "$@" >> `+calls+`
+echo '{"smartctl":{"exit_status":2,"messages":[{"string":"Device is in IDLE_B mode, exit(2)","severity":"information"}]}}'
+exit 2
+`)
+	defer func() { *smartctlPath = saved }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	defer forgetDevice(device)
+
+	if json := readData(log.NewNopLogger(), device); json.Exists() {
+		t.Errorf("data returned for a sleeping device: %s", json.Raw)
+	}
+	collectErr, ok := lastCollectError(device)
+	if !ok || collectErr.Reason != CollectReasonStandby || collectErr.PowerMode != "idle_b" {
+		t.Errorf("collect error %+v, want %s in idle_b", collectErr, CollectReasonStandby)
+	}
+	out, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := strings.Count(string(out), "\n"); runs != 1 {
+		t.Errorf("smartctl run %d times, want 1", runs)
+	}
+	if !strings.Contains(string(out), "--nocheck=idle") {
+		t.Errorf("smartctl arguments %q without --nocheck=idle", out)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the YAML file given with config.file. Options set in the file
+// override the corresponding flags.
+type Config struct {
+	Interval    model.Duration `yaml:"interval,omitempty"`
+	Timeout     model.Duration `yaml:"timeout,omitempty"`
+	Concurrency int            `yaml:"concurrency,omitempty"`
+	Devices     []ConfigDevice `yaml:"devices,omitempty"`
+}
+
+// ConfigDevice is a device read instead of the scanned devices.
+type ConfigDevice struct {
+	Name  string   `yaml:"name"`
+	Type  string   `yaml:"type,omitempty"`
+	Label string   `yaml:"label,omitempty"`
+	Alias string   `yaml:"alias,omitempty"`
+	Args  []string `yaml:"args,omitempty"`
+}
+
+// configDeviceTypes are the smartctl device types accepted in the config
+// file, by whether they need the disk number after a comma.
+var configDeviceTypes = map[string]bool{
+	"auto":        false,
+	"ata":         false,
+	"sat":         false,
+	"scsi":        false,
+	"nvme":        false,
+	"usbcypress":  false,
+	"usbjmicron":  false,
+	"usbprolific": false,
+	"usbsunplus":  false,
+	"sntasmedia":  false,
+	"sntjmicron":  false,
+	"sntrealtek":  false,
+	MegaraidType:  true,
+	CcissType:     true,
+	AacraidType:   true,
+	"areca":       true,
+	"3ware":       true,
+	"hpt":         true,
+}
+
+// checkDeviceType checks the base type of each part of a smartctl device
+// type, e.g. sat and megaraid of sat+megaraid,5. Options after a comma are
+// left to smartctl, besides the disk number of the types needing one.
+func checkDeviceType(deviceType string) error {
+	for _, part := range strings.Split(deviceType, "+") {
+		base, options, found := strings.Cut(part, ",")
+		needsNumber, ok := configDeviceTypes[base]
+		if !ok {
+			return fmt.Errorf("unknown type %q", base)
+		}
+		if needsNumber && (!found || options == "") {
+			return fmt.Errorf("type %s needs the disk number, e.g. %s,0", base, base)
+		}
+	}
+	return nil
+}
+
+// loadConfig reads and validates the config file.
+func loadConfig(filename string) (*Config, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	if config.Concurrency < 0 {
+		return nil, fmt.Errorf("concurrency %d is negative", config.Concurrency)
+	}
+	for idx, device := range config.Devices {
+		if device.Name == "" {
+			return nil, fmt.Errorf("device %d has no name", idx)
+		}
+		if deviceType := expandDeviceType(device.Type); deviceType != "" {
+			if err := checkDeviceType(deviceType); err != nil {
+				return nil, fmt.Errorf("device %s of type %q: %w", device.Name, device.Type, err)
+			}
+		}
+		// The arguments are passed to smartctl separated by whitespace.
+		for _, arg := range device.Args {
+			if arg == "" || strings.IndexFunc(arg, unicode.IsSpace) >= 0 {
+				return nil, fmt.Errorf("device %s argument %q is empty or contains whitespace, give each argument as its own list item", device.Name, arg)
+			}
+		}
+	}
+	return config, nil
+}
+
+// settings are the options the config file can override. They are read by
+// concurrent scrapes, so a reload replaces them as a whole instead of
+// writing the flags.
+type settings struct {
+	interval    time.Duration
+	timeout     time.Duration
+	concurrency int
+}
+
+var appliedSettings atomic.Pointer[settings]
+
+// currentSettings returns the settings of the last applied config, or the
+// flags if none was applied.
+func currentSettings() settings {
+	if s := appliedSettings.Load(); s != nil {
+		return *s
+	}
+	return settings{
+		interval:    *smartctlInterval,
+		timeout:     *smartctlTimeout,
+		concurrency: *smartctlMaxConcurrency,
+	}
+}
+
+// apply overrides the flags with the options set in the config.
+func (c *Config) apply() {
+	s := settings{
+		interval:    *smartctlInterval,
+		timeout:     *smartctlTimeout,
+		concurrency: *smartctlMaxConcurrency,
+	}
+	if c.Interval != 0 {
+		s.interval = time.Duration(c.Interval)
+	}
+	if c.Timeout != 0 {
+		s.timeout = time.Duration(c.Timeout)
+	}
+	if c.Concurrency != 0 {
+		s.concurrency = c.Concurrency
+	}
+	appliedSettings.Store(&s)
+}
+
+// devices returns the configured devices.
+func (c *Config) devices() []Device {
+	devices := []Device{}
+	for _, d := range c.Devices {
+		device := Device{
+			Name:       d.Name,
+			Type:       expandDeviceType(d.Type),
+			TypeSource: TypeSourceConfig,
+			ExtraArgs:  strings.Join(d.Args, " "),
+			Alias:      d.Alias,
+		}
+		if device.Type != d.Type {
+			device.TypeSource = TypeSourceAlias
+		}
+		device.Info_Name = getDiskName(d.Name, strings.ReplaceAll(device.Type, ",", "_"))
+		if d.Label != "" {
+			device.Info_Name = d.Label
+			device.Label = d.Label
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
@@ -0,0 +1,218 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/model"
+)
+
+// TestConfigApply reloads the config while settings are read, run with
+// -race to find unsynchronized access.
+func TestConfigApply(t *testing.T) {
+	defer appliedSettings.Store(nil)
+	config := &Config{Interval: model.Duration(2 * time.Minute), Concurrency: 3}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			config.apply()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		currentSettings()
+	}
+	wg.Wait()
+
+	s := currentSettings()
+	if s.interval != 2*time.Minute || s.concurrency != 3 || s.timeout != *smartctlTimeout {
+		t.Errorf("settings = %+v, want interval 2m, concurrency 3 and the flag timeout", s)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	content := `interval: 5m
+timeout: 30s
+concurrency: 2
+devices:
+  - name: /dev/sda
+    type: megaraid,3
+    label: db
+    alias: journal
+    args: [--nocheck=never]
+`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		Interval:    model.Duration(5 * time.Minute),
+		Timeout:     model.Duration(30 * time.Second),
+		Concurrency: 2,
+		Devices:     []ConfigDevice{{Name: "/dev/sda", Type: "megaraid,3", Label: "db", Alias: "journal", Args: []string{"--nocheck=never"}}},
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("config = %+v, want %+v", config, want)
+	}
+
+	for content, want := range map[string]string{
+		"concurrency: -1\n":                              "concurrency -1 is negative",
+		"devices:\n  - type: sat\n":                      "device 0 has no name",
+		"devices:\n  - name: /dev/sda\n    type: sata\n": `device /dev/sda of type "sata"`,
+		"devices:\n  - name: /dev/sda\n    typ: sat\n":   "field typ not found",
+		"intervall: 5m\n":                                "field intervall not found",
+		"interval: soon\n":                               "parsing",
+		"devices: /dev/sda\n":                            "parsing",
+	} {
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(filename); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: err %v, want %q", content, err, want)
+		}
+	}
+
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Error("missing config file loaded")
+	}
+}
+
+func TestLoadConfigArgs(t *testing.T) {
+	for content, ok := range map[string]bool{
+		"devices:\n  - name: /dev/sda\n    args: [--nocheck=never]\n":     true,
+		"devices:\n  - name: /dev/sda\n    args: [--nocheck, never]\n":    true,
+		"devices:\n  - name: /dev/sda\n    args: [\"--nocheck never\"]\n": false,
+		"devices:\n  - name: /dev/sda\n    args: [\"\"]\n":                false,
+	} {
+		filename := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(filename); (err == nil) != ok {
+			t.Errorf("%q: err %v", content, err)
+		}
+	}
+}
+
+func TestCheckDeviceType(t *testing.T) {
+	for deviceType, ok := range map[string]bool{
+		"sat":              true,
+		"sat,12":           true,
+		"sat,auto":         true,
+		"nvme,0x1":         true,
+		"megaraid,5":       true,
+		"sat+megaraid,5":   true,
+		"sat+cciss,2":      true,
+		"aacraid,0,0,1":    true,
+		"megaraid":         false,
+		"sat+megaraid":     false,
+		"cciss,":           false,
+		"sata":             false,
+		"sat+unknown,1":    false,
+		"sat+":             false,
+		"usbjmicron,x,0,1": true,
+	} {
+		if err := checkDeviceType(deviceType); (err == nil) != ok {
+			t.Errorf("%s: err %v", deviceType, err)
+		}
+	}
+}
+
+func TestConfigDevicesTypeSource(t *testing.T) {
+	saved := deviceTypeAliases
+	defer func() { deviceTypeAliases = saved }()
+	deviceTypeAliases = map[string]string{"mr5": "megaraid,5"}
+	config := &Config{Devices: []ConfigDevice{
+		{Name: "/dev/sda"},
+		{Name: "/dev/bus/0", Type: "megaraid,4", Args: []string{"--nocheck", "never"}},
+		{Name: "/dev/bus/0", Type: "mr5", Label: "db", Alias: "journal"},
+	}}
+	want := []Device{
+		{Name: "/dev/sda", Info_Name: "sda", TypeSource: TypeSourceConfig},
+		{Name: "/dev/bus/0", Info_Name: "bus_0_megaraid_4", Type: "megaraid,4", TypeSource: TypeSourceConfig, ExtraArgs: "--nocheck never"},
+		{Name: "/dev/bus/0", Info_Name: "db", Label: "db", Alias: "journal", Type: "megaraid,5", TypeSource: TypeSourceAlias},
+	}
+	if devices := config.devices(); !reflect.DeepEqual(devices, want) {
+		t.Errorf("devices = %+v, want %+v", devices, want)
+	}
+}
+
+// TestReload checks that a reload applies the config file and its devices,
+// and that an invalid config file keeps the current configuration.
+func TestReload(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config.yml")
+	saved, savedConfig := *smartctlPath, *configFile
+	*smartctlPath = writeShim(t, dir, "smartctl", `echo '{"json_format_version":[1,0],"smartctl":{"version":[7,4],"exit_status":0}}'`)
+	*configFile = filename
+	defer func() { *smartctlPath, *configFile = saved, savedConfig }()
+	defer appliedSettings.Store(nil)
+
+	collector := &SMARTctlManagerCollector{
+		Devices:    []Device{{Name: "/dev/sdc", Info_Name: "sdc"}},
+		logger:     log.NewNopLogger(),
+		scanLogger: log.NewNopLogger(),
+	}
+	content := "interval: 5m\ndevices:\n  - name: /dev/sda\n  - name: /dev/sdb\n    type: sat\n"
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	before := reloads.Load()
+	if err := collector.reload(log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, device := range collector.Devices {
+		names = append(names, device.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"/dev/sda", "/dev/sdb"}) || !collector.configured {
+		t.Errorf("devices %v (configured %t), want the configured /dev/sda and /dev/sdb", names, collector.configured)
+	}
+	if got := currentSettings().interval; got != 5*time.Minute {
+		t.Errorf("interval %s, want 5m", got)
+	}
+	if got := reloads.Load() - before; got != 1 {
+		t.Errorf("%d reloads counted, want 1", got)
+	}
+
+	if err := os.WriteFile(filename, []byte("concurrency: -1\ndevices:\n  - name: /dev/sdd\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := collector.reload(log.NewNopLogger()); err == nil {
+		t.Error("invalid config file reloaded")
+	}
+	if len(collector.Devices) != 2 || collector.Devices[0].Name != "/dev/sda" {
+		t.Errorf("devices %v after an invalid config file, want them kept", collector.Devices)
+	}
+	if got := reloads.Load() - before; got != 1 {
+		t.Errorf("%d reloads counted after an invalid config file, want 1", got)
+	}
+}
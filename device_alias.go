@@ -0,0 +1,92 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// deviceAliases maps the device label values of the last collection to the
+// aliases of their devices.
+var (
+	deviceAliases      = map[string]string{}
+	deviceAliasesMutex sync.RWMutex
+)
+
+// deviceAlias returns the alias configured for the device, matched by its
+// info name first, as megaraid and cciss disks share their name.
+func deviceAlias(device Device) string {
+	if device.Alias != "" {
+		return device.Alias
+	}
+	if alias, ok := (*smartctlDeviceAlias)[device.Info_Name]; ok {
+		return alias
+	}
+	return (*smartctlDeviceAlias)[device.Name]
+}
+
+// setDeviceAliases replaces the aliases of the device label values.
+func setDeviceAliases(aliases map[string]string) {
+	deviceAliasesMutex.Lock()
+	deviceAliases = aliases
+	deviceAliasesMutex.Unlock()
+}
+
+// aliasGatherer adds the alias label to the gathered metrics of devices
+// with an alias. Devices without one get no label, which Prometheus does
+// not tell apart from an empty one.
+type aliasGatherer struct {
+	gatherer prometheus.Gatherer
+}
+
+// withDeviceAliases returns gatherer adding the alias label.
+func withDeviceAliases(gatherer prometheus.Gatherer) prometheus.Gatherer {
+	return aliasGatherer{gatherer: gatherer}
+}
+
+func (g aliasGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	deviceAliasesMutex.RLock()
+	defer deviceAliasesMutex.RUnlock()
+	if len(deviceAliases) == 0 {
+		return families, err
+	}
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			alias := ""
+			for _, label := range metric.Label {
+				if label.GetName() == "alias" {
+					alias = ""
+					break
+				}
+				if label.GetName() == "device" {
+					alias = deviceAliases[label.GetValue()]
+				}
+			}
+			if alias == "" {
+				continue
+			}
+			name := "alias"
+			metric.Label = append(metric.Label, &dto.LabelPair{Name: &name, Value: &alias})
+			sort.Slice(metric.Label, func(i, j int) bool {
+				return metric.Label[i].GetName() < metric.Label[j].GetName()
+			})
+		}
+	}
+	return families, err
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDeviceAliases(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	temperature := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "smartctl_device_temperature",
+		Help: "Temperature",
+	}, []string{"device"})
+	temperature.WithLabelValues("sda").Set(30)
+	temperature.WithLabelValues("sdb").Set(40)
+	reg.MustRegister(temperature)
+
+	setDeviceAliases(map[string]string{"sda": "nvme-boot"})
+	defer setDeviceAliases(map[string]string{})
+	families, err := withDeviceAliases(reg).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliases := map[string]string{}
+	for _, metric := range families[0].Metric {
+		labels := map[string]string{}
+		for _, label := range metric.Label {
+			labels[label.GetName()] = label.GetValue()
+		}
+		aliases[labels["device"]] = labels["alias"]
+	}
+	if aliases["sda"] != "nvme-boot" || aliases["sdb"] != "" {
+		t.Errorf("aliases = %v, want sda aliased to nvme-boot only", aliases)
+	}
+}
@@ -34,8 +34,43 @@ func newDeviceFilter(ignoredPattern, acceptPattern string) (f deviceFilter) {
 	return
 }
 
-// ignored returns whether the device should be ignored
+// ignored returns whether the device should be ignored. With both patterns,
+// a device is kept if it matches the accept pattern and not the ignore pattern.
 func (f *deviceFilter) ignored(name string) bool {
 	return ((f.ignorePattern != nil && f.ignorePattern.MatchString(name)) ||
 		(f.acceptPattern != nil && !f.acceptPattern.MatchString(name)))
 }
+
+// deviceMatcher selects devices by the values of smartctl.device, according
+// to smartctl.device-match. The values are matched against both the device
+// name and its info name, as regexps compiled once. Regexps are validated
+// at startup.
+type deviceMatcher struct {
+	names    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+func newDeviceMatcher(filters []string) deviceMatcher {
+	m := deviceMatcher{names: map[string]bool{}}
+	for _, filter := range filters {
+		if *smartctlDeviceMatch == "regex" {
+			m.patterns = append(m.patterns, regexp.MustCompile(filter))
+		} else {
+			m.names[filter] = true
+		}
+	}
+	return m
+}
+
+// matches returns whether the device matches any of the filters.
+func (m deviceMatcher) matches(d Device) bool {
+	if m.names[d.Info_Name] || m.names[d.Name] {
+		return true
+	}
+	for _, re := range m.patterns {
+		if re.MatchString(d.Info_Name) || re.MatchString(d.Name) {
+			return true
+		}
+	}
+	return false
+}
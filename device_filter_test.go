@@ -30,6 +30,11 @@ func TestDeviceFilter(t *testing.T) {
 		{"", "^💩0$", "veth0", true},
 		{"^💩", "", "💩3", true},
 		{"^💩", "", "veth0", false},
+		{"^/dev/sdb$", "^/dev/sd", "/dev/sda", false},
+		{"^/dev/sdb$", "^/dev/sd", "/dev/sdb", true},
+		{"^/dev/sdb$", "^/dev/sd", "/dev/nvme0", true},
+		{"^/dev/sd", "^/dev/sd", "/dev/sda", true},
+		{"nvme", "^/dev/sd", "/dev/nvme0", true},
 	}
 
 	for _, test := range tests {
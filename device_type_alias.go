@@ -0,0 +1,53 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+)
+
+// parseDeviceTypeAliases resolves the alias to device type pairs. An alias
+// may expand to another alias, the chain must not lead back to itself.
+func parseDeviceTypeAliases(flags map[string]string) (map[string]string, error) {
+	aliases := map[string]string{}
+	for alias := range flags {
+		deviceType := alias
+		seen := map[string]bool{}
+		for {
+			next, ok := flags[deviceType]
+			if !ok {
+				break
+			}
+			if seen[deviceType] {
+				return nil, fmt.Errorf("device type alias %q references itself", alias)
+			}
+			seen[deviceType] = true
+			deviceType = next
+		}
+		if deviceType == "" {
+			return nil, fmt.Errorf("device type alias %q is empty", alias)
+		}
+		aliases[alias] = deviceType
+	}
+	return aliases, nil
+}
+
+// expandDeviceType returns the device type an alias stands for, other device
+// types are returned as is.
+func expandDeviceType(deviceType string) string {
+	if expanded, ok := deviceTypeAliases[deviceType]; ok {
+		return expanded
+	}
+	return deviceType
+}
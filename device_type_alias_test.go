@@ -0,0 +1,62 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDeviceTypeAliases(t *testing.T) {
+	aliases, err := parseDeviceTypeAliases(map[string]string{
+		"mr5":   "megaraid,5",
+		"db":    "mr5",
+		"jbod":  "sat",
+		"disk1": "db",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"mr5": "megaraid,5", "db": "megaraid,5", "jbod": "sat", "disk1": "megaraid,5"}
+	if !reflect.DeepEqual(aliases, want) {
+		t.Errorf("aliases = %v, want %v", aliases, want)
+	}
+
+	for _, flags := range []map[string]string{
+		{"a": "a"},
+		{"a": "b", "b": "a"},
+		{"a": ""},
+		{"a": "b", "b": ""},
+	} {
+		if _, err := parseDeviceTypeAliases(flags); err == nil {
+			t.Errorf("%v accepted", flags)
+		}
+	}
+}
+
+func TestExpandDeviceType(t *testing.T) {
+	saved := deviceTypeAliases
+	defer func() { deviceTypeAliases = saved }()
+	deviceTypeAliases = map[string]string{"mr5": "megaraid,5"}
+	for deviceType, want := range map[string]string{
+		"mr5":        "megaraid,5",
+		"megaraid,5": "megaraid,5",
+		"sat":        "sat",
+		"":           "",
+	} {
+		if got := expandDeviceType(deviceType); got != want {
+			t.Errorf("expandDeviceType(%q) = %q, want %q", deviceType, got, want)
+		}
+	}
+}
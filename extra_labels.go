@@ -0,0 +1,114 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// reservedLabelNames are the label names of the exported metrics, which
+// smartctl.extra-label must not replace. newDesc adds the labels of the metric
+// descriptors, the labels of the other sources are listed here.
+var reservedLabelNames = map[string]bool{
+	// Target labels added by Prometheus.
+	"instance": true,
+	"job":      true,
+	// Buckets and quantiles of histograms and summaries.
+	"le":       true,
+	"quantile": true,
+	// go_info of the Go collector.
+	"version": true,
+	// smartctl_scrape_duration_seconds.
+	"type": true,
+	// Added by withDeviceAliases.
+	"alias": true,
+}
+
+// metricDescs are all descriptors created by newDesc, described by the
+// collectors as many metrics are only exported in some device states.
+var metricDescs []*prometheus.Desc
+
+// newDesc is prometheus.NewDesc, reserving the label names of the metric.
+func newDesc(fqName, help string, variableLabels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	for _, name := range variableLabels {
+		reservedLabelNames[name] = true
+	}
+	for name := range constLabels {
+		reservedLabelNames[name] = true
+	}
+	desc := prometheus.NewDesc(fqName, help, variableLabels, constLabels)
+	metricDescs = append(metricDescs, desc)
+	return desc
+}
+
+// validateExtraLabels checks the smartctl.extra-label names.
+func validateExtraLabels(labels map[string]string) error {
+	for name := range labels {
+		switch {
+		case !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix):
+			return fmt.Errorf("invalid label name %q", name)
+		case reservedLabelNames[name]:
+			return fmt.Errorf("label %q is already used by the exported metrics", name)
+		}
+	}
+	return nil
+}
+
+// labelsGatherer adds constant labels to all gathered metrics. A label the
+// metric has already is kept.
+type labelsGatherer struct {
+	gatherer prometheus.Gatherer
+	labels   []*dto.LabelPair
+}
+
+// withExtraLabels returns gatherer adding labels, or gatherer itself if there
+// are none.
+func withExtraLabels(gatherer prometheus.Gatherer, labels map[string]string) prometheus.Gatherer {
+	if len(labels) == 0 {
+		return gatherer
+	}
+	g := labelsGatherer{gatherer: gatherer}
+	for name, value := range labels {
+		g.labels = append(g.labels, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+	}
+	return g
+}
+
+func (g labelsGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			own := map[string]bool{}
+			for _, label := range metric.Label {
+				own[label.GetName()] = true
+			}
+			for _, label := range g.labels {
+				if !own[label.GetName()] {
+					metric.Label = append(metric.Label, label)
+				}
+			}
+			sort.Slice(metric.Label, func(i, j int) bool {
+				return metric.Label[i].GetName() < metric.Label[j].GetName()
+			})
+		}
+	}
+	return families, err
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestExtraLabels(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"datacenter": true,
+		"rack_2":     true,
+		"device":     false,
+		"type":       false,
+		"instance":   false,
+		"job":        false,
+		"le":         false,
+		// Reserved by the descriptor of smartctl_device_temperature.
+		"temperature_type": false,
+		"__name__":         false,
+		"2rack":            false,
+		"rack-2":           false,
+	} {
+		if err := validateExtraLabels(map[string]string{name: "x"}); (err == nil) != valid {
+			t.Errorf("validateExtraLabels(%q) = %v, want valid %v", name, err, valid)
+		}
+	}
+
+	reg := prometheus.NewRegistry()
+	temperature := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "smartctl_device_temperature",
+		Help: "Temperature",
+	}, []string{"device"})
+	temperature.WithLabelValues("sda").Set(30)
+	reg.MustRegister(temperature)
+	families, err := withExtraLabels(reg, map[string]string{"rack": "r2", "datacenter": "fra1"}).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ""
+	for _, label := range families[0].Metric[0].Label {
+		got += label.GetName() + "=" + label.GetValue() + " "
+	}
+	if want := "datacenter=fra1 device=sda rack=r2 "; got != want {
+		t.Errorf("labels = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestSelectDevices(t *testing.T) {
+	scan := []Device{
+		{Name: "/dev/sda", Info_Name: "sda", Type: "sat", TypeSource: TypeSourceScan},
+		{Name: "/dev/sdb", Info_Name: "sdb", Type: "sat", TypeSource: TypeSourceScan},
+		{Name: "/dev/nvme0", Info_Name: "nvme0", Type: "nvme", TypeSource: TypeSourceScan},
+	}
+	configured := []Device{
+		{Name: "/dev/sda", Info_Name: "sda", Type: "sat", TypeSource: TypeSourceConfig},
+		{Name: "/dev/sdc", Info_Name: "sdc", Type: "sat", TypeSource: TypeSourceConfig},
+	}
+
+	tests := []struct {
+		name       string
+		configured []Device
+		explicit   []string
+		match      string
+		include    string
+		exclude    string
+		scanned    bool
+		filtered   bool
+		expected   []string
+	}{
+		{"scan", nil, nil, "exact", "", "", true, false, []string{"sda", "sdb", "nvme0"}},
+		{"scan with include", nil, nil, "exact", "^/dev/sd", "", true, true, []string{"sda", "sdb"}},
+		{"scan with exclude", nil, nil, "exact", "", "nvme", true, true, []string{"sda", "sdb"}},
+		{"explicit", nil, []string{"/dev/sdb", "/dev/sdz"}, "exact", "", "", false, false, []string{"sdb", "sdz"}},
+		{"explicit skips include", nil, []string{"/dev/nvme0"}, "exact", "^/dev/sd", "", false, false, []string{"nvme0"}},
+		{"explicit skips exclude", nil, []string{"/dev/sda"}, "exact", "", "sda", false, false, []string{"sda"}},
+		{"explicit exact", nil, []string{"/dev/sd"}, "exact", "", "", false, false, []string{"sd"}},
+		{"explicit regex", nil, []string{"^/dev/sd"}, "regex", "", "", true, false, []string{"sda", "sdb"}},
+		{"explicit regex skips exclude", nil, []string{"^/dev/sd"}, "regex", "", "sda", true, false, []string{"sda", "sdb"}},
+		{"configured", configured, nil, "exact", "", "sda", false, false, []string{"sda", "sdc"}},
+		{"configured and explicit", configured, []string{"/dev/sdc", "/dev/sdb"}, "exact", "", "", false, false, []string{"sdc"}},
+	}
+
+	match, include, exclude := *smartctlDeviceMatch, *smartctlDeviceInclude, *smartctlDeviceExclude
+	defer func() {
+		*smartctlDeviceMatch, *smartctlDeviceInclude, *smartctlDeviceExclude = match, include, exclude
+	}()
+	for _, test := range tests {
+		*smartctlDeviceMatch, *smartctlDeviceInclude, *smartctlDeviceExclude = test.match, test.include, test.exclude
+		scanned, filtered := false, false
+		devices := selectDevices(log.NewNopLogger(), test.configured, test.explicit, func(filter deviceFilter) []Device {
+			scanned = true
+			filtered = filter.ignorePattern != nil || filter.acceptPattern != nil
+			var devices []Device
+			for _, d := range scan {
+				if !filter.ignored(d.Name) {
+					devices = append(devices, d)
+				}
+			}
+			return devices
+		})
+		var names []string
+		for _, d := range devices {
+			names = append(names, d.Info_Name)
+		}
+		if scanned != test.scanned || filtered != test.filtered || !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: scanned=%v filtered=%v devices=%v, expected scanned=%v filtered=%v devices=%v",
+				test.name, scanned, filtered, names, test.scanned, test.filtered, test.expected)
+		}
+	}
+}
+
+func TestDeviceMatcher(t *testing.T) {
+	saved := *smartctlDeviceMatch
+	defer func() { *smartctlDeviceMatch = saved }()
+	device := Device{Name: "/dev/bus/0", Info_Name: "bus_0_megaraid_disk_05"}
+	for _, test := range []struct {
+		match   string
+		filters []string
+		matches bool
+	}{
+		{"exact", []string{"/dev/bus/0"}, true},
+		{"exact", []string{"bus_0_megaraid_disk_05"}, true},
+		{"exact", []string{"megaraid"}, false},
+		{"exact", []string{"/dev/bus/.*"}, false},
+		{"regex", []string{"^nvme", "megaraid_disk_0[0-9]$"}, true},
+		{"regex", []string{"^/dev/bus/"}, true},
+		{"regex", []string{"^/dev/sd"}, false},
+		{"regex", nil, false},
+	} {
+		*smartctlDeviceMatch = test.match
+		if got := newDeviceMatcher(test.filters).matches(device); got != test.matches {
+			t.Errorf("%s %v: matches %v, want %v", test.match, test.filters, got, test.matches)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatherDevices collects the devices like the exporter.
+func gatherDevices(devices []Device) ([]*dto.MetricFamily, error) {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(&SMARTctlManagerCollector{
+		Devices:       devices,
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	})
+	return reg.Gather()
+}
+
+// fixtureValues lists values expected from fixtures, by fixture and family.
+// The families must hold a single series for the device.
+var fixtureValues = map[string]map[string]float64{
+	// Host_Writes_32MiB, and Total_LBAs_Read in 32MiB units as 241
+	// mirrors 225.
+	"sat-Dell_Certified_Intel_S3520_Series_SSDs-SSDSCKJB240G7R-sdm": {
+		"smartctl_device_bytes_written": 129493 * 32 << 20,
+		"smartctl_device_bytes_read":    573613 * 32 << 20,
+	},
+	// Total_LBAs_Written and Total_LBAs_Read in 512 byte sectors.
+	"ST3500418AS_11": {
+		"smartctl_device_bytes_written": 543343366 * 512,
+		"smartctl_device_bytes_read":    224972325 * 512,
+	},
+	// Wear_Leveling_Count normalized to 91 and Unused_Rsvd_Blk_Cnt_Tot.
+	"SAMSUNG_MZ7WD240HAFV-00003_21": {
+		"smartctl_device_bytes_written":           216456537880 * 512,
+		"smartctl_device_percentage_used":         9,
+		"smartctl_device_available_spare_percent": 100,
+	},
+	// Percent_Lifetime_Remain normalized to 99.
+	"sat-Micron_5100_Pro___52x0___5300_SSDs-Micron_5300_MTFDDAK960TDS-sdi": {
+		"smartctl_device_percentage_used": 1,
+	},
+	// SSD_Life_Left normalized to 98.
+	"sat-Phison_Driven_SSDs-KINGSTON_SA400M8120G-sda": {
+		"smartctl_device_percentage_used": 2,
+	},
+	// Media_Wearout_Indicator normalized to 100 and Available_Reservd_Space.
+	"sat-Intel_S4510_S4610_S4500_S4600_Series_SSDs-INTEL_SSDSC2KB480G8-sdm": {
+		"smartctl_device_percentage_used":         0,
+		"smartctl_device_available_spare_percent": 100,
+	},
+	// The NVMe health log.
+	"KXG60ZNV512G_TOSHIBA_8": {
+		"smartctl_device_percentage_used": 4,
+	},
+	// NVMe host commands, and the controller busy time in minutes.
+	"INTEL_SSDPE2KX080T8_1": {
+		"smartctl_device_host_read_commands":           134106494,
+		"smartctl_device_host_write_commands":          4922206599,
+		"smartctl_device_controller_busy_time_seconds": 165 * 60,
+	},
+}
+
+// familyValue returns the value of the single series of the named family.
+func familyValue(families []*dto.MetricFamily, name string) (float64, bool) {
+	for _, family := range families {
+		if family.GetName() != name || len(family.Metric) != 1 {
+			continue
+		}
+		metric := family.Metric[0]
+		switch {
+		case metric.Counter != nil:
+			return metric.Counter.GetValue(), true
+		case metric.Gauge != nil:
+			return metric.Gauge.GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+// TestFixtures collects every captured smartctl output in testdata like a
+// device, through the same path as smartctl.fake-json-dir.
+func TestFixtures(t *testing.T) {
+	// Use the flag defaults, like the exporter.
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	devices := fakeJSONDevices(log.NewNopLogger(), "testdata")
+	if len(devices) == 0 {
+		t.Fatal("no fixtures found")
+	}
+	for _, device := range devices {
+		t.Run(device.Info_Name, func(t *testing.T) {
+			families, err := gatherDevices([]Device{device})
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := map[string]bool{}
+			for _, family := range families {
+				found[family.GetName()] = true
+				for _, metric := range family.Metric {
+					for _, label := range metric.Label {
+						if !reservedLabelNames[label.GetName()] {
+							t.Errorf("label %s of %s missing in reservedLabelNames", label.GetName(), family.GetName())
+						}
+					}
+				}
+			}
+			for _, name := range []string{"smartctl_device", "smartctl_device_smart_status", "smartctl_device_smartctl_exit_status"} {
+				if !found[name] {
+					t.Errorf("%s not collected", name)
+				}
+			}
+			for name, want := range fixtureValues[device.Info_Name] {
+				got, ok := familyValue(families, name)
+				if !ok {
+					t.Errorf("%s not collected", name)
+				} else if got != want {
+					t.Errorf("%s = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+	// All fixtures at once must not produce conflicting series.
+	if _, err := gatherDevices(devices); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// defaultHealthScoreWeights are the points subtracted from a score of 100
+// when a component is at its worst. See healthScorePenalties.
+var defaultHealthScoreWeights = map[string]float64{
+	"smart_status": 100,
+	"reallocated":  30,
+	"pending":      30,
+	"wear":         20,
+	"temperature":  10,
+}
+
+// parseHealthScoreWeights overrides the default weights by component name.
+func parseHealthScoreWeights(flags map[string]string) (map[string]float64, error) {
+	weights := map[string]float64{}
+	for component, weight := range defaultHealthScoreWeights {
+		weights[component] = weight
+	}
+	for component, weight := range flags {
+		if _, ok := weights[component]; !ok {
+			return nil, fmt.Errorf("unknown health score component %q", component)
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("health score weight %q of %q is not a non-negative number", weight, component)
+		}
+		weights[component] = w
+	}
+	return weights, nil
+}
+
+// healthScorePenalties returns a penalty between 0 (good) and 1 (bad) for each
+// component the device reports:
+//
+//	smart_status: 1 if the SMART overall-health self-assessment failed
+//	reallocated:  reallocated sectors of sectorHealth, 1 at 100
+//	pending:      pending and uncorrectable sectors of sectorHealth, 1 at 10
+//	wear:         SSD percentage used of any protocol, see percentageUsed, 1 at 100%
+//	temperature:  current temperature, 0 up to 50°C and 1 from 70°C
+func healthScorePenalties(json gjson.Result) map[string]float64 {
+	penalties := map[string]float64{}
+	if status := json.Get("smart_status.passed"); status.Exists() {
+		penalties["smart_status"] = 0
+		if !status.Bool() {
+			penalties["smart_status"] = 1
+		}
+	}
+
+	sectors := sectorHealth(json)
+	if reallocated, ok := sectors["reallocated"]; ok {
+		penalties["reallocated"] = math.Min(reallocated/100, 1)
+	}
+	pending, pendingOk := sectors["pending"]
+	uncorrectable, uncorrectableOk := sectors["uncorrectable"]
+	if pendingOk || uncorrectableOk {
+		penalties["pending"] = math.Min((pending+uncorrectable)/10, 1)
+	}
+	if used, ok := percentageUsed(json, strings.TrimSpace(json.Get("device.protocol").String())); ok {
+		penalties["wear"] = math.Min(used/100, 1)
+	}
+	if temperature := schemaField(json, "temperature"); temperature.Exists() {
+		penalties["temperature"] = math.Max(0, math.Min((temperature.Float()-50)/20, 1))
+	}
+	return penalties
+}
+
+// healthScore returns the weighted heuristic health score from 0 to 100.
+func healthScore(json gjson.Result, weights map[string]float64) float64 {
+	score := 100.0
+	for component, penalty := range healthScorePenalties(json) {
+		score -= weights[component] * penalty
+	}
+	return math.Max(score, 0)
+}
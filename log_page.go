@@ -0,0 +1,168 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+// logPageField is a little-endian integer at a fixed offset of an ATA general
+// purpose log page, e.g. a vendor specific wear counter.
+type logPageField struct {
+	name   string
+	page   string
+	offset int
+	size   int
+	model  *regexp.Regexp
+}
+
+var (
+	logPageRe     = regexp.MustCompile(`^0x[0-9a-f]{2}$`)
+	hexDumpLineRe = regexp.MustCompile(`^([0-9a-f]{7})(?:-([0-9a-f]{7}))?:((?: [0-9a-f]{2})+)`)
+
+	logPageCache sync.Map
+)
+
+type logPageCacheKey struct {
+	device Device
+	page   string
+}
+
+type logPageCacheValue struct {
+	data        []byte
+	lastCollect time.Time
+}
+
+// parseLogPageFields parses name to "page:offset:size[:model regexp]" pairs.
+func parseLogPageFields(flags map[string]string) ([]logPageField, error) {
+	fields := []logPageField{}
+	for name, spec := range flags {
+		parts := strings.SplitN(spec, ":", 4)
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("log page field %q of %q is not in page:offset:size[:model] format", spec, name)
+		}
+		page := strings.ToLower(parts[0])
+		if !logPageRe.MatchString(page) {
+			return nil, fmt.Errorf("log page %q of %q is not a hex address like 0xc0", parts[0], name)
+		}
+		offset, err := strconv.Atoi(parts[1])
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("log page offset %q of %q is not a non-negative integer", parts[1], name)
+		}
+		size, err := strconv.Atoi(parts[2])
+		if err != nil || size < 1 || size > 8 {
+			return nil, fmt.Errorf("log page field size %q of %q is not between 1 and 8", parts[2], name)
+		}
+		field := logPageField{name: name, page: page, offset: offset, size: size}
+		if len(parts) == 4 {
+			if field.model, err = regexp.Compile(parts[3]); err != nil {
+				return nil, fmt.Errorf("model regexp of log page field %q: %w", name, err)
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// collectLogPageFields sends the configured log page fields of an ATA device.
+// The pages are read with a separate smartctl run, so a failure never
+// affects the regular JSON output.
+func collectLogPageFields(logger log.Logger, ch chan<- prometheus.Metric, device Device, json gjson.Result) {
+	if json.Get("device.protocol").String() != "ATA" {
+		return
+	}
+	model := json.Get("model_name").String()
+	for _, field := range logPageFields {
+		if field.model != nil && !field.model.MatchString(model) {
+			continue
+		}
+		data := readLogPage(logger, device, field.page)
+		if field.offset+field.size > len(data) {
+			continue
+		}
+		var value uint64
+		for i := field.size - 1; i >= 0; i-- {
+			value = value<<8 | uint64(data[field.offset+i])
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricDeviceLogPageValue,
+			prometheus.GaugeValue,
+			float64(value),
+			deviceLabel(device),
+			field.page,
+			field.name,
+		)
+	}
+}
+
+// readLogPage returns the bytes of the general purpose log page, cached
+// for smartctl.interval and kept in maintenance mode.
+func readLogPage(logger log.Logger, device Device, page string) []byte {
+	key := logPageCacheKey{device: device, page: page}
+	cached, ok := logPageCache.Load(key)
+	if ok && (inMaintenance() || time.Now().Before(cached.(logPageCacheValue).lastCollect.Add(currentSettings().interval))) {
+		return cached.(logPageCacheValue).data
+	}
+	if inMaintenance() {
+		return nil
+	}
+	args := append([]string{"--log=gplog," + page}, smartctlDeviceArgs(device)...)
+	out, err := runSmartctl(args...)
+	if err != nil {
+		level.Debug(logger).Log("msg", "Log page reading", "err", err, "device", device.Info_Name, "page", page)
+	}
+	data := parseHexDump(string(out))
+	logPageCache.Store(key, logPageCacheValue{data: data, lastCollect: time.Now()})
+	return data
+}
+
+// parseHexDump parses the hex dump smartctl prints for log pages. Runs of
+// identical lines are printed once with an address range.
+func parseHexDump(out string) []byte {
+	data := []byte{}
+	for _, line := range strings.Split(out, "\n") {
+		match := hexDumpLineRe.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		start, _ := strconv.ParseUint(match[1], 16, 64)
+		end := start
+		if match[2] != "" {
+			end, _ = strconv.ParseUint(match[2], 16, 64)
+		}
+		row := []byte{}
+		for _, b := range strings.Fields(match[3]) {
+			v, _ := strconv.ParseUint(b, 16, 8)
+			row = append(row, byte(v))
+		}
+		for address := start; address <= end; address += uint64(len(row)) {
+			if address != uint64(len(data)) {
+				// Missing or out of order lines, the offsets would be wrong.
+				return data
+			}
+			data = append(data, row...)
+		}
+	}
+	return data
+}
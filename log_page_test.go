@@ -0,0 +1,201 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestParseHexDump(t *testing.T) {
+	out, err := os.ReadFile("testdata/log_page/gplog_0xc0.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := parseHexDump(string(out))
+	if len(data) != 512 {
+		t.Fatalf("%d bytes parsed, want 512", len(data))
+	}
+	for offset, want := range map[int]byte{0: 0x01, 8: 0x2a, 16: 0x10, 17: 0x27, 24: 0xff, 30: 0x00, 511: 0x00} {
+		if data[offset] != want {
+			t.Errorf("byte %d = %#x, want %#x", offset, data[offset], want)
+		}
+	}
+
+	// Lines after a gap are dropped, their offsets would be wrong.
+	gap := "0000000: 01 02\n0000020: 03 04\n"
+	if data := parseHexDump(gap); len(data) != 2 {
+		t.Errorf("%d bytes parsed across a gap, want 2", len(data))
+	}
+	if data := parseHexDump("=======> INVALID ARGUMENT TO -l: gplog,0xc0\n"); len(data) != 0 {
+		t.Errorf("%d bytes parsed from an error, want 0", len(data))
+	}
+}
+
+func TestParseLogPageFields(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want logPageField
+		err  bool
+	}{
+		{"field", "0xc0:16:2", logPageField{page: "0xc0", offset: 16, size: 2}, false},
+		{"upper case page", "0xC0:0:8", logPageField{page: "0xc0", offset: 0, size: 8}, false},
+		{"model", "0xc0:16:2:^INTEL", logPageField{page: "0xc0", offset: 16, size: 2}, false},
+		{"missing size", "0xc0:16", logPageField{}, true},
+		{"decimal page", "192:16:2", logPageField{}, true},
+		{"negative offset", "0xc0:-1:2", logPageField{}, true},
+		{"zero size", "0xc0:16:0", logPageField{}, true},
+		{"oversized", "0xc0:16:9", logPageField{}, true},
+		{"bad model", "0xc0:16:2:(", logPageField{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := parseLogPageFields(map[string]string{"wear": tt.spec})
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %t", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			got := fields[0]
+			if got.name != "wear" || got.page != tt.want.page || got.offset != tt.want.offset || got.size != tt.want.size {
+				t.Errorf("field = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCollectLogPageFields reads little-endian fields from a cached page.
+func TestCollectLogPageFields(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile("testdata/log_page/gplog_0xc0.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	logPageCache.Store(logPageCacheKey{device: device, page: "0xc0"}, logPageCacheValue{data: parseHexDump(string(out)), lastCollect: time.Now()})
+	defer forgetDevice(device)
+	fields, err := parseLogPageFields(map[string]string{
+		"wear":     "0xc0:16:2",
+		"erased":   "0xc0:24:6",
+		"beyond":   "0xc0:510:4",
+		"other":    "0xc0:0:1:^SAMSUNG",
+		"matching": "0xc0:8:1:^INTEL",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := logPageFields
+	logPageFields = fields
+	defer func() { logPageFields = saved }()
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collectLogPageFields(log.NewNopLogger(), ch, device, parseJSON(`{"device":{"protocol":"ATA"},"model_name":"INTEL SSDSC2KB480G8"}`))
+		close(ch)
+	}()
+	values := map[string]float64{}
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		for _, label := range m.Label {
+			if label.GetName() == "name" {
+				values[label.GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	want := map[string]float64{"wear": 10000, "erased": 1<<48 - 1, "matching": 0x2a}
+	if len(values) != len(want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+	for name, value := range want {
+		if values[name] != value {
+			t.Errorf("%s = %v, want %v", name, values[name], value)
+		}
+	}
+
+	// Pages of devices that are gone are dropped, see setDevices.
+	forgetDevice(device)
+	if _, ok := logPageCache.Load(logPageCacheKey{device: device, page: "0xc0"}); ok {
+		t.Error("log page of a forgotten device still cached")
+	}
+}
+
+// TestReadLogPage checks that pages are read once per interval, and only
+// for ATA devices.
+func TestReadLogPage(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := filepath.Abs("testdata/log_page/gplog_0xc0.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	saved := *smartctlPath
+	*smartctlPath = writeShim(t, dir, "smartctl", "echo \"$*\" >> "+runs+"\ncat "+fixture+"\n")
+	defer func() { *smartctlPath = saved }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda", Type: "sat", TypeSource: TypeSourceConfig}
+	defer forgetDevice(device)
+	fields, err := parseLogPageFields(map[string]string{"wear": "0xc0:16:2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedFields := logPageFields
+	logPageFields = fields
+	defer func() { logPageFields = savedFields }()
+
+	collect := func(protocol string) (int, []string) {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			collectLogPageFields(log.NewNopLogger(), ch, device, parseJSON(`{"device":{"protocol":"`+protocol+`"}}`))
+			close(ch)
+		}()
+		count := 0
+		for range ch {
+			count++
+		}
+		out, _ := os.ReadFile(runs)
+		return count, strings.Fields(strings.TrimSpace(string(out)))
+	}
+
+	if count, args := collect("NVMe"); count != 0 || len(args) != 0 {
+		t.Errorf("NVMe device: %d values, smartctl run with %v", count, args)
+	}
+	count, args := collect("ATA")
+	if count != 1 || strings.Join(args, " ") != "--log=gplog,0xc0 /dev/sda -d sat" {
+		t.Errorf("ATA device: %d values, smartctl run with %v", count, args)
+	}
+	if count, args := collect("ATA"); count != 1 || len(args) != 4 {
+		t.Errorf("cached page: %d values, smartctl run with %v", count, args)
+	}
+	logPageCache.Store(logPageCacheKey{device: device, page: "0xc0"}, logPageCacheValue{lastCollect: time.Now().Add(-time.Hour)})
+	if count, args := collect("ATA"); count != 1 || len(args) != 8 {
+		t.Errorf("expired page: %d values, smartctl run with %v", count, args)
+	}
+}
@@ -14,10 +14,18 @@
 package main
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	kingpin "github.com/alecthomas/kingpin/v2"
@@ -31,13 +39,55 @@ import (
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/exporter-toolkit/web"
 	webflag "github.com/prometheus/exporter-toolkit/web/kingpinflag"
+	"github.com/tidwall/gjson"
 )
 
 // Device
 type Device struct {
-	Name      string `json:"name"`
-	Info_Name string `json:"info_name"`
-	Type      string `json:"type"`
+	Name       string `json:"name"`
+	Info_Name  string `json:"info_name"`
+	Type       string `json:"type"`
+	TypeSource string `json:"type_source"`
+	// Target is the remote host the device is read from, empty for local
+	// devices.
+	Target string `json:"target"`
+	// Label replaces the device label derived from the smartctl output.
+	Label string `json:"label"`
+	// ExtraArgs are additional smartctl arguments for this device, separated
+	// by whitespace. It is no slice, as Device is used as map key.
+	ExtraArgs string `json:"extra_args"`
+	// Alias is the alias label of the device metrics, see deviceAlias.
+	Alias string `json:"alias"`
+}
+
+// Where the type of a device comes from.
+const (
+	TypeSourceScan   = "scan"
+	TypeSourceSat    = "sat"
+	TypeSourceProbe  = "probe"
+	TypeSourceAlias  = "alias"
+	TypeSourceConfig = "config"
+	TypeSourceFlag   = "flag"
+	// TypeSourceFakeJSON devices are JSON files of smartctl.fake-json-dir.
+	TypeSourceFakeJSON = "fake-json"
+)
+
+// collectTypeSource sends where the type of the device comes from.
+func collectTypeSource(ch chan<- prometheus.Metric, device Device) {
+	ch <- prometheus.MustNewConstMetric(
+		metricDeviceTypeSource,
+		prometheus.GaugeValue,
+		1,
+		deviceLabel(device),
+		device.Type,
+		device.TypeSource,
+	)
+}
+
+// LVMVolume is a logical volume using a device.
+type LVMVolume struct {
+	VG string
+	LV string
 }
 
 // SMARTctlManagerCollector implements the Collector interface.
@@ -45,30 +95,303 @@ type SMARTctlManagerCollector struct {
 	CollectPeriod         string
 	CollectPeriodDuration time.Duration
 	Devices               []Device
+	SuccessRatios         *successRatios
+	SelfTests             *SelfTestScheduler
 
-	logger log.Logger
-	mutex  sync.Mutex
+	logger       log.Logger
+	scanLogger   log.Logger
+	rescanLogger log.Logger
+	mutex        sync.Mutex
+	// collections counts the successful reads per device, not counting
+	// the results served from the cache. Guarded by mutex.
+	collections map[string]uint64
+	// configured is set if the devices come from the config file, they
+	// are not rescanned then. Guarded by mutex.
+	configured bool
+	// failures counts the failed collections per device, guarded by mutex.
+	failures map[string]uint64
+	// permissionCheck checks once whether the first collection lacked the
+	// privileges to read any device.
+	permissionCheck sync.Once
+	// collected is whether the last collection read any device
+	// successfully.
+	collected atomic.Bool
 }
 
 const CcissType = "cciss"
 const MegaraidType = "megaraid"
+const AacraidType = "aacraid"
 
-// Describe sends the super-set of all possible descriptors of metrics
+// Describe sends the super-set of all possible descriptors of metrics. Many
+// metrics are only exported in some device states, e.g. while a self-test
+// runs or a read failed, so the metrics seen at registration are completed
+// by all descriptors of metrics.go.
 func (i *SMARTctlManagerCollector) Describe(ch chan<- *prometheus.Desc) {
 	prometheus.DescribeByCollect(i, ch)
+	for _, desc := range metricDescs {
+		ch <- desc
+	}
+	metricCollectMutexWait.Describe(ch)
+	metricScrapeDuration.Describe(ch)
 }
 
 // Collect is called by the Prometheus registry when collecting metrics.
 func (i *SMARTctlManagerCollector) Collect(ch chan<- prometheus.Metric) {
 	info := NewSMARTctlInfo(ch)
+	waitStart := time.Now()
 	i.mutex.Lock()
-	for _, device := range i.Devices {
-		json := readData(i.logger, device)
+	metricCollectMutexWait.Observe(time.Since(waitStart).Seconds())
+	metricCollectMutexWait.Collect(ch)
+	metricScrapeDuration.Collect(ch)
+	// All devices are read before mining, so drives reporting the same
+	// serial number are known when the device labels are derived.
+	readStart := time.Now()
+	results := readDevices(i.logger, i.Devices, currentSettings().concurrency)
+	serials := map[Device]string{}
+	for idx, device := range i.Devices {
+		serials[device] = strings.TrimSpace(results[idx].Get("serial_number").String())
+	}
+	collectDuplicateSerials(i.logger, ch, serials)
+	ambient, hasAmbient := readAmbientTemperature(i.logger)
+	i.permissionCheck.Do(func() { checkPermissions(i.logger, i.Devices) })
+	aliases := map[string]string{}
+	defer setDeviceAliases(aliases)
+	collected := false
+	defer func() { i.collected.Store(collected) }()
+	for idx, device := range i.Devices {
+		setDeviceLabel(device, serials[device])
+		name := deviceLabel(device)
+		if device.Alias != "" {
+			aliases[name] = device.Alias
+		}
+		json := results[idx]
 		if json.Exists() {
 			info.SetJSON(json)
+			parseStart := time.Now()
 			smart := NewSMARTctl(i.logger, json, ch)
+			smart.ambient, smart.hasAmbient = ambient, hasAmbient
+			if device.Label != "" {
+				smart.device.device = device.Label
+			}
+			if device.Alias != "" {
+				aliases[smart.device.device] = device.Alias
+			}
 			smart.Collect()
+			ch <- prometheus.MustNewConstMetric(
+				metricDeviceParseSeconds,
+				prometheus.GaugeValue,
+				time.Since(parseStart).Seconds(),
+				name,
+			)
+			// Outputs read before this collection come from the cache.
+			if read, ok := lastCollect(device); !ok || !read.Before(readStart) {
+				i.collections[device.Info_Name]++
+			}
+			collected = true
+			if len(logPageFields) > 0 {
+				collectLogPageFields(i.logger, ch, device, json)
+			}
+			if *nvmePath != "" {
+				collectOCPSMARTLog(i.logger, ch, device, json)
+			}
+		}
+		if collected, ok := lastCollect(device); ok {
+			ch <- prometheus.MustNewConstMetric(
+				metricDeviceLastCollectTimestamp,
+				prometheus.GaugeValue,
+				float64(collected.Unix()),
+				name,
+			)
+		}
+		if age, ok := cacheAge(device); ok {
+			ch <- prometheus.MustNewConstMetric(
+				metricDeviceCacheAgeSeconds,
+				prometheus.GaugeValue,
+				age.Seconds(),
+				name,
+			)
+		}
+		if retries, ok := collectRetries.Load(device); ok {
+			ch <- prometheus.MustNewConstMetric(
+				metricDeviceCollectRetries,
+				prometheus.CounterValue,
+				float64(retries.(*atomic.Uint64).Load()),
+				name,
+			)
+		}
+		if duration, ok := subprocessDurations.Load(device); ok {
+			ch <- prometheus.MustNewConstMetric(
+				metricDeviceSubprocessSeconds,
+				prometheus.GaugeValue,
+				duration.(time.Duration).Seconds(),
+				name,
+			)
+		}
+		collectErr, failed := lastCollectError(device)
+		up := 1.0
+		if !json.Exists() {
+			up = 0
+			if !failed || collectErr.Reason != CollectReasonStandby {
+				i.failures[device.Info_Name]++
+			}
+		}
+		if failed && collectErr.Reason == CollectReasonStandby {
+			ch <- prometheus.MustNewConstMetric(
+				metricDevicePowerMode,
+				prometheus.GaugeValue,
+				1,
+				name,
+				collectErr.PowerMode,
+			)
 		}
+		ch <- prometheus.MustNewConstMetric(
+			metricDeviceUp,
+			prometheus.GaugeValue,
+			up,
+			name,
+			device.Type,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricDeviceCollectErrorsTotal,
+			prometheus.CounterValue,
+			float64(i.failures[device.Info_Name]),
+			name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricDeviceCollectionsTotal,
+			prometheus.CounterValue,
+			float64(i.collections[device.Info_Name]),
+			name,
+		)
+		collectTypeSource(ch, device)
+		locked, permissionDenied := 0.0, 0.0
+		if failed {
+			ch <- prometheus.MustNewConstMetric(
+				metricDeviceCollectError,
+				prometheus.GaugeValue,
+				1,
+				name,
+				collectErr.Reason,
+			)
+			switch collectErr.Reason {
+			case CollectReasonLocked:
+				locked = 1
+			case CollectReasonPermissionDenied:
+				permissionDenied = 1
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricDeviceLocked,
+			prometheus.GaugeValue,
+			locked,
+			name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricDevicePermissionDenied,
+			prometheus.GaugeValue,
+			permissionDenied,
+			name,
+		)
+		if *lvmEnabled {
+			for _, volume := range lvmVolumes(device.Name) {
+				ch <- prometheus.MustNewConstMetric(
+					metricDeviceLVMInfo,
+					prometheus.GaugeValue,
+					1,
+					name,
+					volume.VG,
+					volume.LV,
+				)
+			}
+		}
+		if major, minor, ok := deviceNumber(device); ok {
+			ch <- prometheus.MustNewConstMetric(
+				metricDeviceNumber,
+				prometheus.GaugeValue,
+				1,
+				name,
+				strconv.FormatUint(uint64(major), 10),
+				strconv.FormatUint(uint64(minor), 10),
+			)
+		}
+		// Only attempts of this collection are recorded, not the outputs and
+		// errors kept from earlier ones.
+		if read, ok := lastCollect(device); json.Exists() && ok && !read.Before(readStart) {
+			i.SuccessRatios.observe(device.Info_Name, json.Get("serial_number").String(), true, *smartctlSuccessWindow)
+		} else if failed && !collectErr.Time.Before(readStart) {
+			i.SuccessRatios.observe(device.Info_Name, "", false, *smartctlSuccessWindow)
+		}
+		if ratio, ok := i.SuccessRatios.ratio(device.Info_Name); ok {
+			ch <- prometheus.MustNewConstMetric(
+				metricDeviceCollectionSuccessRatio,
+				prometheus.GaugeValue,
+				ratio,
+				name,
+			)
+		}
+	}
+	collectRAIDControllers(ch, readRAIDControllers(i.logger, i.Devices))
+	collectDegradedArrays(i.logger, ch, i.Devices, serials)
+	if i.SelfTests != nil {
+		i.SelfTests.Collect(ch)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricSubprocessTotal,
+		prometheus.CounterValue,
+		float64(smartctlSubprocessTotal.Load()),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricSubprocessFailuresTotal,
+		prometheus.CounterValue,
+		float64(smartctlSubprocessFailures.Load()),
+	)
+	maintenance := 0.0
+	if inMaintenance() {
+		maintenance = 1
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricMaintenanceMode,
+		prometheus.GaugeValue,
+		maintenance,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricExporterStartTime,
+		prometheus.GaugeValue,
+		float64(startTime),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricRescansTotal,
+		prometheus.CounterValue,
+		float64(rescans.Load()),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricReloadsTotal,
+		prometheus.CounterValue,
+		float64(reloads.Load()),
+	)
+	if n := scans.Load(); n > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			metricScansTotal,
+			prometheus.CounterValue,
+			float64(n),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricScanDuration,
+			prometheus.GaugeValue,
+			time.Duration(scanDuration.Load()).Seconds(),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricScanDevicesFound,
+			prometheus.GaugeValue,
+			float64(scanDevicesFound.Load()),
+		)
+	}
+	if scanned := lastScan.Load(); scanned > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			metricLastScanTimestamp,
+			prometheus.GaugeValue,
+			float64(scanned),
+		)
 	}
 	ch <- prometheus.MustNewConstMetric(
 		metricDeviceCount,
@@ -76,40 +399,295 @@ func (i *SMARTctlManagerCollector) Collect(ch chan<- prometheus.Metric) {
 		float64(len(i.Devices)),
 	)
 	info.Collect()
+	available := 0.0
+	if smartctlAvailable.Load() {
+		available = 1
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricSmartctlBinaryAvailable,
+		prometheus.GaugeValue,
+		available,
+	)
 	i.mutex.Unlock()
 }
 
 func (i *SMARTctlManagerCollector) RescanForDevices() {
 	for {
 		time.Sleep(*smartctlRescanInterval)
-		level.Info(i.logger).Log("msg", "Rescanning for devices")
-		devices := scanDevices(i.logger)
+		if inMaintenance() {
+			level.Info(i.rescanLogger).Log("msg", "Skipping rescan in maintenance mode")
+			continue
+		}
 		i.mutex.Lock()
-		i.Devices = devices
+		configured := i.configured
 		i.mutex.Unlock()
+		// Explicit devices are not scanned, unless they are regexps.
+		if configured || (len(*smartctlDevices) > 0 && *smartctlDeviceMatch == "exact") {
+			continue
+		}
+		level.Info(i.rescanLogger).Log("msg", "Rescanning for devices")
+		devices := loadDevices(i.rescanLogger, i.scanLogger, nil)
+		i.mutex.Lock()
+		i.setDevices(devices)
+		i.mutex.Unlock()
+		rescans.Add(1)
 	}
 }
 
+// ReloadOnSignal reloads the config file and the devices on every SIGHUP.
+func (i *SMARTctlManagerCollector) ReloadOnSignal(logger log.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		level.Info(logger).Log("msg", "Reloading on SIGHUP")
+		if err := i.reload(logger); err != nil {
+			level.Error(logger).Log("msg", "Invalid config file, keeping the current configuration", "err", err)
+		}
+	}
+}
+
+// reload applies the config file and replaces the devices. An invalid config
+// file keeps the current configuration.
+func (i *SMARTctlManagerCollector) reload(logger log.Logger) error {
+	var config *Config
+	if *configFile != "" {
+		var err error
+		if config, err = loadConfig(*configFile); err != nil {
+			return err
+		}
+		config.apply()
+	}
+	devices := loadDevices(logger, i.scanLogger, config)
+	refreshSMARTctlVersion(logger)
+
+	i.mutex.Lock()
+	added, removed := i.setDevices(devices)
+	i.configured = config != nil && len(config.Devices) > 0
+	i.mutex.Unlock()
+	reloads.Add(1)
+	level.Info(logger).Log("msg", "Reloaded", "devices", len(devices), "added", added, "removed", removed)
+	return nil
+}
+
+// setDevices replaces the collected devices and forgets the state of the
+// removed ones. The caller holds the mutex.
+func (i *SMARTctlManagerCollector) setDevices(devices []Device) (added, removed int) {
+	current := map[Device]bool{}
+	for _, device := range i.Devices {
+		current[device] = true
+	}
+	for _, device := range devices {
+		if !current[device] {
+			added++
+		}
+		delete(current, device)
+	}
+	names := map[string]bool{}
+	for _, device := range devices {
+		names[device.Info_Name] = true
+	}
+	for device := range current {
+		forgetDevice(device)
+		if i.SuccessRatios != nil && !names[device.Info_Name] {
+			i.SuccessRatios.forget(device.Info_Name)
+		}
+	}
+	i.Devices = devices
+	return added, len(current)
+}
+
+// currentDevices returns a copy of the collected devices.
+func (i *SMARTctlManagerCollector) currentDevices() []Device {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return append([]Device{}, i.Devices...)
+}
+
+// ServeDevices writes the devices currently collected as JSON.
+func (i *SMARTctlManagerCollector) ServeDevices(w http.ResponseWriter, r *http.Request) {
+	devices := i.currentDevices()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(devices); err != nil {
+		level.Warn(i.logger).Log("msg", "Devices writing", "err", err)
+	}
+}
+
+// ServeHealthy reports that the exporter is up.
+func (i *SMARTctlManagerCollector) ServeHealthy(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "Healthy\n")
+}
+
+// ServeReady reports whether the last collection read any device
+// successfully, so it fails again while smartctl cannot read the devices. The
+// devices are loaded before the HTTP server starts, so the initial scan is
+// complete whenever this is served.
+func (i *SMARTctlManagerCollector) ServeReady(w http.ResponseWriter, r *http.Request) {
+	if !i.collected.Load() {
+		http.Error(w, "No device read in the last collection", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "Ready\n")
+}
+
+// loadDevices returns the JSON files of smartctl.fake-json-dir, else the
+// devices of the config file, else the devices given with smartctl.device,
+// else the scanned ones. See selectDevices.
+func loadDevices(logger log.Logger, scanLogger log.Logger, config *Config) []Device {
+	var devices []Device
+	if *smartctlFakeJSONDir != "" {
+		devices = fakeJSONDevices(logger, *smartctlFakeJSONDir)
+	} else {
+		var configured []Device
+		if config != nil && len(config.Devices) > 0 {
+			configured = config.devices()
+			level.Info(logger).Log("msg", "Devices configured", "file", *configFile, "count", len(configured))
+		}
+		devices = selectDevices(logger, configured, *smartctlDevices, func(filter deviceFilter) []Device {
+			devices := scanDevices(scanLogger, filter)
+			level.Info(logger).Log("msg", "Number of devices found", "count", len(devices))
+			return devices
+		})
+	}
+	for idx, device := range devices {
+		if args, ok := (*smartctlDeviceExtraArgs)[device.Name]; ok && device.ExtraArgs == "" {
+			devices[idx].ExtraArgs = args
+		}
+		devices[idx].Alias = deviceAlias(device)
+	}
+	refreshRAIDDriveLocations(scanLogger, devices)
+	return devices
+}
+
+// selectDevices applies the precedence of the device sources:
+//   - devices of the config file are used as configured, filtered by the
+//     explicit devices if any;
+//   - explicit devices are used as given, without scanning and without
+//     smartctl.device-include and smartctl.device-exclude;
+//   - in regex mode, the explicit devices are regexps selecting from the
+//     scanned devices, again without include and exclude;
+//   - otherwise the scanned devices are used, filtered by include and exclude.
+func selectDevices(logger log.Logger, configured []Device, explicit []string, scan func(deviceFilter) []Device) []Device {
+	switch {
+	case len(configured) > 0 && len(explicit) > 0:
+		devices := filterDevices(logger, configured, explicit)
+		level.Info(logger).Log("msg", "Devices filtered", "count", len(devices))
+		return devices
+	case len(configured) > 0:
+		return configured
+	case len(explicit) > 0 && *smartctlDeviceMatch == "regex":
+		level.Info(logger).Log("msg", "Devices specified", "devices", strings.Join(explicit, ", "))
+		devices := filterDevices(logger, scan(deviceFilter{}), explicit)
+		level.Info(logger).Log("msg", "Devices filtered", "count", len(devices))
+		return devices
+	case len(explicit) > 0:
+		level.Info(logger).Log("msg", "Devices specified", "devices", strings.Join(explicit, ", "))
+		return explicitDevices(explicit)
+	}
+	return scan(newDeviceFilter(*smartctlDeviceExclude, *smartctlDeviceInclude))
+}
+
+// explicitDevices returns the devices given with smartctl.device. Their
+// type is detected by smartctl, devices that need one go in the config file.
+func explicitDevices(names []string) []Device {
+	devices := []Device{}
+	for _, name := range names {
+		devices = append(devices, Device{
+			Name:       name,
+			Info_Name:  getDiskName(name, ""),
+			TypeSource: TypeSourceFlag,
+		})
+	}
+	return devices
+}
+
 var (
+	configFile = kingpin.Flag("config.file",
+		"YAML file with the devices to read instead of the scanned ones and options overriding the flags",
+	).Default("").String()
 	smartctlPath = kingpin.Flag("smartctl.path",
 		"The path to the smartctl binary",
 	).Default("/usr/sbin/smartctl").String()
+	smartctlHelperPath = kingpin.Flag("smartctl.helper-path",
+		"The path to the privileged smartctl_helper, used instead of smartctl.path when set",
+	).Default("").String()
+	smartctlSudo = kingpin.Flag("smartctl.sudo",
+		"Run smartctl, or smartctl.helper-path when set, through sudo -n",
+	).Default("false").Bool()
+	smartctlSudoPath = kingpin.Flag("smartctl.sudo-path",
+		"The path to the sudo binary used with smartctl.sudo",
+	).Default("sudo").String()
 	smartctlInterval = kingpin.Flag("smartctl.interval",
 		"The interval between smartctl polls",
 	).Default("60s").Duration()
 	smartctlRescanInterval = kingpin.Flag("smartctl.rescan",
 		"The interval between rescanning for new/disappeared devices. If the interval is smaller than 1s no rescanning takes place. If any devices are configured with smartctl.device also no rescanning takes place.",
 	).Default("10m").Duration()
+	smartctlSuccessWindow = kingpin.Flag("smartctl.success-window",
+		"The number of last collection attempts used for the per-device collection success ratio",
+	).Default("10").Int()
+	maintenanceFile = kingpin.Flag("maintenance.file",
+		"While this file exists devices are neither scanned nor read, the last read values are exported",
+	).Default("").String()
+	smartctlTimeout = kingpin.Flag("smartctl.timeout",
+		"The time after which a smartctl run is killed and the device skipped, 0 to wait indefinitely",
+	).Default("30s").Duration()
+	smartctlRetries = kingpin.Flag("smartctl.retries",
+		"How often a failed smartctl run is retried with a short backoff, at most 2s per device, e.g. for USB bridges failing intermittently. Missing, locked and sleeping devices are not retried",
+	).Default("0").Int()
+	smartctlNocheck = kingpin.Flag("smartctl.nocheck",
+		"Skip devices in this or a lower power mode instead of spinning them up, passed to smartctl --nocheck",
+	).Default("standby").Enum("never", "sleep", "standby", "idle")
+	smartctlSerialMode = kingpin.Flag("smartctl.serial-mode",
+		"How serial numbers are exported in labels: full, hashed (truncated SHA-256) or omit",
+	).Default("full").Enum("full", "hashed", "omit")
+	smartctlTemperatureUnit = kingpin.Flag("smartctl.temperature-unit",
+		"With fahrenheit, device temperatures are also exported in fahrenheit under _fahrenheit metric names, next to the celsius ones",
+	).Default("celsius").Enum("celsius", "fahrenheit")
+	smartctlMaxConcurrency = kingpin.Flag("smartctl.max-concurrency",
+		"The maximum number of devices read in parallel",
+	).Default("4").Int()
 	smartctlDevices = kingpin.Flag("smartctl.device",
 		"The device to monitor (repeatable)",
 	).Strings()
+	smartctlDeviceMatch = kingpin.Flag("smartctl.device-match",
+		"How smartctl.device is matched against the device names: exact or regex",
+	).Default("exact").Enum("exact", "regex")
+	smartctlDeviceLabel = kingpin.Flag("smartctl.device-label",
+		"Fixed device label of the drive with the given serial number, replacing the name derived from its address, e.g. S3Z8NB0K123456=db-journal (repeatable)",
+	).StringMap()
+	smartctlDeviceAlias = kingpin.Flag("smartctl.device-alias",
+		"Alias label of the device metrics, the device is matched by name or info name, e.g. /dev/sda=nvme-boot (repeatable)",
+	).StringMap()
+	smartctlDeviceExtraArgs = kingpin.Flag("smartctl.device-args",
+		"Additional smartctl arguments for the device, separated by whitespace, e.g. /dev/sda=--nocheck=never (repeatable)",
+	).StringMap()
+	smartctlDeviceTypeAlias = kingpin.Flag("smartctl.device-type-alias",
+		"Alias for a smartctl device type, usable as type of probed devices, e.g. mr5=megaraid,5 (repeatable)",
+	).StringMap()
 	smartctlDeviceExclude = kingpin.Flag(
 		"smartctl.device-exclude",
-		"Regexp of devices to exclude from automatic scanning. (mutually exclusive to device-include)",
+		"Regexp of devices to exclude from automatic scanning, also applied together with device-include",
 	).Default("").String()
 	smartctlDeviceInclude = kingpin.Flag(
 		"smartctl.device-include",
-		"Regexp of devices to exclude from automatic scanning. (mutually exclusive to device-exclude)",
+		"Regexp of devices to include in automatic scanning, devices matching device-exclude are still excluded",
+	).Default("").String()
+	smartctlExcludeVirtual = kingpin.Flag("smartctl.exclude-virtual",
+		"Exclude virtual devices (loop, device-mapper, ...) from automatic scanning",
+	).Default("false").Bool()
+	smartctlMinCapacity = kingpin.Flag("smartctl.min-capacity",
+		"Exclude devices smaller than this capacity from automatic scanning, in base 2 units, e.g. 100GB. 0 for no limit",
+	).Default("0").Bytes()
+	smartctlMaxCapacity = kingpin.Flag("smartctl.max-capacity",
+		"Exclude devices larger than this capacity from automatic scanning, in base 2 units, e.g. 4TB. 0 for no limit",
+	).Default("0").Bytes()
+	smartctlTextFallback = kingpin.Flag("smartctl.text-fallback",
+		"Parse the text output of smartctl -a if smartctl does not support --json. Only the device information, health, temperature, power-on time, ATA attributes, SCSI grown defects and NVMe health log are exported then",
+	).Default("false").Bool()
+	smartctlFakeJSONDir = kingpin.Flag("smartctl.fake-json-dir",
+		"Directory of captured smartctl --json outputs, each *.json file is read as one device instead of running smartctl. For testing and reproducing issues",
 	).Default("").String()
 	smartctlFakeData = kingpin.Flag("smartctl.fake-data",
 		"The device to monitor (repeatable)",
@@ -117,34 +695,281 @@ var (
 	ccissVolStatusPath = kingpin.Flag("ccissvolstatus.path",
 		"The path to the cciss_vol_status binary",
 	).Default("/usr/bin/cciss_vol_status").String()
+	smartctlSchemaValidation = kingpin.Flag("smartctl.schema-validation",
+		"Report expected smartctl JSON fields missing from the device output",
+	).Default("false").Bool()
+	smartctlDebugFieldPresence = kingpin.Flag("smartctl.debug-field-presence",
+		"Report for every JSON field metrics are read from whether the device output has it. Adds many series, meant for debugging missing metrics",
+	).Default("false").Bool()
+	smartctlScheduleSelfTests = kingpin.Flag("smartctl.schedule-selftests",
+		"Periodically start SMART self-tests on all devices. This writes to the devices and is not supported through smartctl.helper-path",
+	).Default("false").Bool()
+	smartctlSelfTestShortInterval = kingpin.Flag("smartctl.selftest-short-interval",
+		"The interval between short self-tests with smartctl.schedule-selftests. 0 to disable",
+	).Default("24h").Duration()
+	smartctlSelfTestLongInterval = kingpin.Flag("smartctl.selftest-long-interval",
+		"The interval between long self-tests with smartctl.schedule-selftests. 0 to disable",
+	).Default("0").Duration()
+	smartctlSelfTestStart = kingpin.Flag("smartctl.selftest-start",
+		"Local time of day (HH:MM) the scheduled self-tests run at, and every interval from it, e.g. in a maintenance window. Empty to count the intervals from the exporter start",
+	).Default("").String()
+	smartctlSelfTestStagger = kingpin.Flag("smartctl.selftest-stagger",
+		"The delay between starting the scheduled self-tests of consecutive devices",
+	).Default("1m").Duration()
+	smartctlAttributeScale = kingpin.Flag("smartctl.attribute-scale",
+		"Divide the raw value of a SMART attribute, given by id or name, by an integer factor and add the unit to the attribute_value_type label, e.g. 241=1000000000:giga_lbas (repeatable)",
+	).StringMap()
+	smartctlHealthScore = kingpin.Flag("smartctl.health-score",
+		"Export the heuristic smartctl_device_health_score",
+	).Default("false").Bool()
+	smartctlHealthScoreWeight = kingpin.Flag("smartctl.health-score-weight",
+		"Override the weight of a health score component, e.g. temperature=20 (repeatable)",
+	).StringMap()
+	smartctlAttributeThreshold = kingpin.Flag("smartctl.attribute-threshold",
+		"Warning threshold of a SMART attribute, given by id or name, on the raw value (exceeded above) or the normalized value (exceeded at or below), e.g. 5=raw:10 or 231=value:20 (repeatable)",
+	).StringMap()
+	smartctlAttributeInclude = kingpin.Flag("smartctl.attribute-include",
+		"Comma separated ids or names of the only SMART attributes to export (mutually exclusive to attribute-exclude)",
+	).Default("").String()
+	smartctlAttributeExclude = kingpin.Flag("smartctl.attribute-exclude",
+		"Comma separated ids or names of SMART attributes not to export (mutually exclusive to attribute-include)",
+	).Default("").String()
+	smartctlLogPageField = kingpin.Flag("smartctl.log-page-field",
+		"Little-endian integer read from an ATA general purpose log page, exported under the given name, as page:offset:size[:model regexp], e.g. wear=0xc0:32:2 (repeatable)",
+	).StringMap()
+	smartctlAttributeWarnCount = kingpin.Flag("smartctl.attribute-warn-count",
+		"Log a warning when a device reports more SMART attributes than this",
+	).Default("255").Int()
+	smartctlAttributeLimit = kingpin.Flag("smartctl.attribute-limit",
+		"The maximum number of SMART attributes exported per device. 0 for no limit",
+	).Default("0").Int()
+	smartctlAmbientTemperatureFile = kingpin.Flag("smartctl.ambient-temperature-file",
+		"File containing the ambient/inlet temperature in celsius, used to export the device temperature delta",
+	).Default("").String()
+	lvmEnabled = kingpin.Flag("lvm.enabled",
+		"Export the LVM logical volumes using the devices",
+	).Default("false").Bool()
+	remoteWriteURL = kingpin.Flag("remote-write.url",
+		"Prometheus remote write endpoint the metrics are pushed to every smartctl.interval, disabled if empty",
+	).Default("").String()
+	remoteWriteBearerTokenFile = kingpin.Flag("remote-write.bearer-token-file",
+		"File with the bearer token sent to the remote write endpoint",
+	).Default("").String()
+	mdstatPath = kingpin.Flag("mdstat.path",
+		"The path to the mdstat file, used to find Linux software RAID arrays the devices belong to. Empty to disable",
+	).Default("").String()
+	zpoolPath = kingpin.Flag("zpool.path",
+		"The path to the zpool binary, used to find the ZFS pools the devices belong to. Empty to disable",
+	).Default("").String()
+	nvmePath = kingpin.Flag("nvme.path",
+		"The path to the nvme-cli binary, used to read the OCP extended SMART log of NVMe devices. Disabled if empty",
+	).Default("").String()
+	remoteCommandTemplate = kingpin.Flag("remote.command-template",
+		"Command running smartctl on the host given by the target parameter of /scrape, {target} is replaced by the host. /scrape is disabled if empty",
+	).Default("").PlaceHolder(`"ssh {target} sudo smartctl"`).String()
+	arcconfPath = kingpin.Flag("arcconf.path",
+		"The path to the arcconf binary, used for the cache and BBU state of Adaptec controllers with aacraid devices. Areca controllers are not supported. Empty to disable",
+	).Default("").String()
+	storcliPath = kingpin.Flag("storcli.path",
+		"The path to the storcli binary, used for MegaRAID controller details. Empty to disable",
+	).Default("").String()
+	verify = kingpin.Flag("verify",
+		"Collect every device once, print a pass/fail report and exit. The exit code is 0 if at least verify.min-success-ratio of the devices were read",
+	).Default("false").Bool()
+	verifyMinSuccessRatio = kingpin.Flag("verify.min-success-ratio",
+		"The ratio of devices that must be read successfully for verify to pass",
+	).Default("1").Float64()
+	logLevelScan = kingpin.Flag("log.level.scan",
+		"Only log messages of device scanning with the given severity or above. Defaults to log.level. One of: [debug, info, warn, error]",
+	).Default("").String()
+	logLevelCollect = kingpin.Flag("log.level.collect",
+		"Only log messages of device collection with the given severity or above. Defaults to log.level. One of: [debug, info, warn, error]",
+	).Default("").String()
+	logLevelRescan = kingpin.Flag("log.level.rescan",
+		"Only log messages of background rescanning with the given severity or above. Defaults to log.level. One of: [debug, info, warn, error]",
+	).Default("").String()
+	metricPrefix = kingpin.Flag("web.metric-prefix",
+		"Prefix of the exported metric names, replacing smartctl",
+	).Default(defaultMetricPrefix).String()
+	smartctlExtraLabels = kingpin.Flag("smartctl.extra-label",
+		"Label added to all exported metrics, e.g. datacenter=fra1 (repeatable)",
+	).StringMap()
 )
 
-// scanDevices uses smartctl to gather the list of available devices.
-func scanDevices(logger log.Logger) []Device {
-	filter := newDeviceFilter(*smartctlDeviceExclude, *smartctlDeviceInclude)
+var (
+	// attributeScales are the parsed smartctl.attribute-scale flags.
+	attributeScales map[string]attributeScale
+	// logPageFields are the parsed smartctl.log-page-field flags.
+	logPageFields []logPageField
+	// deviceTypeAliases are the resolved smartctl.device-type-alias flags.
+	deviceTypeAliases map[string]string
+	// attributeThresholds are the parsed smartctl.attribute-threshold flags.
+	attributeThresholds map[string]attributeThreshold
+	// exportedAttributes is the smartctl.attribute-include or
+	// smartctl.attribute-exclude filter.
+	exportedAttributes attributeFilter
+	// healthScoreWeights are the default weights with the
+	// smartctl.health-score-weight flags applied.
+	healthScoreWeights map[string]float64
+)
 
-	baseDevices := readSMARTctlDevices(logger)
-	raidDevices := readSMARTctlDevices(logger, "-d", "sat")
+// newComponentLogger returns a logger tagged with the component name. If a
+// level is given, it overrides the global log level for this component.
+func newComponentLogger(logger log.Logger, promlogConfig *promlog.Config, component string, lvl string) (log.Logger, error) {
+	if lvl != "" {
+		allowedLevel := &promlog.AllowedLevel{}
+		if err := allowedLevel.Set(lvl); err != nil {
+			return nil, err
+		}
+		logger = promlog.New(&promlog.Config{Level: allowedLevel, Format: promlogConfig.Format})
+	}
+	return log.With(logger, "component", component), nil
+}
 
-	scanDevices := []Device{}
+var (
+	// startTime is the Unix time the exporter was started.
+	startTime = time.Now().Unix()
+	// lastScan is the Unix time of the last successful device scan.
+	lastScan atomic.Int64
+	// rescans counts the completed background rescans.
+	rescans atomic.Uint64
+	// scans counts all device scans, scanDuration and scanDevicesFound are
+	// the duration in nanoseconds and the device count of the last one.
+	scans            atomic.Uint64
+	scanDuration     atomic.Int64
+	scanDevicesFound atomic.Int64
+	// reloads counts the completed reloads on SIGHUP.
+	reloads atomic.Uint64
 
-	isExists := map[string]bool{}
-	for _, d := range baseDevices.Get("devices").Array() {
-		level.Debug(logger).Log("base_device: ", d)
-		isExists[strings.TrimSpace(d.Get("info_name").String())] = true
+	duplicateSerials      map[string]bool
+	duplicateSerialsMutex sync.RWMutex
+)
 
-		deviceName := getDiskName(
-			strings.TrimSpace(d.Get("name").String()),
-			strings.TrimSpace(d.Get("info_name").String()),
+// readDevices reads the devices with up to concurrency smartctl processes at
+// a time. The results are in the order of the devices.
+func readDevices(logger log.Logger, devices []Device, concurrency int) []gjson.Result {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]gjson.Result, len(devices))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for idx, device := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(idx int, device Device) {
+			defer wg.Done()
+			results[idx] = readData(logger, device)
+			<-sem
+		}(idx, device)
+	}
+	wg.Wait()
+	return results
+}
+
+// checkPermissions logs an error if every device failed to be read because
+// of missing privileges, the exporter is then most likely misconfigured.
+func checkPermissions(logger log.Logger, devices []Device) {
+	if len(devices) == 0 {
+		return
+	}
+	for _, device := range devices {
+		collectErr, ok := lastCollectError(device)
+		if !ok || collectErr.Reason != CollectReasonPermissionDenied {
+			return
+		}
+	}
+	level.Error(logger).Log("msg", "Permission denied reading all devices. smartctl needs to run as root or with the CAP_SYS_RAWIO and CAP_SYS_ADMIN capabilities, see --smartctl.helper-path to run only the helper privileged", "devices", len(devices))
+}
+
+// collectDuplicateSerials sends the serial numbers reported by more than one
+// device and remembers them, so their devices keep the label derived from
+// the address instead of a configured smartctl.device-label.
+func collectDuplicateSerials(logger log.Logger, ch chan<- prometheus.Metric, serials map[Device]string) {
+	devices := map[string][]string{}
+	for device, serial := range serials {
+		if serial != "" {
+			devices[serial] = append(devices[serial], device.Info_Name)
+		}
+	}
+	duplicates := map[string]bool{}
+	for serial, names := range devices {
+		if len(names) < 2 {
+			continue
+		}
+		sort.Strings(names)
+		level.Warn(logger).Log("msg", "Serial number reported by multiple devices", "serial", serial, "devices", strings.Join(names, ", "))
+		duplicates[serial] = true
+		ch <- prometheus.MustNewConstMetric(
+			metricDuplicateSerial,
+			prometheus.GaugeValue,
+			1,
+			serialLabel(serial),
 		)
+	}
+	duplicateSerialsMutex.Lock()
+	duplicateSerials = duplicates
+	duplicateSerialsMutex.Unlock()
+}
 
-		device := Device{
-			Name:      d.Get("name").String(),
-			Info_Name: deviceName,
-			Type:      d.Get("type").String(),
+// isDuplicateSerial returns whether the serial number was reported by more
+// than one device in the last collection.
+func isDuplicateSerial(serial string) bool {
+	duplicateSerialsMutex.RLock()
+	defer duplicateSerialsMutex.RUnlock()
+	return duplicateSerials[serial]
+}
+
+// inMaintenance returns whether the maintenance file exists. Devices are not
+// read in maintenance mode, the last read values are exported instead.
+func inMaintenance() bool {
+	if *maintenanceFile == "" {
+		return false
+	}
+	_, err := os.Stat(*maintenanceFile)
+	return err == nil
+}
+
+// parseScannedDevices returns the devices of smartctl --scan and their info
+// names. smartctl enumerates the disks behind every MegaRAID controller
+// itself, as /dev/bus/N with type megaraid,ID, so all controllers and slots
+// are covered. Devices listed more than once are returned once.
+func parseScannedDevices(logger log.Logger, scan gjson.Result) ([]Device, map[string]bool) {
+	devices := []Device{}
+	isExists := map[string]bool{}
+	for _, d := range scan.Get("devices").Array() {
+		level.Debug(logger).Log("base_device: ", d)
+		infoName := strings.TrimSpace(d.Get("info_name").String())
+		if isExists[infoName] {
+			continue
 		}
-		scanDevices = append(scanDevices, device)
+		isExists[infoName] = true
+
+		devices = append(devices, Device{
+			Name:       d.Get("name").String(),
+			Info_Name:  getDiskName(strings.TrimSpace(d.Get("name").String()), infoName),
+			Type:       d.Get("type").String(),
+			TypeSource: TypeSourceScan,
+		})
+	}
+	return devices, isExists
+}
+
+// scanDevices uses smartctl to gather the list of available devices not
+// ignored by the filter.
+func scanDevices(logger log.Logger, filter deviceFilter) []Device {
+	start := time.Now()
+	defer func() {
+		scanDuration.Store(int64(time.Since(start)))
+		scans.Add(1)
+	}()
+	baseDevices := readSMARTctlDevices(logger)
+	if baseDevices.Exists() {
+		lastScan.Store(time.Now().Unix())
 	}
+	raidDevices := readSMARTctlDevices(logger, "-d", "sat")
+
+	scanDevices, isExists := parseScannedDevices(logger, baseDevices)
 
 	for _, d := range raidDevices.Get("devices").Array() {
 		if isExists[strings.TrimSpace(d.Get("info_name").String())] {
@@ -160,23 +985,128 @@ func scanDevices(logger log.Logger) []Device {
 	for _, d := range scanDevices {
 		if filter.ignored(d.Info_Name) {
 			level.Info(logger).Log("msg", "Ignoring device", "name", d.Info_Name)
+		} else if *smartctlExcludeVirtual && isVirtualDevice(d.Name) {
+			level.Info(logger).Log("msg", "Ignoring virtual device", "name", d.Info_Name)
+		} else if capacityIgnored(logger, d) {
+			continue
 		} else {
 			level.Info(logger).Log("msg", "Found device", "name", d.Info_Name)
 			scanDeviceResult = append(scanDeviceResult, d)
 		}
 	}
+	scanDevicesFound.Store(int64(len(scanDeviceResult)))
 	return scanDeviceResult
 }
 
+// newRegistry returns the registry of the exporter, with the Go and process
+// metrics of the exporter itself unless disabled.
+func newRegistry(exporterMetrics bool) *prometheus.Registry {
+	reg := prometheus.NewPedanticRegistry()
+	if exporterMetrics {
+		reg.MustRegister(
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+			collectors.NewGoCollector(),
+		)
+	}
+	return reg
+}
+
+// headerNameRe matches the token characters allowed in HTTP header names.
+var headerNameRe = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9A-Za-z]+$")
+
+// withResponseHeaders adds the headers to every response of the handler.
+func withResponseHeaders(handler http.Handler, headers map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range headers {
+			w.Header().Set(name, value)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// warnDuplicateDeviceLabels warns about device labels configured for more
+// than one serial number, the series of these drives would be merged.
+func warnDuplicateDeviceLabels(logger log.Logger, labels map[string]string) {
+	serials := map[string][]string{}
+	for serial, label := range labels {
+		serials[label] = append(serials[label], serial)
+	}
+	for label, s := range serials {
+		if len(s) > 1 {
+			sort.Strings(s)
+			level.Warn(logger).Log("msg", "Device label configured for multiple serial numbers", "label", label, "serials", strings.Join(s, ", "))
+		}
+	}
+}
+
+// deviceLabels holds the smartctl.device-label of the devices, resolved from
+// the serial number of their last read, so devices failing to be read keep it.
+var deviceLabels sync.Map
+
+// serialDeviceLabel returns the smartctl.device-label configured for the
+// serial number. It is not used while several drives report the serial, their
+// series would collide.
+func serialDeviceLabel(serial string) (string, bool) {
+	if serial == "" || isDuplicateSerial(serial) {
+		return "", false
+	}
+	label, ok := (*smartctlDeviceLabel)[serial]
+	return label, ok
+}
+
+// setDeviceLabel resolves the label of the device from the serial number it
+// reported, an empty serial keeps the last resolved label.
+func setDeviceLabel(device Device, serial string) {
+	if serial == "" {
+		return
+	}
+	if label, ok := serialDeviceLabel(serial); ok {
+		deviceLabels.Store(device, label)
+	} else {
+		deviceLabels.Delete(device)
+	}
+}
+
+// deviceLabel returns the device label of the device metrics: the configured
+// label of the device, the label of its serial number or its info name.
+func deviceLabel(device Device) string {
+	if device.Label != "" {
+		return device.Label
+	}
+	if label, ok := deviceLabels.Load(device); ok {
+		return label.(string)
+	}
+	return device.Info_Name
+}
+
+// capacityIgnored returns whether the device capacity is outside of the
+// configured range. Devices with unknown capacity are kept.
+func capacityIgnored(logger log.Logger, d Device) bool {
+	if *smartctlMinCapacity == 0 && *smartctlMaxCapacity == 0 {
+		return false
+	}
+	json := readSMARTctlInfo(logger, d)
+	capacity := schemaField(json, "capacity_bytes").Float()
+	if capacity == 0 {
+		level.Debug(logger).Log("msg", "Unknown device capacity", "name", d.Info_Name)
+		return false
+	}
+	if capacity < float64(*smartctlMinCapacity) || (*smartctlMaxCapacity > 0 && capacity > float64(*smartctlMaxCapacity)) {
+		level.Info(logger).Log("msg", "Ignoring device by capacity", "name", d.Info_Name, "capacity", int64(capacity))
+		return true
+	}
+	return false
+}
+
+// filterDevices returns the devices matching any of the filters, see
+// deviceMatcher.
 func filterDevices(logger log.Logger, devices []Device, filters []string) []Device {
 	var filtered []Device
+	matcher := newDeviceMatcher(filters)
 	for _, d := range devices {
-		for _, filter := range filters {
-			level.Debug(logger).Log("msg", "filterDevices", "device", d.Info_Name, "filter", filter)
-			if strings.Contains(d.Info_Name, filter) {
-				filtered = append(filtered, d)
-				break
-			}
+		if matcher.matches(d) {
+			level.Debug(logger).Log("msg", "filterDevices", "device", d.Info_Name, "matched", true)
+			filtered = append(filtered, d)
 		}
 	}
 	return filtered
@@ -187,6 +1117,12 @@ func main() {
 		"web.telemetry-path", "Path under which to expose metrics",
 	).Default("/metrics").String()
 	toolkitFlags := webflag.AddFlags(kingpin.CommandLine, ":9633")
+	responseHeaders := kingpin.Flag(
+		"web.response-header", "Header added to every HTTP response, e.g. Cache-Control=no-store (repeatable)",
+	).StringMap()
+	disableExporterMetrics := kingpin.Flag(
+		"web.disable-exporter-metrics", "Exclude the Go and process metrics of the exporter itself",
+	).Bool()
 
 	promlogConfig := &promlog.Config{}
 	flag.AddFlags(kingpin.CommandLine, promlogConfig)
@@ -198,35 +1134,154 @@ func main() {
 	level.Info(logger).Log("msg", "Starting smartctl_exporter", "version", version.Info())
 	level.Info(logger).Log("msg", "Build context", "build_context", version.BuildContext())
 
-	var devices []Device
-	devices = scanDevices(logger)
-	level.Info(logger).Log("msg", "Number of devices found", "count", len(devices))
-	if len(*smartctlDevices) > 0 {
-		level.Info(logger).Log("msg", "Devices specified", "devices", strings.Join(*smartctlDevices, ", "))
-		devices = filterDevices(logger, devices, *smartctlDevices)
-		level.Info(logger).Log("msg", "Devices filtered", "count", len(devices))
+	scanLogger, err := newComponentLogger(logger, promlogConfig, "scan", *logLevelScan)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid scan log level", "err", err)
+		os.Exit(1)
+	}
+	collectLogger, err := newComponentLogger(logger, promlogConfig, "collect", *logLevelCollect)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid collect log level", "err", err)
+		os.Exit(1)
+	}
+	rescanLogger, err := newComponentLogger(logger, promlogConfig, "rescan", *logLevelRescan)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid rescan log level", "err", err)
+		os.Exit(1)
+	}
+
+	attributeScales, err = parseAttributeScales(*smartctlAttributeScale)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid attribute scale", "err", err)
+		os.Exit(1)
+	}
+
+	if *smartctlSuccessWindow < 1 {
+		level.Error(logger).Log("msg", "Invalid success window, must be at least 1", "window", *smartctlSuccessWindow)
+		os.Exit(1)
+	}
+	if err := parseSelfTestStart(*smartctlSelfTestStart); err != nil {
+		level.Error(logger).Log("msg", "Invalid self-test start time", "start", *smartctlSelfTestStart, "err", err)
+		os.Exit(1)
+	}
+	if !validMetricPrefix(*metricPrefix) {
+		level.Error(logger).Log("msg", "Invalid metric prefix", "prefix", *metricPrefix)
+		os.Exit(1)
+	}
+	if err := validateExtraLabels(*smartctlExtraLabels); err != nil {
+		level.Error(logger).Log("msg", "Invalid extra label", "err", err)
+		os.Exit(1)
+	}
+	if *smartctlDeviceMatch == "regex" {
+		for _, filter := range *smartctlDevices {
+			if _, err := regexp.Compile(filter); err != nil {
+				level.Error(logger).Log("msg", "Invalid device regexp", "err", err)
+				os.Exit(1)
+			}
+		}
+	}
+	warnDuplicateDeviceLabels(logger, *smartctlDeviceLabel)
+	logPageFields, err = parseLogPageFields(*smartctlLogPageField)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid log page field", "err", err)
+		os.Exit(1)
+	}
+	deviceTypeAliases, err = parseDeviceTypeAliases(*smartctlDeviceTypeAlias)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid device type alias", "err", err)
+		os.Exit(1)
+	}
+	attributeThresholds, err = parseAttributeThresholds(*smartctlAttributeThreshold)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid attribute threshold", "err", err)
+		os.Exit(1)
+	}
+	exportedAttributes, err = newAttributeFilter(*smartctlAttributeInclude, *smartctlAttributeExclude)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid attribute filter", "err", err)
+		os.Exit(1)
+	}
+	healthScoreWeights, err = parseHealthScoreWeights(*smartctlHealthScoreWeight)
+	if err != nil {
+		level.Error(logger).Log("msg", "Invalid health score weight", "err", err)
+		os.Exit(1)
+	}
+
+	var config *Config
+	if *configFile != "" {
+		config, err = loadConfig(*configFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "Invalid config file", "err", err)
+			os.Exit(1)
+		}
+		config.apply()
+	}
+	refreshSMARTctlVersion(logger)
+	if !smartctlAvailable.Load() && *smartctlFakeJSONDir == "" {
+		path := *smartctlPath
+		if *smartctlHelperPath != "" {
+			path = *smartctlHelperPath
+		}
+		level.Error(logger).Log("msg", "smartctl cannot be run, no devices will be read until it is available", "path", path)
+	}
+	devices := loadDevices(logger, scanLogger, config)
+
+	if *verify {
+		os.Exit(verifyDevices(collectLogger, devices, *verifyMinSuccessRatio, os.Stdout))
 	}
 
 	collector := SMARTctlManagerCollector{
-		Devices: devices,
-		logger:  logger,
+		Devices:       devices,
+		SuccessRatios: newSuccessRatios(),
+		logger:        collectLogger,
+		scanLogger:    scanLogger,
+		rescanLogger:  rescanLogger,
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
 	}
 
+	collector.configured = config != nil && len(config.Devices) > 0
+	go collector.ReloadOnSignal(logger)
 	if *smartctlRescanInterval >= 1*time.Second {
 		level.Info(logger).Log("msg", "Start background scan process")
 		level.Info(logger).Log("msg", "Rescanning for devices every", "rescanInterval", *smartctlRescanInterval)
 		go collector.RescanForDevices()
 	}
 
-	reg := prometheus.NewPedanticRegistry()
-	reg.MustRegister(
-		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
-		collectors.NewGoCollector(),
-	)
+	if *smartctlScheduleSelfTests {
+		collector.SelfTests = newSelfTestScheduler(&collector, collectLogger, *smartctlSelfTestStart, *smartctlSelfTestStagger)
+		for testType, interval := range map[string]time.Duration{
+			"short": *smartctlSelfTestShortInterval,
+			"long":  *smartctlSelfTestLongInterval,
+		} {
+			if interval > 0 {
+				level.Info(logger).Log("msg", "Scheduling self-tests", "type", testType, "interval", interval)
+				go collector.SelfTests.Run(testType, interval)
+			}
+		}
+	}
 
+	reg := newRegistry(!*disableExporterMetrics)
 	prometheus.WrapRegistererWithPrefix("", reg).MustRegister(&collector)
+	gatherer := withMetricPrefix(withExtraLabels(withDeviceAliases(reg), *smartctlExtraLabels), *metricPrefix)
+
+	if *remoteWriteURL != "" {
+		writer := newRemoteWriter(*remoteWriteURL, gatherer, logger)
+		writer.BearerTokenFile = *remoteWriteBearerTokenFile
+		level.Info(logger).Log("msg", "Pushing metrics to remote write endpoint", "url", *remoteWriteURL, "interval", currentSettings().interval)
+		go writer.Run()
+	}
 
-	http.Handle(*metricsPath, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	http.Handle(*metricsPath, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	http.HandleFunc("/probe", func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r, collectLogger, collector.currentDevices())
+	})
+	http.HandleFunc("/scrape", func(w http.ResponseWriter, r *http.Request) {
+		scrapeHandler(w, r, collectLogger, collector.currentDevices())
+	})
+	http.HandleFunc("/devices", collector.ServeDevices)
+	http.HandleFunc("/-/healthy", collector.ServeHealthy)
+	http.HandleFunc("/-/ready", collector.ServeReady)
 
 	if *metricsPath != "/" && *metricsPath != "" {
 		landingConfig := web.LandingConfig{
@@ -238,6 +1293,10 @@ func main() {
 					Address: *metricsPath,
 					Text:    "Metrics",
 				},
+				{
+					Address: "/devices",
+					Text:    "Devices",
+				},
 			},
 		}
 		landingPage, err := web.NewLandingPage(landingConfig)
@@ -249,6 +1308,15 @@ func main() {
 	}
 
 	srv := &http.Server{}
+	if len(*responseHeaders) > 0 {
+		for name := range *responseHeaders {
+			if !headerNameRe.MatchString(name) {
+				level.Error(logger).Log("msg", "Invalid response header name", "name", name)
+				os.Exit(1)
+			}
+		}
+		srv.Handler = withResponseHeaders(http.DefaultServeMux, *responseHeaders)
+	}
 	if err := web.ListenAndServe(srv, toolkitFlags, logger); err != nil {
 		level.Error(logger).Log("err", err)
 		os.Exit(1)
@@ -0,0 +1,805 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/alecthomas/units"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// TestServeReady checks that readiness follows the last collection.
+func TestServeReady(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := filepath.Abs("testdata/HGST_HUS724020ALE640_28.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smartctl := filepath.Join(t.TempDir(), "smartctl")
+	saved := *smartctlPath
+	*smartctlPath = smartctl
+	defer func() { *smartctlPath = saved }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	defer forgetDevice(device)
+
+	collector := &SMARTctlManagerCollector{
+		Devices:       []Device{device},
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+	ready := func() int {
+		w := httptest.NewRecorder()
+		collector.ServeReady(w, httptest.NewRequest(http.MethodGet, "/-/ready", nil))
+		return w.Code
+	}
+	collect := func(script string) {
+		if err := os.WriteFile(smartctl, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		// Read the device again instead of the cached output.
+		jsonCache.Delete(device)
+		reg.Gather()
+	}
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("before the first collection: %d, want 503", code)
+	}
+	collect("cat " + fixture)
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("after a successful collection: %d, want 200", code)
+	}
+	collect("exit 1")
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("after a failed collection: %d, want 503", code)
+	}
+	collect("cat " + fixture)
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("after recovering: %d, want 200", code)
+	}
+}
+
+// TestCollectionsTotal checks that outputs served from the cache are not
+// counted as collections.
+func TestCollectionsTotal(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := filepath.Abs("testdata/HGST_HUS724020ALE640_28.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smartctl := filepath.Join(t.TempDir(), "smartctl")
+	if err := os.WriteFile(smartctl, []byte("#!/bin/sh\ncat "+fixture+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	*smartctlPath = smartctl
+	defer func() { *smartctlPath = saved }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	defer forgetDevice(device)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&SMARTctlManagerCollector{
+		Devices:       []Device{device},
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	})
+	collections := func() float64 {
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, _ := familyValue(families, "smartctl_device_collections_total")
+		return value
+	}
+	if got := collections(); got != 1 {
+		t.Errorf("after the first read: %v collections, want 1", got)
+	}
+	if got := collections(); got != 1 {
+		t.Errorf("after a cached read: %v collections, want 1", got)
+	}
+	jsonCache.Delete(device)
+	if got := collections(); got != 2 {
+		t.Errorf("after a second read: %v collections, want 2", got)
+	}
+}
+
+func TestSuccessWindowBelowOne(t *testing.T) {
+	ratios := newSuccessRatios()
+	for _, size := range []int{0, -1, 0} {
+		ratios.observe("/dev/sda", "", true, size)
+		if got, _ := ratios.ratio("/dev/sda"); got != 1 {
+			t.Errorf("window %d: ratio %v, want 1", size, got)
+		}
+	}
+	ratios.observe("/dev/sda", "", false, 0)
+	if got, _ := ratios.ratio("/dev/sda"); got != 0 {
+		t.Errorf("window 0 after a failure: ratio %v, want 0", got)
+	}
+}
+
+func TestSuccessRatiosForget(t *testing.T) {
+	ratios := newSuccessRatios()
+	ratios.observe("sda", "S1", true, 10)
+	ratios.observe("sdb", "S2", true, 10)
+	// The drive S2 moved from sdb to sdc.
+	ratios.observe("sdc", "S2", false, 10)
+	ratios.forget("sda")
+	ratios.forget("sdb")
+	if _, ok := ratios.ratio("sda"); ok {
+		t.Error("window of the removed sda kept")
+	}
+	if got, ok := ratios.ratio("sdc"); !ok || got != 0.5 {
+		t.Errorf("ratio of the moved drive %v (%t), want 0.5", got, ok)
+	}
+	if len(ratios.windows) != 1 {
+		t.Errorf("%d windows kept, want 1", len(ratios.windows))
+	}
+}
+
+// TestSuccessRatioCache checks that outputs and errors served from the cache
+// are not recorded as collection attempts.
+func TestSuccessRatioCache(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := filepath.Abs("testdata/HGST_HUS724020ALE640_28.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smartctl := filepath.Join(t.TempDir(), "smartctl")
+	if err := os.WriteFile(smartctl, []byte("#!/bin/sh\ncat "+fixture+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	*smartctlPath = smartctl
+	defer func() { *smartctlPath = saved }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	defer forgetDevice(device)
+
+	collector := &SMARTctlManagerCollector{
+		Devices:       []Device{device},
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	}
+	// Registering reads the device for the first time.
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+	ratio := func(script string, fresh bool) float64 {
+		if err := os.WriteFile(smartctl, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if fresh {
+			jsonCache.Delete(device)
+		}
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, _ := familyValue(families, "smartctl_device_collection_success_ratio")
+		return value
+	}
+
+	if got := ratio("cat "+fixture, false); got != 1 {
+		t.Errorf("after a read: ratio %v, want 1", got)
+	}
+	if got := ratio("exit 1", true); got != 0.5 {
+		t.Errorf("after a cached read: ratio %v, want 0.5", got)
+	}
+}
+
+// TestDeviceLabel checks that the label configured for the serial number is
+// used by the SMART and the exporter metrics, also while the device fails.
+func TestDeviceLabel(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := filepath.Abs("testdata/HGST_HUS724020ALE640_28.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smartctl := filepath.Join(t.TempDir(), "smartctl")
+	savedPath, savedLabels := *smartctlPath, *smartctlDeviceLabel
+	*smartctlPath = smartctl
+	*smartctlDeviceLabel = map[string]string{"REDACTED": "db-journal"}
+	defer func() { *smartctlPath, *smartctlDeviceLabel = savedPath, savedLabels }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	defer forgetDevice(device)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&SMARTctlManagerCollector{
+		Devices:       []Device{device},
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	})
+	labels := func(script string) map[string]string {
+		if err := os.WriteFile(smartctl, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		jsonCache.Delete(device)
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		devices := map[string]string{}
+		for _, family := range families {
+			for _, label := range family.GetMetric()[0].GetLabel() {
+				if label.GetName() == "device" {
+					devices[family.GetName()] = label.GetValue()
+				}
+			}
+		}
+		return devices
+	}
+
+	devices := labels("cat " + fixture)
+	for _, name := range []string{"smartctl_device_smart_status", "smartctl_device_up", "smartctl_device_collection_success_ratio"} {
+		if devices[name] != "db-journal" {
+			t.Errorf("%s: device %q, want db-journal", name, devices[name])
+		}
+	}
+	devices = labels("exit 1")
+	if devices["smartctl_device_up"] != "db-journal" {
+		t.Errorf("failed device: device %q, want db-journal", devices["smartctl_device_up"])
+	}
+}
+
+func TestWarnDuplicateDeviceLabels(t *testing.T) {
+	var buf bytes.Buffer
+	warnDuplicateDeviceLabels(log.NewLogfmtLogger(&buf), map[string]string{
+		"S1": "db",
+		"S2": "db",
+		"S3": "boot",
+	})
+	if got, want := strings.TrimSpace(buf.String()), `level=warn msg="Device label configured for multiple serial numbers" label=db serials="S1, S2"`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestPedanticFailedDevice checks that metrics only exported in some device
+// states, like the collect error, are described for the pedantic registry.
+func TestPedanticFailedDevice(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := filepath.Abs("testdata/HGST_HUS724020ALE640_28.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smartctl := filepath.Join(t.TempDir(), "smartctl")
+	if err := os.WriteFile(smartctl, []byte("#!/bin/sh\ncat "+fixture+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	*smartctlPath = smartctl
+	defer func() { *smartctlPath = saved }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	defer forgetDevice(device)
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(&SMARTctlManagerCollector{
+		Devices:       []Device{device},
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	})
+	if err := os.WriteFile(smartctl, []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	jsonCache.Delete(device)
+	if _, err := reg.Gather(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCapacityIgnored(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	// sda has 1 GiB, sdb 4 GiB, the capacity of sdc is unknown.
+	smartctl := writeShim(t, t.TempDir(), "smartctl", `case "$*" in
+*/dev/sda*) echo '{"smartctl":{"exit_status":0},"user_capacity":{"bytes":1073741824}}' ;;
+*/dev/sdb*) echo '{"smartctl":{"exit_status":0},"user_capacity":{"bytes":4294967296}}' ;;
+*) echo '{"smartctl":{"exit_status":0}}' ;;
+esac
+`)
+	path, minCapacity, maxCapacity := *smartctlPath, *smartctlMinCapacity, *smartctlMaxCapacity
+	defer func() { *smartctlPath, *smartctlMinCapacity, *smartctlMaxCapacity = path, minCapacity, maxCapacity }()
+	*smartctlPath = smartctl
+
+	tests := []struct {
+		minCapacity, maxCapacity units.Base2Bytes
+		ignored                  []string
+	}{
+		{0, 0, nil},
+		{2 * units.GiB, 0, []string{"sda"}},
+		{0, 2 * units.GiB, []string{"sdb"}},
+		{2 * units.GiB, 3 * units.GiB, []string{"sda", "sdb"}},
+		{units.GiB, 4 * units.GiB, nil},
+	}
+	for _, test := range tests {
+		*smartctlMinCapacity, *smartctlMaxCapacity = test.minCapacity, test.maxCapacity
+		var ignored []string
+		for _, name := range []string{"sda", "sdb", "sdc"} {
+			if capacityIgnored(log.NewNopLogger(), Device{Name: "/dev/" + name, Info_Name: name}) {
+				ignored = append(ignored, name)
+			}
+		}
+		if strings.Join(ignored, ",") != strings.Join(test.ignored, ",") {
+			t.Errorf("min %s, max %s: ignored %v, want %v", test.minCapacity, test.maxCapacity, ignored, test.ignored)
+		}
+	}
+}
+
+// TestCollectMutexWait checks that a collection waiting for another one is
+// observed with the time it waited.
+func TestCollectMutexWait(t *testing.T) {
+	collector := &SMARTctlManagerCollector{
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	}
+	waited := func() (uint64, float64) {
+		var m dto.Metric
+		if err := metricCollectMutexWait.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+	}
+	count, sum := waited()
+
+	collector.mutex.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ch := make(chan prometheus.Metric)
+		go func() {
+			collector.Collect(ch)
+			close(ch)
+		}()
+		for range ch {
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	collector.mutex.Unlock()
+	<-done
+
+	newCount, newSum := waited()
+	if newCount != count+1 {
+		t.Errorf("%d waits observed, want 1", newCount-count)
+	}
+	if newSum-sum < 0.05 {
+		t.Errorf("waited %vs, want at least 0.05s", newSum-sum)
+	}
+}
+
+func TestExporterLifecycleMetrics(t *testing.T) {
+	savedRescans, savedReloads := rescans.Load(), reloads.Load()
+	defer func() { rescans.Store(savedRescans); reloads.Store(savedReloads) }()
+	rescans.Store(3)
+	reloads.Store(2)
+	collector := &SMARTctlManagerCollector{
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	}
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(collector)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]float64{
+		"smartctl_exporter_start_time_seconds": float64(startTime),
+		"smartctl_exporter_rescans_total":      3,
+		"smartctl_exporter_reloads_total":      2,
+	} {
+		if got, ok := familyValue(families, name); !ok || got != want {
+			t.Errorf("%s = %v (%t), want %v", name, got, ok, want)
+		}
+	}
+}
+
+// TestSubprocessAndParseSeconds checks that the time smartctl runs is not
+// counted as parse time.
+func TestSubprocessAndParseSeconds(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := filepath.Abs("testdata/HGST_HUS724020ALE640_28.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	*smartctlPath = writeShim(t, t.TempDir(), "smartctl", "sleep 0.2\ncat "+fixture+"\n")
+	defer func() { *smartctlPath = saved }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	defer forgetDevice(device)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&SMARTctlManagerCollector{
+		Devices:       []Device{device},
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	})
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	subprocess, ok := familyValue(families, "smartctl_device_subprocess_seconds")
+	if !ok || subprocess < 0.2 {
+		t.Errorf("subprocess seconds %v (%t), want at least 0.2", subprocess, ok)
+	}
+	parse, ok := familyValue(families, "smartctl_device_parse_seconds")
+	if !ok || parse >= 0.2 {
+		t.Errorf("parse seconds %v (%t), want less than 0.2", parse, ok)
+	}
+}
+
+// TestWithResponseHeaders checks that the configured headers are added to
+// the responses and that invalid header names are rejected.
+func TestWithResponseHeaders(t *testing.T) {
+	handler := withResponseHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte("ok"))
+	}), map[string]string{
+		"X-Frame-Options": "DENY",
+		"Cache-Control":   "max-age=60",
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Header().Get("X-Frame-Options"); got != "DENY" {
+		t.Errorf("X-Frame-Options = %q, want DENY", got)
+	}
+	// Headers set by the handler itself take precedence.
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+	if rec.Body.String() != "ok" {
+		t.Errorf("body = %q, want ok", rec.Body.String())
+	}
+
+	for name, valid := range map[string]bool{
+		"X-Frame-Options":   true,
+		"x_custom.header~1": true,
+		"":                  false,
+		"X Frame":           false,
+		"X-Frame:":          false,
+		"X-Frame\r\nEvil":   false,
+	} {
+		if got := headerNameRe.MatchString(name); got != valid {
+			t.Errorf("headerNameRe.MatchString(%q) = %v, want %v", name, got, valid)
+		}
+	}
+}
+
+// TestDuplicateSerials checks that serial numbers reported by several
+// devices are exported and keep their devices from taking a device label.
+func TestDuplicateSerials(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	labels := *smartctlDeviceLabel
+	*smartctlDeviceLabel = map[string]string{"S1": "db", "S2": "boot"}
+	defer func() { *smartctlDeviceLabel = labels }()
+	defer collectDuplicateSerials(log.NewNopLogger(), make(chan prometheus.Metric), nil)
+
+	var buf bytes.Buffer
+	ch := make(chan prometheus.Metric, 4)
+	collectDuplicateSerials(log.NewLogfmtLogger(&buf), ch, map[Device]string{
+		{Name: "/dev/sda", Info_Name: "sda"}: "S1",
+		{Name: "/dev/sdb", Info_Name: "sdb"}: "S1",
+		{Name: "/dev/sdc", Info_Name: "sdc"}: "S2",
+		{Name: "/dev/sdd", Info_Name: "sdd"}: "",
+		{Name: "/dev/sde", Info_Name: "sde"}: "",
+	})
+	close(ch)
+	var serials []string
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		serials = append(serials, m.GetLabel()[0].GetValue())
+	}
+	if len(serials) != 1 || serials[0] != "S1" {
+		t.Errorf("duplicate serials %v, want [S1]", serials)
+	}
+	if got, want := strings.TrimSpace(buf.String()), `level=warn msg="Serial number reported by multiple devices" serial=S1 devices="sda, sdb"`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if !isDuplicateSerial("S1") || isDuplicateSerial("S2") || isDuplicateSerial("") {
+		t.Error("only S1 should be a duplicate serial")
+	}
+	if label, ok := serialDeviceLabel("S1"); ok {
+		t.Errorf("duplicate serial S1 got device label %q", label)
+	}
+	if label, ok := serialDeviceLabel("S2"); !ok || label != "boot" {
+		t.Errorf("serial S2 got device label %q, want boot", label)
+	}
+
+	// The duplicates are replaced on every collection.
+	collectDuplicateSerials(log.NewNopLogger(), make(chan prometheus.Metric), map[Device]string{
+		{Name: "/dev/sda", Info_Name: "sda"}: "S1",
+	})
+	if isDuplicateSerial("S1") {
+		t.Error("S1 still a duplicate serial after the next collection")
+	}
+}
+
+// TestCacheAge checks that the age of the cached data is exported while the
+// device is served from the cache, and dropped with the device.
+func TestCacheAge(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	*smartctlPath = writeShim(t, t.TempDir(), "smartctl", "exit 2\n")
+	defer func() { *smartctlPath = saved }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	defer forgetDevice(device)
+
+	if _, ok := cacheAge(device); ok {
+		t.Fatal("cache age of a device never read")
+	}
+	data, err := os.ReadFile("testdata/HGST_HUS724020ALE640_28.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonCache.Store(device, JSONCache{JSON: parseJSON(string(data)), LastCollect: time.Now().Add(-30 * time.Second)})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&SMARTctlManagerCollector{
+		Devices:       []Device{device},
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	})
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age, ok := familyValue(families, "smartctl_device_cache_age_seconds"); !ok || age < 30 || age > 35 {
+		t.Errorf("cache age %v (%t), want about 30s", age, ok)
+	}
+
+	forgetDevice(device)
+	if _, ok := cacheAge(device); ok {
+		t.Error("cache age of a forgotten device")
+	}
+}
+
+// TestReadDevicesConcurrency checks that at most concurrency smartctl
+// processes run at a time and the results keep the order of the devices.
+func TestReadDevicesConcurrency(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	running, counts := filepath.Join(dir, "running"), filepath.Join(dir, "counts")
+	if err := os.Mkdir(running, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	*smartctlPath = writeShim(t, dir, "smartctl", `for arg; do case $arg in /dev/*) device=$arg;; esac; done
+touch `+running+`/$$
+ls `+running+` | wc -l >> `+counts+`
+sleep 0.2
+rm `+running+`/$$
+echo "{\"smartctl\":{\"exit_status\":0},\"device\":{\"name\":\"$device\"}}"
+`)
+	defer func() { *smartctlPath = saved }()
+	devices := []Device{}
+	for _, name := range []string{"sda", "sdb", "sdc", "sdd", "sde"} {
+		device := Device{Name: "/dev/" + name, Info_Name: name}
+		defer forgetDevice(device)
+		devices = append(devices, device)
+	}
+
+	results := readDevices(log.NewNopLogger(), devices, 2)
+	for idx, device := range devices {
+		if got := results[idx].Get("device.name").String(); got != device.Name {
+			t.Errorf("result %d is of %q, want %q", idx, got, device.Name)
+		}
+	}
+	out, err := os.ReadFile(counts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, count := range strings.Fields(string(out)) {
+		if count != "1" && count != "2" {
+			t.Errorf("%s smartctl processes running at a time, want at most 2", count)
+		}
+	}
+}
+
+// TestDeviceUpAndCollectErrors checks the up state of the devices and that
+// failed collections are counted, except for sleeping drives.
+func TestDeviceUpAndCollectErrors(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := filepath.Abs("testdata/HGST_HUS724020ALE640_28.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	*smartctlPath = writeShim(t, t.TempDir(), "smartctl", `for arg; do case $arg in /dev/*) device=$arg;; esac; done
+case $device in
+/dev/sda) cat `+fixture+`;;
+/dev/sdc) echo '{"smartctl":{"exit_status":2,"messages":[{"string":"Device is in STANDBY mode, exit(2)","severity":"information"}]}}'; exit 2;;
+*) exit 2;;
+esac
+`)
+	defer func() { *smartctlPath = saved }()
+	devices := []Device{}
+	for _, name := range []string{"sda", "sdb", "sdc"} {
+		device := Device{Name: "/dev/" + name, Info_Name: name}
+		defer forgetDevice(device)
+		devices = append(devices, device)
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&SMARTctlManagerCollector{
+		Devices:       devices,
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	})
+	// Registering collects once to describe the metrics, so this is the
+	// second collection.
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			for _, label := range m.Label {
+				if label.GetName() == "device" {
+					values[family.GetName()+"{"+label.GetValue()+"}"] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	for key, want := range map[string]float64{
+		"smartctl_device_up{sda}":                   1,
+		"smartctl_device_up{sdb}":                   0,
+		"smartctl_device_up{sdc}":                   0,
+		"smartctl_device_collect_errors_total{sda}": 0,
+		"smartctl_device_collect_errors_total{sdb}": 2,
+		"smartctl_device_collect_errors_total{sdc}": 0,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s = %v (%t), want %v", key, got, ok, want)
+		}
+	}
+}
+
+// TestLastCollectTimestamp checks that the time of the last successful read
+// is exported and kept while the device fails to be read.
+func TestLastCollectTimestamp(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	*smartctlPath = writeShim(t, t.TempDir(), "smartctl", "exit 2\n")
+	defer func() { *smartctlPath = saved }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	defer forgetDevice(device)
+
+	collect := func() (float64, bool) {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(&SMARTctlManagerCollector{
+			Devices:       []Device{device},
+			SuccessRatios: newSuccessRatios(),
+			logger:        log.NewNopLogger(),
+			collections:   map[string]uint64{},
+			failures:      map[string]uint64{},
+		})
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return familyValue(families, "smartctl_device_last_collect_timestamp_seconds")
+	}
+	if _, ok := collect(); ok {
+		t.Error("last collect timestamp of a device never read")
+	}
+
+	// The cached read is older than the interval, so the failing smartctl
+	// runs again.
+	read := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	jsonCache.Store(device, JSONCache{JSON: parseJSON(`{"smartctl":{"exit_status":0}}`), LastCollect: read})
+	if got, ok := collect(); !ok || got != float64(read.Unix()) {
+		t.Errorf("last collect timestamp %v (%t), want %d", got, ok, read.Unix())
+	}
+	if collectErr, ok := lastCollectError(device); !ok || collectErr.Reason != CollectReasonFailed {
+		t.Errorf("collect error %v, want the device read again and failed", collectErr)
+	}
+}
+
+// TestServeDevices checks that /devices lists the collected devices, also
+// after they were replaced.
+func TestServeDevices(t *testing.T) {
+	collector := &SMARTctlManagerCollector{logger: log.NewNopLogger()}
+	devices := func() string {
+		w := httptest.NewRecorder()
+		collector.ServeDevices(w, httptest.NewRequest(http.MethodGet, "/devices", nil))
+		if got := w.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("content type %q, want application/json", got)
+		}
+		return strings.TrimSpace(w.Body.String())
+	}
+	if got := devices(); got != "[]" {
+		t.Errorf("devices %s, want []", got)
+	}
+
+	collector.mutex.Lock()
+	collector.setDevices([]Device{{Name: "/dev/bus/0", Info_Name: "bus_0_megaraid_disk_12", Type: "megaraid,12", TypeSource: TypeSourceScan}})
+	collector.mutex.Unlock()
+	want := `[{"name":"/dev/bus/0","info_name":"bus_0_megaraid_disk_12","type":"megaraid,12","type_source":"scan","target":"","label":"","extra_args":"","alias":""}]`
+	if got := devices(); got != want {
+		t.Errorf("devices %s, want %s", got, want)
+	}
+}
+
+func TestDisableExporterMetrics(t *testing.T) {
+	for _, exporterMetrics := range []bool{true, false} {
+		families, err := newRegistry(exporterMetrics).Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, family := range families {
+			if family.GetName() == "go_goroutines" {
+				found = true
+			}
+		}
+		if found != exporterMetrics {
+			t.Errorf("exporter metrics %t: go_goroutines exported %t", exporterMetrics, found)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+)
+
+// TestMaintenanceRunsNoCommands collects devices of every kind in
+// maintenance mode, with all external tools replaced by a script leaving a
+// marker file.
+func TestMaintenanceRunsNoCommands(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	tool := filepath.Join(dir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\ntouch "+marker+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	*maintenanceFile = filepath.Join(dir, "maintenance")
+	if err := os.WriteFile(*maintenanceFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := []string{*smartctlPath, *nvmePath, *storcliPath, *ccissVolStatusPath, *zpoolPath}
+	*smartctlPath, *nvmePath, *storcliPath, *ccissVolStatusPath, *zpoolPath = tool, tool, tool, tool, tool
+	fields, err := parseLogPageFields(map[string]string{"wear": "0xc0:32:2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logPageFields = fields
+	defer func() {
+		*maintenanceFile = ""
+		*smartctlPath, *nvmePath, *storcliPath, *ccissVolStatusPath, *zpoolPath = saved[0], saved[1], saved[2], saved[3], saved[4]
+		logPageFields = nil
+	}()
+
+	devices := []Device{
+		{Name: "/dev/sda", Info_Name: "sda", Type: "sat"},
+		{Name: "/dev/nvme0", Info_Name: "nvme0", Type: "nvme"},
+		{Name: "/dev/bus/0", Info_Name: "bus_0_megaraid_5", Type: "megaraid,5"},
+		{Name: "/dev/sg0", Info_Name: "sg0_cciss_0", Type: "cciss,0"},
+	}
+	for idx, fixture := range []string{"HGST_HUS724020ALE640_28.json", "nvme-null-CT250P2SSD8-nvme0.json"} {
+		data, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		jsonCache.Store(devices[idx], JSONCache{JSON: parseJSON(string(data))})
+	}
+	defer func() {
+		for _, device := range devices {
+			forgetDevice(device)
+		}
+	}()
+
+	if _, err := gatherDevices(devices); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("command run in maintenance mode")
+	}
+}
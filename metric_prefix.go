@@ -0,0 +1,63 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// defaultMetricPrefix is the prefix the metric descriptors are declared with.
+const defaultMetricPrefix = "smartctl"
+
+var metricPrefixRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validMetricPrefix returns whether prefix can start a metric name.
+func validMetricPrefix(prefix string) bool {
+	return metricPrefixRe.MatchString(prefix)
+}
+
+// prefixGatherer replaces the smartctl prefix of the gathered metric names,
+// other metrics such as the Go runtime ones are left alone.
+type prefixGatherer struct {
+	gatherer prometheus.Gatherer
+	prefix   string
+}
+
+// withMetricPrefix returns gatherer renaming the metrics to prefix, or
+// gatherer itself for the default prefix.
+func withMetricPrefix(gatherer prometheus.Gatherer, prefix string) prometheus.Gatherer {
+	if prefix == "" || prefix == defaultMetricPrefix {
+		return gatherer
+	}
+	return prefixGatherer{gatherer: gatherer, prefix: prefix}
+}
+
+func (g prefixGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	for _, family := range families {
+		if name, ok := strings.CutPrefix(family.GetName(), defaultMetricPrefix+"_"); ok {
+			renamed := prometheus.BuildFQName(g.prefix, "", name)
+			family.Name = &renamed
+		}
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+	return families, err
+}
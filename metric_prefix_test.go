@@ -0,0 +1,59 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+func TestMetricPrefix(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector())
+	reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "smartctl_devices",
+		Help: "Number of devices",
+	}, func() float64 { return 2 }))
+
+	families, err := withMetricPrefix(reg, "disk").Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	if !names["disk_devices"] || names["smartctl_devices"] {
+		t.Errorf("smartctl_devices not renamed to disk_devices")
+	}
+	if !names["go_goroutines"] {
+		t.Errorf("go_goroutines renamed")
+	}
+
+	for prefix, valid := range map[string]bool{
+		"smartctl":  true,
+		"node_disk": true,
+		"_x":        true,
+		"":          false,
+		"9disk":     false,
+		"disk-io":   false,
+		"disk:io":   false,
+	} {
+		if validMetricPrefix(prefix) != valid {
+			t.Errorf("validMetricPrefix(%q) = %v, want %v", prefix, !valid, valid)
+		}
+	}
+}
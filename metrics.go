@@ -18,9 +18,9 @@ import (
 )
 
 var (
-	metricSmartctlVersion = prometheus.NewDesc(
+	metricSmartctlVersion = newDesc(
 		"smartctl_version",
-		"smartctl version",
+		"smartctl version, of the device output or else of smartctl --version",
 		[]string{
 			"json_format_version",
 			"smartctl_version",
@@ -29,7 +29,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceModel = prometheus.NewDesc(
+	metricDeviceModel = newDesc(
 		"smartctl_device",
 		"Device info",
 		[]string{
@@ -49,16 +49,19 @@ var (
 			"scsi_product",
 			"scsi_revision",
 			"scsi_version",
+			"enclosure",
+			"slot",
+			"virtual",
 		},
 		nil,
 	)
-	metricDeviceCount = prometheus.NewDesc(
+	metricDeviceCount = newDesc(
 		"smartctl_devices",
 		"Number of devices configured or dynamically discovered",
 		[]string{},
 		nil,
 	)
-	metricDeviceCapacityBlocks = prometheus.NewDesc(
+	metricDeviceCapacityBlocks = newDesc(
 		"smartctl_device_capacity_blocks",
 		"Device capacity in blocks",
 		[]string{
@@ -66,7 +69,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceCapacityBytes = prometheus.NewDesc(
+	metricDeviceCapacityBytes = newDesc(
 		"smartctl_device_capacity_bytes",
 		"Device capacity in bytes",
 		[]string{
@@ -74,7 +77,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceTotalCapacityBytes = prometheus.NewDesc(
+	metricDeviceTotalCapacityBytes = newDesc(
 		"smartctl_device_nvme_capacity_bytes",
 		"NVMe device total capacity bytes",
 		[]string{
@@ -82,7 +85,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceBlockSize = prometheus.NewDesc(
+	metricDeviceBlockSize = newDesc(
 		"smartctl_device_block_size",
 		"Device block size",
 		[]string{
@@ -91,7 +94,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceInterfaceSpeed = prometheus.NewDesc(
+	metricDeviceInterfaceSpeed = newDesc(
 		"smartctl_device_interface_speed",
 		"Device interface speed, bits per second",
 		[]string{
@@ -100,7 +103,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceAttribute = prometheus.NewDesc(
+	metricDeviceAttribute = newDesc(
 		"smartctl_device_attribute",
 		"Device attributes",
 		[]string{
@@ -113,7 +116,23 @@ var (
 		},
 		nil,
 	)
-	metricDevicePowerOnSeconds = prometheus.NewDesc(
+	metricDeviceAttributeFlags = newDesc(
+		"smartctl_device_attribute_flags",
+		"Flags of the device attribute",
+		[]string{
+			"device",
+			"attribute_name",
+			"attribute_id",
+			"prefailure",
+			"updated_online",
+			"performance",
+			"error_rate",
+			"event_count",
+			"auto_keep",
+		},
+		nil,
+	)
+	metricDevicePowerOnSeconds = newDesc(
 		"smartctl_device_power_on_seconds",
 		"Device power on seconds",
 		[]string{
@@ -121,15 +140,15 @@ var (
 		},
 		nil,
 	)
-	metricDeviceRotationRate = prometheus.NewDesc(
+	metricDeviceRotationRate = newDesc(
 		"smartctl_device_rotation_rate",
-		"Device rotation rate",
+		"Device rotation rate in RPM, 0 for solid-state drives",
 		[]string{
 			"device",
 		},
 		nil,
 	)
-	metricDeviceTemperature = prometheus.NewDesc(
+	metricDeviceTemperature = newDesc(
 		"smartctl_device_temperature",
 		"Device temperature celsius",
 		[]string{
@@ -138,7 +157,34 @@ var (
 		},
 		nil,
 	)
-	metricDevicePowerCycleCount = prometheus.NewDesc(
+	metricDeviceTemperatureFahrenheit = newDesc(
+		"smartctl_device_temperature_fahrenheit",
+		"Device temperature fahrenheit",
+		[]string{
+			"device",
+			"temperature_type",
+		},
+		nil,
+	)
+	metricDeviceTemperatureSensor = newDesc(
+		"smartctl_device_temperature_sensor_celsius",
+		"Temperature of the NVMe temperature sensor, besides the composite temperature",
+		[]string{
+			"device",
+			"sensor",
+		},
+		nil,
+	)
+	metricDeviceTemperatureSensorFahrenheit = newDesc(
+		"smartctl_device_temperature_sensor_fahrenheit",
+		"Temperature of the NVMe temperature sensor, besides the composite temperature",
+		[]string{
+			"device",
+			"sensor",
+		},
+		nil,
+	)
+	metricDevicePowerCycleCount = newDesc(
 		"smartctl_device_power_cycle_count",
 		"Device power cycle count",
 		[]string{
@@ -146,15 +192,15 @@ var (
 		},
 		nil,
 	)
-	metricDevicePercentageUsed = prometheus.NewDesc(
+	metricDevicePercentageUsed = newDesc(
 		"smartctl_device_percentage_used",
-		"Device write percentage used",
+		"Percentage of the SSD endurance used, from the NVMe log, the SCSI endurance indicator, the ATA device statistics or the vendor wear attribute",
 		[]string{
 			"device",
 		},
 		nil,
 	)
-	metricDeviceAvailableSpare = prometheus.NewDesc(
+	metricDeviceAvailableSpare = newDesc(
 		"smartctl_device_available_spare",
 		"Normalized percentage (0 to 100%) of the remaining spare capacity available",
 		[]string{
@@ -162,7 +208,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceAvailableSpareThreshold = prometheus.NewDesc(
+	metricDeviceAvailableSpareThreshold = newDesc(
 		"smartctl_device_available_spare_threshold",
 		"When the Available Spare falls below the threshold indicated in this field, an asynchronous event completion may occur. The value is indicated as a normalized percentage (0 to 100%)",
 		[]string{
@@ -170,7 +216,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceCriticalWarning = prometheus.NewDesc(
+	metricDeviceCriticalWarning = newDesc(
 		"smartctl_device_critical_warning",
 		"This field indicates critical warnings for the state of the controller",
 		[]string{
@@ -178,7 +224,16 @@ var (
 		},
 		nil,
 	)
-	metricDeviceMediaErrors = prometheus.NewDesc(
+	metricDeviceCriticalWarningBit = newDesc(
+		"smartctl_device_critical_warning_bit",
+		"Whether the given bit of the NVMe critical warning field is set",
+		[]string{
+			"device",
+			"bit",
+		},
+		nil,
+	)
+	metricDeviceMediaErrors = newDesc(
 		"smartctl_device_media_errors",
 		"Contains the number of occurrences where the controller detected an unrecovered data integrity error. Errors such as uncorrectable ECC, CRC checksum failure, or LBA tag mismatch are included in this field",
 		[]string{
@@ -186,7 +241,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceNumErrLogEntries = prometheus.NewDesc(
+	metricDeviceNumErrLogEntries = newDesc(
 		"smartctl_device_num_err_log_entries",
 		"Contains the number of Error Information log entries over the life of the controller",
 		[]string{
@@ -194,23 +249,47 @@ var (
 		},
 		nil,
 	)
-	metricDeviceBytesRead = prometheus.NewDesc(
+	metricDeviceHostReadCommands = newDesc(
+		"smartctl_device_host_read_commands",
+		"Number of read commands completed by the NVMe controller",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceHostWriteCommands = newDesc(
+		"smartctl_device_host_write_commands",
+		"Number of write commands completed by the NVMe controller",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceControllerBusyTime = newDesc(
+		"smartctl_device_controller_busy_time_seconds",
+		"Time the NVMe controller was busy with I/O commands",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceBytesRead = newDesc(
 		"smartctl_device_bytes_read",
-		"",
+		"Bytes read from the device, NVMe data units are scaled by 512000 and ATA sectors by the logical block size",
 		[]string{
 			"device",
 		},
 		nil,
 	)
-	metricDeviceBytesWritten = prometheus.NewDesc(
+	metricDeviceBytesWritten = newDesc(
 		"smartctl_device_bytes_written",
-		"",
+		"Bytes written to the device, NVMe data units are scaled by 512000 and ATA sectors by the logical block size",
 		[]string{
 			"device",
 		},
 		nil,
 	)
-	metricDeviceSmartStatus = prometheus.NewDesc(
+	metricDeviceSmartStatus = newDesc(
 		"smartctl_device_smart_status",
 		"General smart status",
 		[]string{
@@ -218,7 +297,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceExitStatus = prometheus.NewDesc(
+	metricDeviceExitStatus = newDesc(
 		"smartctl_device_smartctl_exit_status",
 		"Exit status of smartctl on device",
 		[]string{
@@ -226,7 +305,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceState = prometheus.NewDesc(
+	metricDeviceState = newDesc(
 		"smartctl_device_state",
 		"Device state (0=active, 1=standby, 2=sleep, 3=dst, 4=offline, 5=sct)",
 		[]string{
@@ -234,7 +313,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceStatistics = prometheus.NewDesc(
+	metricDeviceStatistics = newDesc(
 		"smartctl_device_statistics",
 		"Device statistics",
 		[]string{
@@ -246,7 +325,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceErrorLogCount = prometheus.NewDesc(
+	metricDeviceErrorLogCount = newDesc(
 		"smartctl_device_error_log_count",
 		"Device SMART error log count",
 		[]string{
@@ -255,7 +334,15 @@ var (
 		},
 		nil,
 	)
-	metricDeviceSelfTestLogCount = prometheus.NewDesc(
+	metricDeviceATAErrorLogCount = newDesc(
+		"smartctl_device_ata_error_log_count",
+		"Number of errors in the ATA SMART error log, from the summary log or else the extended log",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceSelfTestLogCount = newDesc(
 		"smartctl_device_self_test_log_count",
 		"Device SMART self test log count",
 		[]string{
@@ -264,7 +351,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceSelfTestLogErrorCount = prometheus.NewDesc(
+	metricDeviceSelfTestLogErrorCount = newDesc(
 		"smartctl_device_self_test_log_error_count",
 		"Device SMART self test log error count",
 		[]string{
@@ -273,7 +360,7 @@ var (
 		},
 		nil,
 	)
-	metricDeviceERCSeconds = prometheus.NewDesc(
+	metricDeviceERCSeconds = newDesc(
 		"smartctl_device_erc_seconds",
 		"Device SMART Error Recovery Control Seconds",
 		[]string{
@@ -282,7 +369,7 @@ var (
 		},
 		nil,
 	)
-	metricSCSIGrownDefectList = prometheus.NewDesc(
+	metricSCSIGrownDefectList = newDesc(
 		"smartctl_scsi_grown_defect_list",
 		"Device SCSI grown defect list counter",
 		[]string{
@@ -290,7 +377,25 @@ var (
 		},
 		nil,
 	)
-	metricReadErrorsCorrectedByRereadsRewrites = prometheus.NewDesc(
+	metricSCSIErrorsCorrectedTotal = newDesc(
+		"smartctl_device_scsi_total_errors_corrected_total",
+		"Total errors corrected, per SCSI error counter log operation",
+		[]string{
+			"device",
+			"operation",
+		},
+		nil,
+	)
+	metricSCSICorrectionAlgorithmInvocations = newDesc(
+		"smartctl_device_scsi_correction_algorithm_invocations_total",
+		"Correction algorithm invocations, per SCSI error counter log operation",
+		[]string{
+			"device",
+			"operation",
+		},
+		nil,
+	)
+	metricReadErrorsCorrectedByRereadsRewrites = newDesc(
 		"smartctl_read_errors_corrected_by_rereads_rewrites",
 		"Read Errors Corrected by ReReads/ReWrites",
 		[]string{
@@ -298,7 +403,7 @@ var (
 		},
 		nil,
 	)
-	metricReadErrorsCorrectedByEccFast = prometheus.NewDesc(
+	metricReadErrorsCorrectedByEccFast = newDesc(
 		"smartctl_read_errors_corrected_by_eccfast",
 		"Read Errors Corrected by ECC Fast",
 		[]string{
@@ -306,7 +411,7 @@ var (
 		},
 		nil,
 	)
-	metricReadErrorsCorrectedByEccDelayed = prometheus.NewDesc(
+	metricReadErrorsCorrectedByEccDelayed = newDesc(
 		"smartctl_read_errors_corrected_by_eccdelayed",
 		"Read Errors Corrected by ECC Delayed",
 		[]string{
@@ -314,7 +419,7 @@ var (
 		},
 		nil,
 	)
-	metricReadTotalUncorrectedErrors = prometheus.NewDesc(
+	metricReadTotalUncorrectedErrors = newDesc(
 		"smartctl_read_total_uncorrected_errors",
 		"Read Total Uncorrected Errors",
 		[]string{
@@ -322,7 +427,7 @@ var (
 		},
 		nil,
 	)
-	metricWriteErrorsCorrectedByRereadsRewrites = prometheus.NewDesc(
+	metricWriteErrorsCorrectedByRereadsRewrites = newDesc(
 		"smartctl_write_errors_corrected_by_rereads_rewrites",
 		"Write Errors Corrected by ReReads/ReWrites",
 		[]string{
@@ -330,7 +435,7 @@ var (
 		},
 		nil,
 	)
-	metricWriteErrorsCorrectedByEccFast = prometheus.NewDesc(
+	metricWriteErrorsCorrectedByEccFast = newDesc(
 		"smartctl_write_errors_corrected_by_eccfast",
 		"Write Errors Corrected by ECC Fast",
 		[]string{
@@ -338,7 +443,7 @@ var (
 		},
 		nil,
 	)
-	metricWriteErrorsCorrectedByEccDelayed = prometheus.NewDesc(
+	metricWriteErrorsCorrectedByEccDelayed = newDesc(
 		"smartctl_write_errors_corrected_by_eccdelayed",
 		"Write Errors Corrected by ECC Delayed",
 		[]string{
@@ -346,7 +451,7 @@ var (
 		},
 		nil,
 	)
-	metricWriteTotalUncorrectedErrors = prometheus.NewDesc(
+	metricWriteTotalUncorrectedErrors = newDesc(
 		"smartctl_write_total_uncorrected_errors",
 		"Write Total Uncorrected Errors",
 		[]string{
@@ -354,4 +459,560 @@ var (
 		},
 		nil,
 	)
+	metricVerifyErrorsCorrectedByRereadsRewrites = newDesc(
+		"smartctl_verify_errors_corrected_by_rereads_rewrites",
+		"Verify Errors Corrected by ReReads/ReWrites",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricVerifyErrorsCorrectedByEccFast = newDesc(
+		"smartctl_verify_errors_corrected_by_eccfast",
+		"Verify Errors Corrected by ECC Fast",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricVerifyErrorsCorrectedByEccDelayed = newDesc(
+		"smartctl_verify_errors_corrected_by_eccdelayed",
+		"Verify Errors Corrected by ECC Delayed",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricVerifyTotalUncorrectedErrors = newDesc(
+		"smartctl_verify_total_uncorrected_errors",
+		"Verify Total Uncorrected Errors",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceCycleWearRatio = newDesc(
+		"smartctl_device_cycle_wear_ratio",
+		"Ratio of the accumulated start-stop or load-unload cycles to the cycles specified over the device lifetime",
+		[]string{
+			"device",
+			"cycle_type",
+		},
+		nil,
+	)
+	metricDeviceSchemaFieldsMissing = newDesc(
+		"smartctl_device_schema_fields_missing",
+		"Expected smartctl JSON field is missing from the device output",
+		[]string{
+			"device",
+			"field",
+		},
+		nil,
+	)
+	metricProbeDeviceSuccess = newDesc(
+		"smartctl_probe_device_success",
+		"Whether the probed device was collected successfully",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricRAIDBBUState = newDesc(
+		"smartctl_raid_bbu_state",
+		"RAID controller battery backup unit state (1=optimal, 0=otherwise)",
+		[]string{
+			"controller",
+			"state",
+		},
+		nil,
+	)
+	metricRAIDCachePresent = newDesc(
+		"smartctl_raid_cache_present",
+		"Whether the RAID controller has a cache module",
+		[]string{
+			"controller",
+		},
+		nil,
+	)
+	metricCcissVolumeStatus = newDesc(
+		"smartctl_cciss_volume_status",
+		"Status of a logical volume reported by cciss_vol_status (1=OK, 0=otherwise)",
+		[]string{
+			"controller",
+			"volume",
+			"raid_level",
+			"status",
+		},
+		nil,
+	)
+	metricCcissPhysicalDrives = newDesc(
+		"smartctl_cciss_physical_drives",
+		"Number of physical drives reported by cciss_vol_status",
+		[]string{
+			"controller",
+		},
+		nil,
+	)
+	metricDeviceAttributeCount = newDesc(
+		"smartctl_device_attribute_count",
+		"Number of SMART attributes reported by the device",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceTemperatureDelta = newDesc(
+		"smartctl_device_temperature_delta_celsius",
+		"Difference between the device temperature and the ambient temperature",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceCollectionSuccessRatio = newDesc(
+		"smartctl_device_collection_success_ratio",
+		"Ratio of successful collections over the last smartctl.success-window attempts to run smartctl, outputs served from the cache are not counted",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceNumber = newDesc(
+		"smartctl_device_number",
+		"Kernel major and minor number of the block device, for joins with node_exporter disk metrics",
+		[]string{
+			"device",
+			"major",
+			"minor",
+		},
+		nil,
+	)
+	metricDeviceSelfTestLastStatus = newDesc(
+		"smartctl_device_self_test_last_status",
+		"Status of the most recent self-test in the device self-test log",
+		[]string{
+			"device",
+			"type",
+			"status",
+		},
+		nil,
+	)
+	metricDeviceSelfTestLastHours = newDesc(
+		"smartctl_device_self_test_last_hours",
+		"Power-on hours at which the most recent self-test in the device self-test log ran",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceSelfTestErrors = newDesc(
+		"smartctl_device_self_test_errors",
+		"Number of failed self-tests in the device self-test log",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceSelfTestInProgress = newDesc(
+		"smartctl_device_self_test_in_progress",
+		"Whether a self-test is running on the device",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceSelfTestRemainingPercent = newDesc(
+		"smartctl_device_self_test_remaining_percent",
+		"Percentage of the running self-test remaining",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricSubprocessTotal = newDesc(
+		"smartctl_subprocess_total",
+		"Total number of smartctl invocations to read device data",
+		[]string{},
+		nil,
+	)
+	metricSubprocessFailuresTotal = newDesc(
+		"smartctl_subprocess_failures_total",
+		"Total number of failed smartctl invocations to read device data",
+		[]string{},
+		nil,
+	)
+	metricDeviceATASecuritySupported = newDesc(
+		"smartctl_device_ata_security_supported",
+		"Whether the device supports the ATA security feature set, which is no self-encrypting drive capability",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceATASecurityLocked = newDesc(
+		"smartctl_device_ata_security_locked",
+		"Whether the device is locked by the ATA security feature set",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceHealthScore = newDesc(
+		"smartctl_device_health_score",
+		"Heuristic device health score from 0 (bad) to 100 (good)",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceCapacityInfo = newDesc(
+		"smartctl_device_capacity_info",
+		"Device capacity in human readable decimal (as marketed) and binary units",
+		[]string{
+			"device",
+			"capacity_decimal",
+			"capacity_binary",
+		},
+		nil,
+	)
+	metricDeviceSelfTestsTriggered = newDesc(
+		"smartctl_device_self_tests_triggered_total",
+		"Total number of self-tests started by the exporter",
+		[]string{
+			"device",
+			"self_test_type",
+		},
+		nil,
+	)
+	metricDeviceSelfTestLastTriggered = newDesc(
+		"smartctl_device_self_test_last_triggered_timestamp_seconds",
+		"Time the exporter last started a self-test",
+		[]string{
+			"device",
+			"self_test_type",
+		},
+		nil,
+	)
+	metricDeviceAttributeOverUserThreshold = newDesc(
+		"smartctl_device_attribute_over_user_threshold",
+		"Whether the attribute exceeds the threshold given by smartctl.attribute-threshold",
+		[]string{
+			"device",
+			"attribute_name",
+			"attribute_id",
+		},
+		nil,
+	)
+	metricDeviceTypeSource = newDesc(
+		"smartctl_device_type_source",
+		"Where the smartctl device type comes from: scan, sat (scan with -d sat), config (config.file), flag (smartctl.device), fake-json (smartctl.fake-json-dir), probe or alias (expanded device type alias)",
+		[]string{
+			"device",
+			"type",
+			"source",
+		},
+		nil,
+	)
+	metricDeviceLVMInfo = newDesc(
+		"smartctl_device_lvm_info",
+		"LVM logical volume using the device or one of its partitions",
+		[]string{
+			"device",
+			"lvm_vg",
+			"lvm_lv",
+		},
+		nil,
+	)
+	metricDeviceCollectionsTotal = newDesc(
+		"smartctl_device_collections_total",
+		"Number of successful reads of the device, outputs served from the cache are not counted",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceLocked = newDesc(
+		"smartctl_device_locked",
+		"Whether the device rejected reading the S.M.A.R.T. data because it is locked",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricLastScanTimestamp = newDesc(
+		"smartctl_last_scan_timestamp_seconds",
+		"Unix time of the last successful device scan",
+		[]string{},
+		nil,
+	)
+	metricDeviceSubprocessSeconds = newDesc(
+		"smartctl_device_subprocess_seconds",
+		"Duration of the last smartctl run reading the device",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceParseSeconds = newDesc(
+		"smartctl_device_parse_seconds",
+		"Duration of extracting the metrics from the smartctl JSON output of the device",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceLogPageValue = newDesc(
+		"smartctl_device_log_page_value",
+		"Value of a field read from a log page, as configured by smartctl.log-page-field",
+		[]string{
+			"device",
+			"log_page",
+			"name",
+		},
+		nil,
+	)
+	metricExporterStartTime = newDesc(
+		"smartctl_exporter_start_time_seconds",
+		"Unix time the exporter was started",
+		[]string{},
+		nil,
+	)
+	metricRescansTotal = newDesc(
+		"smartctl_exporter_rescans_total",
+		"Number of completed background device rescans",
+		[]string{},
+		nil,
+	)
+	metricDeviceOCPSMARTLog = newDesc(
+		"smartctl_device_ocp_smart_log",
+		"Field of the OCP SMART / Health Information Extended log of NVMe devices, read with nvme-cli",
+		[]string{
+			"device",
+			"field",
+		},
+		nil,
+	)
+	metricParserFieldPresent = newDesc(
+		"smartctl_parser_field_present",
+		"Whether the smartctl JSON output of the device has the field metrics are read from",
+		[]string{
+			"device",
+			"field",
+		},
+		nil,
+	)
+	metricDeviceJSONFormatVersion = newDesc(
+		"smartctl_device_json_format_version",
+		"JSON format and smartctl version of the output the device was read from",
+		[]string{
+			"device",
+			"json_version",
+			"smartctl_version",
+		},
+		nil,
+	)
+	metricDeviceInDegradedArray = newDesc(
+		"smartctl_device_in_degraded_array",
+		"Whether the device belongs to a degraded RAID array, as reported by storcli, mdstat or zpool",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricMaintenanceMode = newDesc(
+		"smartctl_exporter_maintenance_mode",
+		"Whether the exporter is in maintenance mode and exports the last read values",
+		[]string{},
+		nil,
+	)
+	metricDuplicateSerial = newDesc(
+		"smartctl_duplicate_serial",
+		"Serial number reported by more than one device",
+		[]string{
+			"serial",
+		},
+		nil,
+	)
+	metricDevicePermissionDenied = newDesc(
+		"smartctl_device_permission_denied",
+		"Whether reading the device failed because of missing privileges",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceCacheAgeSeconds = newDesc(
+		"smartctl_device_cache_age_seconds",
+		"Time since the exported data of the device was read, it is cached for smartctl.interval",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceCollectError = newDesc(
+		"smartctl_device_collect_error",
+		"Reason the device could not be read: failed, locked, permission_denied, timeout or standby",
+		[]string{
+			"device",
+			"reason",
+		},
+		nil,
+	)
+	metricDeviceUp = newDesc(
+		"smartctl_device_up",
+		"Whether smartctl returned usable data for the device",
+		[]string{
+			"device",
+			"type",
+		},
+		nil,
+	)
+	metricDeviceCollectErrorsTotal = newDesc(
+		"smartctl_device_collect_errors_total",
+		"Number of failed collections of the device",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricReloadsTotal = newDesc(
+		"smartctl_exporter_reloads_total",
+		"Number of completed reloads of the config file and devices on SIGHUP",
+		[]string{},
+		nil,
+	)
+	metricDevicePowerMode = newDesc(
+		"smartctl_device_power_mode",
+		"Low-power mode the device was skipped in, see smartctl.nocheck",
+		[]string{
+			"device",
+			"mode",
+		},
+		nil,
+	)
+	metricDeviceInfo = newDesc(
+		"smartctl_device_info",
+		"Identity of the device",
+		[]string{
+			"device",
+			"type",
+			"model_family",
+			"model_name",
+			"serial_number",
+			"firmware_version",
+			"wwn",
+		},
+		nil,
+	)
+	metricSmartctlBinaryAvailable = newDesc(
+		"smartctl_binary_available",
+		"Whether the last local smartctl run could start the smartctl binary or helper",
+		nil,
+		nil,
+	)
+	metricScansTotal = newDesc(
+		"smartctl_scan_total",
+		"Number of device scans, at startup, on rescans and on reloads",
+		nil,
+		nil,
+	)
+	metricScanDuration = newDesc(
+		"smartctl_scan_duration_seconds",
+		"Duration of the last device scan",
+		nil,
+		nil,
+	)
+	metricScanDevicesFound = newDesc(
+		"smartctl_scan_devices_found",
+		"Number of devices found by the last device scan, after filtering",
+		nil,
+		nil,
+	)
+	metricDeviceLastCollectTimestamp = newDesc(
+		"smartctl_device_last_collect_timestamp_seconds",
+		"Unix time the device data was last read successfully",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceReallocatedSectors = newDesc(
+		"smartctl_device_reallocated_sectors",
+		"Reallocated sectors, from ATA attribute 5 or the SCSI grown defect list",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDevicePendingSectors = newDesc(
+		"smartctl_device_pending_sectors",
+		"Sectors pending reallocation, from ATA attribute 197",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceUncorrectableSectors = newDesc(
+		"smartctl_device_uncorrectable_sectors",
+		"Uncorrectable sectors or errors, from ATA attribute 198, SCSI uncorrected errors or NVMe media errors",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceSATAPhyEvent = newDesc(
+		"smartctl_device_sata_phy_event",
+		"SATA PHY event counter, e.g. CRC errors and PHY resets pointing at cabling or backplane problems",
+		[]string{
+			"device",
+			"id",
+			"name",
+		},
+		nil,
+	)
+	metricDeviceExitStatusBit = newDesc(
+		"smartctl_device_smartctl_exit_status_bit",
+		"Whether the given bit of the smartctl exit status is set, e.g. disk_failing when the SMART status check failed",
+		[]string{
+			"device",
+			"bit",
+		},
+		nil,
+	)
+	metricDeviceCollectRetries = newDesc(
+		"smartctl_device_collect_retries_total",
+		"Number of failed smartctl runs retried for the device, see smartctl.retries",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+	metricDeviceAvailableSparePercent = newDesc(
+		"smartctl_device_available_spare_percent",
+		"Percentage of the SSD spare capacity available, from the vendor reserved space attribute of ATA devices. NVMe devices report it in smartctl_device_available_spare",
+		[]string{
+			"device",
+		},
+		nil,
+	)
+)
+
+// metricCollectMutexWait is observed directly rather than built from a Desc,
+// as the histogram accumulates across scrapes.
+var metricCollectMutexWait = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    "smartctl_collect_mutex_wait_seconds",
+		Help:    "Time each collection waited for the collection mutex, high values indicate overlapping scrapes",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+	},
+)
+
+// metricScrapeDuration is observed directly for the same reason.
+var metricScrapeDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "smartctl_scrape_duration_seconds",
+		Help:    "Wall time of the smartctl runs reading devices, by device type",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+	},
+	[]string{"type"},
 )
@@ -0,0 +1,117 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+// ocpSMARTLogGUID identifies the OCP SMART / Health Information Extended log
+// page (C0h). Drives without OCP support return other or no data there.
+const ocpSMARTLogGUID = "0xafd514c97c6f4f9ca4f2bfea2810afc5"
+
+// ocpSMARTFields maps the nvme-cli JSON keys of the OCP extended SMART log to
+// the field label.
+var ocpSMARTFields = map[string]string{
+	"Physical media units written":        "physical_media_units_written_bytes",
+	"Physical media units read":           "physical_media_units_read_bytes",
+	"Bad user nand blocks - Raw":          "bad_user_nand_blocks",
+	"Bad system nand blocks - Raw":        "bad_system_nand_blocks",
+	"XOR recovery count":                  "xor_recovery_count",
+	"Uncorrectable read error count":      "uncorrectable_read_error_count",
+	"Soft ecc error count":                "soft_ecc_error_count",
+	"End to end detected errors":          "end_to_end_detected_errors",
+	"End to end corrected errors":         "end_to_end_corrected_errors",
+	"System data percent used":            "system_data_percent_used",
+	"Refresh counts":                      "refresh_count",
+	"Max User data erase counts":          "max_user_data_erase_count",
+	"Min User data erase counts":          "min_user_data_erase_count",
+	"Number of Thermal throttling events": "thermal_throttling_events",
+	"Current throttling status":           "current_throttling_status",
+	"PCIe correctable error count":        "pcie_correctable_error_count",
+	"Incomplete shutdowns":                "incomplete_shutdowns",
+	"Percent free blocks":                 "percent_free_blocks",
+	"Capacitor health":                    "capacitor_health",
+	"Unaligned I/O":                       "unaligned_io",
+	"PLP start count":                     "plp_start_count",
+	"Endurance estimate":                  "endurance_estimate",
+}
+
+var ocpCache sync.Map
+
+type ocpCacheValue struct {
+	json        gjson.Result
+	lastCollect time.Time
+}
+
+// collectOCPSMARTLog sends the OCP extended SMART log of an NVMe device, read
+// with nvme-cli. Devices without the OCP log are skipped.
+func collectOCPSMARTLog(logger log.Logger, ch chan<- prometheus.Metric, device Device, json gjson.Result) {
+	if json.Get("device.protocol").String() != "NVMe" {
+		return
+	}
+	smartLog := readOCPSMARTLog(logger, device)
+	if smartLog.Get("Log page GUID").String() != ocpSMARTLogGUID {
+		return
+	}
+	for key, field := range ocpSMARTFields {
+		value := smartLog.Get(gjson.Escape(key))
+		if !value.Exists() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricDeviceOCPSMARTLog,
+			prometheus.GaugeValue,
+			ocpValue(value),
+			deviceLabel(device),
+			field,
+		)
+	}
+}
+
+// ocpValue returns the value of a field. nvme-cli prints the 128 bit
+// counters as object of the high and low 64 bits.
+func ocpValue(value gjson.Result) float64 {
+	if value.IsObject() {
+		return value.Get("hi").Float()*math.Pow(2, 64) + value.Get("lo").Float()
+	}
+	return value.Float()
+}
+
+// readOCPSMARTLog returns the OCP extended SMART log, cached for
+// smartctl.interval and kept in maintenance mode. Failed reads are cached
+// too, so drives without OCP support are not queried on every scrape.
+func readOCPSMARTLog(logger log.Logger, device Device) gjson.Result {
+	cached, ok := ocpCache.Load(device)
+	if ok && (inMaintenance() || time.Now().Before(cached.(ocpCacheValue).lastCollect.Add(currentSettings().interval))) {
+		return cached.(ocpCacheValue).json
+	}
+	if inMaintenance() {
+		return gjson.Result{}
+	}
+	out, err := runTool(*nvmePath, "ocp", "smart-add-log", device.Name, "--output-format=json")
+	if err != nil {
+		level.Debug(logger).Log("msg", "OCP SMART log reading", "err", err, "device", device.Info_Name)
+	}
+	json := parseJSON(string(out))
+	ocpCache.Store(device, ocpCacheValue{json: json, lastCollect: time.Now()})
+	return json
+}
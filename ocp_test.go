@@ -0,0 +1,161 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/tidwall/gjson"
+)
+
+func TestOCPValue(t *testing.T) {
+	for json, want := range map[string]float64{
+		`42`:                 42,
+		`{"hi":0,"lo":1234}`: 1234,
+		`{"hi":1,"lo":5}`:    math.Pow(2, 64) + 5,
+	} {
+		if got := ocpValue(gjson.Parse(json)); got != want {
+			t.Errorf("ocpValue(%s) = %v, want %v", json, got, want)
+		}
+	}
+}
+
+// fakeNVMe returns an nvme-cli replacement running script.
+func fakeNVMe(t *testing.T, script string) string {
+	path := filepath.Join(t.TempDir(), "nvme")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// collectOCP returns the OCP SMART log fields collected for an NVMe device.
+func collectOCP(t *testing.T, name string) map[string]float64 {
+	device := Device{Name: name, Info_Name: "nvme0"}
+	defer forgetDevice(device)
+	ch := make(chan prometheus.Metric, len(ocpSMARTFields)+1)
+	collectOCPSMARTLog(log.NewNopLogger(), ch, device, gjson.Parse(`{"device":{"protocol":"NVMe"}}`))
+	close(ch)
+	fields := map[string]float64{}
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "field" {
+				fields[label.GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	return fields
+}
+
+func TestOCPSMARTLog(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := filepath.Abs("testdata/ocp/smart-add-log.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	*nvmePath = fakeNVMe(t, "cat "+fixture)
+	defer func() { *nvmePath = "" }()
+
+	fields := collectOCP(t, "/dev/nvme0")
+	for field, want := range map[string]float64{
+		"physical_media_units_written_bytes": 89327849472,
+		"physical_media_units_read_bytes":    math.Pow(2, 64),
+		"refresh_count":                      45,
+		"plp_start_count":                    21,
+		"pcie_correctable_error_count":       2,
+	} {
+		if got, ok := fields[field]; !ok || got != want {
+			t.Errorf("%s = %v, want %v", field, got, want)
+		}
+	}
+	if len(fields) != len(ocpSMARTFields) {
+		t.Errorf("%d fields collected, want %d", len(fields), len(ocpSMARTFields))
+	}
+
+	// Drives without the OCP log return another or no GUID.
+	*nvmePath = fakeNVMe(t, `echo '{"Log page GUID":"0x0"}'`)
+	if fields := collectOCP(t, "/dev/nvme1"); len(fields) > 0 {
+		t.Errorf("fields collected without the OCP GUID: %v", fields)
+	}
+
+	// A hung nvme-cli is killed after smartctl.timeout.
+	*nvmePath = fakeNVMe(t, "exec sleep 10")
+	timeout := *smartctlTimeout
+	*smartctlTimeout = 100 * time.Millisecond
+	defer func() { *smartctlTimeout = timeout }()
+	start := time.Now()
+	collectOCP(t, "/dev/nvme2")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("nvme-cli not killed, collection took %s", elapsed)
+	}
+}
+
+func TestOCPSMARTLogEdgeCases(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	calls := filepath.Join(t.TempDir(), "calls")
+	*nvmePath = fakeNVMe(t, "echo >> "+calls+"\n"+
+		`echo '{"Log page GUID":"`+ocpSMARTLogGUID+`","Refresh counts":3,"Unknown field":7}'`)
+	defer func() { *nvmePath = "" }()
+
+	// Only NVMe devices are queried.
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	ch := make(chan prometheus.Metric, len(ocpSMARTFields))
+	collectOCPSMARTLog(log.NewNopLogger(), ch, device, gjson.Parse(`{"device":{"protocol":"ATA"}}`))
+	forgetDevice(device)
+	if len(ch) > 0 {
+		t.Errorf("%d OCP fields collected for an ATA device", len(ch))
+	}
+	if _, err := os.Stat(calls); err == nil {
+		t.Error("nvme-cli run for an ATA device")
+	}
+
+	// Absent and unknown fields are skipped.
+	fields := collectOCP(t, "/dev/nvme0")
+	if len(fields) != 1 || fields["refresh_count"] != 3 {
+		t.Errorf("fields = %v, want only refresh_count 3", fields)
+	}
+
+	// The log is read once per smartctl.interval.
+	device = Device{Name: "/dev/nvme1", Info_Name: "nvme1"}
+	defer forgetDevice(device)
+	os.Remove(calls)
+	for i := 0; i < 3; i++ {
+		readOCPSMARTLog(log.NewNopLogger(), device)
+	}
+	if out, err := os.ReadFile(calls); err != nil || len(out) != 1 {
+		t.Errorf("nvme-cli run %d times, want 1", len(out))
+	}
+
+	// A failing nvme-cli sends nothing.
+	*nvmePath = fakeNVMe(t, "echo 'invalid command' >&2; exit 1")
+	if fields := collectOCP(t, "/dev/nvme2"); len(fields) > 0 {
+		t.Errorf("fields collected from failed nvme-cli: %v", fields)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	remoteTargetRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@:-]*$`)
+	remoteDeviceRe = regexp.MustCompile(`^/dev/[A-Za-z0-9/_.:-]+$`)
+	remoteTypeRe   = regexp.MustCompile(`^[a-z0-9+,]*$`)
+)
+
+// SMARTctlProbeCollector collects the devices requested by a single probe.
+type SMARTctlProbeCollector struct {
+	Devices []Device
+
+	filter deviceFilter
+	logger log.Logger
+}
+
+// Describe sends no descriptors, the probed devices are only known at
+// collection time.
+func (c *SMARTctlProbeCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect is called by the Prometheus registry when collecting metrics.
+func (c *SMARTctlProbeCollector) Collect(ch chan<- prometheus.Metric) {
+	info := NewSMARTctlInfo(ch)
+	ambient, hasAmbient := readAmbientTemperature(c.logger)
+	for _, device := range c.Devices {
+		success := 0.0
+		if c.filter.ignored(device.Info_Name) {
+			level.Info(c.logger).Log("msg", "Ignoring probed device", "name", device.Info_Name)
+		} else if json := readData(c.logger, device); json.Exists() {
+			info.SetJSON(json)
+			smart := NewSMARTctl(c.logger, json, ch)
+			smart.ambient, smart.hasAmbient = ambient, hasAmbient
+			smart.Collect()
+			success = 1
+		}
+		collectTypeSource(ch, device)
+		ch <- prometheus.MustNewConstMetric(
+			metricProbeDeviceSuccess,
+			prometheus.GaugeValue,
+			success,
+			deviceLabel(device),
+		)
+	}
+	info.Collect()
+}
+
+// probeDevices builds the device list from the repeated device query
+// parameters. Devices collected by the exporter are probed as collected,
+// keeping their type, arguments and labels; a type parameter only selects
+// among collected devices sharing the name. The optional type parameters are
+// matched to the devices by position, device type aliases are expanded.
+func probeDevices(names, types []string, collected []Device) []Device {
+	devices := []Device{}
+	for idx, name := range names {
+		deviceType := ""
+		if idx < len(types) {
+			deviceType = expandDeviceType(types[idx])
+		}
+		if device, ok := collectedDevice(collected, name, deviceType); ok {
+			devices = append(devices, device)
+			continue
+		}
+		device := Device{Name: name, TypeSource: TypeSourceProbe}
+		if idx < len(types) {
+			device.Type = deviceType
+			if device.Type != types[idx] {
+				device.TypeSource = TypeSourceAlias
+			}
+		}
+		device.Info_Name = getDiskName(name, strings.ReplaceAll(device.Type, ",", "_"))
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// collectedDevice returns the collected device with the name, preferring the
+// one of the given type when several share the name, e.g. megaraid slots.
+func collectedDevice(collected []Device, name, deviceType string) (Device, bool) {
+	found := false
+	var match Device
+	for _, device := range collected {
+		if device.Name != name {
+			continue
+		}
+		if deviceType != "" && device.Type == deviceType {
+			return device, true
+		}
+		if !found {
+			match, found = device, true
+		}
+	}
+	return match, found
+}
+
+// probeHandler serves the requested local devices. Only devices collected
+// by the exporter can be probed, so a client can neither run smartctl on
+// arbitrary paths nor make the exporter keep state for them.
+func probeHandler(w http.ResponseWriter, r *http.Request, logger log.Logger, collected []Device) {
+	names := map[string]bool{}
+	for _, device := range collected {
+		names[device.Name] = true
+	}
+	for _, name := range r.URL.Query()["device"] {
+		if !names[name] {
+			http.Error(w, "device parameter is not a collected device", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, deviceType := range r.URL.Query()["type"] {
+		if !remoteTypeRe.MatchString(expandDeviceType(deviceType)) {
+			http.Error(w, "invalid type parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	serveProbe(w, r, logger, "", collected)
+}
+
+// scrapeHandler serves the devices of the host given by the target
+// parameter, read by running remote.command-template.
+func scrapeHandler(w http.ResponseWriter, r *http.Request, logger log.Logger, collected []Device) {
+	if *remoteCommandTemplate == "" {
+		http.Error(w, "remote targets are disabled, see --remote.command-template", http.StatusNotFound)
+		return
+	}
+	target := r.URL.Query().Get("target")
+	if !remoteTargetRe.MatchString(target) {
+		http.Error(w, "target parameter is missing or invalid", http.StatusBadRequest)
+		return
+	}
+	// The remote shell interprets the smartctl arguments, only plain device
+	// paths and types are passed on.
+	for _, name := range r.URL.Query()["device"] {
+		if !remoteDeviceRe.MatchString(name) || strings.Contains(name, "..") {
+			http.Error(w, "invalid device parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, deviceType := range r.URL.Query()["type"] {
+		if !remoteTypeRe.MatchString(expandDeviceType(deviceType)) {
+			http.Error(w, "invalid type parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	serveProbe(w, r, logger, target, collected)
+}
+
+// serveProbe collects the requested devices. Local devices are looked up in
+// the collected ones, sharing their cached reads. The state kept for devices
+// the exporter does not collect itself is dropped afterwards.
+func serveProbe(w http.ResponseWriter, r *http.Request, logger log.Logger, target string, collected []Device) {
+	params := r.URL.Query()
+	names := params["device"]
+	if len(names) == 0 {
+		http.Error(w, "device parameter is missing", http.StatusBadRequest)
+		return
+	}
+	types := params["type"]
+	if len(types) > len(names) {
+		http.Error(w, "more type than device parameters", http.StatusBadRequest)
+		return
+	}
+
+	local := collected
+	if target != "" {
+		local = nil
+	}
+	devices := probeDevices(names, types, local)
+	for idx := range devices {
+		devices[idx].Target = target
+	}
+	collector := &SMARTctlProbeCollector{
+		Devices: devices,
+		filter:  newDeviceFilter(*smartctlDeviceExclude, *smartctlDeviceInclude),
+		logger:  logger,
+	}
+	known := map[Device]bool{}
+	for _, device := range collected {
+		known[device] = true
+	}
+	defer func() {
+		for _, device := range devices {
+			if !known[device] {
+				forgetDevice(device)
+			}
+		}
+	}()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	promhttp.HandlerFor(withMetricPrefix(withExtraLabels(registry, *smartctlExtraLabels), *metricPrefix), promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
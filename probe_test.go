@@ -0,0 +1,159 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+)
+
+func TestProbeHandlerDevices(t *testing.T) {
+	collected := []Device{{Name: "/dev/sda", Info_Name: "/dev/sda", Type: "sat", TypeSource: TypeSourceScan}}
+	for query, status := range map[string]int{
+		"/probe?device=/etc/passwd":            http.StatusBadRequest,
+		"/probe?device=/dev/sdb":               http.StatusBadRequest,
+		"/probe?device=/dev/sda&type=sat%20-x": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		probeHandler(w, httptest.NewRequest(http.MethodGet, query, nil), log.NewNopLogger(), collected)
+		if w.Code != status {
+			t.Errorf("%s: status %d, want %d", query, w.Code, status)
+		}
+	}
+}
+
+func TestSetDevicesForgetsRemoved(t *testing.T) {
+	kept := Device{Name: "/dev/sda", Info_Name: "/dev/sda"}
+	removed := Device{Name: "/dev/sdb", Info_Name: "/dev/sdb"}
+	collector := SMARTctlManagerCollector{Devices: []Device{kept, removed}}
+	for _, device := range collector.Devices {
+		jsonCache.Store(device, JSONCache{})
+		defer forgetDevice(device)
+	}
+
+	added, gone := collector.setDevices([]Device{kept})
+	if added != 0 || gone != 1 {
+		t.Errorf("added %d, removed %d, want 0 and 1", added, gone)
+	}
+	if _, ok := jsonCache.Load(removed); ok {
+		t.Errorf("state of the removed device kept")
+	}
+	if _, ok := jsonCache.Load(kept); !ok {
+		t.Errorf("state of the kept device dropped")
+	}
+}
+
+func TestProbeDevicesCollected(t *testing.T) {
+	collected := []Device{
+		{Name: "/dev/bus/0", Info_Name: "/dev/bus/0_megaraid_disk_00", Type: "megaraid,0", TypeSource: TypeSourceScan, Alias: "boot"},
+		{Name: "/dev/bus/0", Info_Name: "/dev/bus/0_megaraid_disk_01", Type: "megaraid,1", TypeSource: TypeSourceScan},
+	}
+	devices := probeDevices([]string{"/dev/bus/0", "/dev/bus/0", "/dev/sdb"}, []string{"", "megaraid,1", "sat"}, collected)
+	want := []Device{
+		collected[0],
+		collected[1],
+		{Name: "/dev/sdb", Info_Name: "sdb", Type: "sat", TypeSource: TypeSourceProbe},
+	}
+	for idx := range want {
+		if devices[idx] != want[idx] {
+			t.Errorf("device %d: got %+v, want %+v", idx, devices[idx], want[idx])
+		}
+	}
+}
+
+func TestProbeDevicesTypeSource(t *testing.T) {
+	saved := deviceTypeAliases
+	defer func() { deviceTypeAliases = saved }()
+	deviceTypeAliases = map[string]string{"mr5": "megaraid,5"}
+	devices := probeDevices([]string{"/dev/sdc", "/dev/bus/0", "/dev/sdd"}, []string{"sat", "mr5"}, nil)
+	want := []Device{
+		{Name: "/dev/sdc", Info_Name: "sdc", Type: "sat", TypeSource: TypeSourceProbe},
+		{Name: "/dev/bus/0", Info_Name: "bus_0_megaraid_5", Type: "megaraid,5", TypeSource: TypeSourceAlias},
+		{Name: "/dev/sdd", Info_Name: "sdd", TypeSource: TypeSourceProbe},
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("devices = %+v, want %+v", devices, want)
+	}
+}
+
+func TestScrapeHandler(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	scrapeHandler(w, httptest.NewRequest(http.MethodGet, "/scrape?target=db1&device=/dev/sda", nil), log.NewNopLogger(), nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("disabled: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	fixture, err := filepath.Abs("testdata/HGST_HUS724020ALE640_28.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	shim := writeShim(t, dir, "ssh", `echo "$@" > `+args+`
+cat `+fixture+`
+`)
+	saved := *remoteCommandTemplate
+	*remoteCommandTemplate = shim + " {target} sudo smartctl"
+	defer func() { *remoteCommandTemplate = saved }()
+
+	for query, status := range map[string]int{
+		"/scrape?device=/dev/sda":                              http.StatusBadRequest,
+		"/scrape?target=-oProxyCommand=x&device=/dev/sda":      http.StatusBadRequest,
+		"/scrape?target=db1%3Breboot&device=/dev/sda":          http.StatusBadRequest,
+		"/scrape?target=db1&device=/dev/../etc/passwd":         http.StatusBadRequest,
+		"/scrape?target=db1&device=/dev/sda%3Breboot":          http.StatusBadRequest,
+		"/scrape?target=db1&device=/dev/sda&type=sat%20-x":     http.StatusBadRequest,
+		"/scrape?target=db1":                                   http.StatusBadRequest,
+		"/scrape?target=db1&device=/dev/sda&type=sat&type=sat": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		scrapeHandler(w, httptest.NewRequest(http.MethodGet, query, nil), log.NewNopLogger(), nil)
+		if w.Code != status {
+			t.Errorf("%s: status %d, want %d", query, w.Code, status)
+		}
+	}
+
+	// Local devices are neither read nor remembered for remote targets.
+	collected := []Device{{Name: "/dev/sda", Info_Name: "sda"}}
+	w = httptest.NewRecorder()
+	scrapeHandler(w, httptest.NewRequest(http.MethodGet, "/scrape?target=db1.example.com&device=/dev/sda&type=sat", nil), log.NewNopLogger(), collected)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), `smartctl_probe_device_success{device="sda"} 1`) {
+		t.Errorf("probe success missing:\n%s", w.Body)
+	}
+	out, err := os.ReadFile(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(out); !strings.HasPrefix(got, "db1.example.com sudo smartctl ") || !strings.Contains(got, " /dev/sda -d sat") {
+		t.Errorf("remote command arguments %q, want the target, sudo smartctl and the device", got)
+	}
+	remote := Device{Name: "/dev/sda", Info_Name: "sda", Type: "sat", TypeSource: TypeSourceProbe, Target: "db1.example.com"}
+	if _, ok := lastCollect(remote); ok {
+		t.Error("state of the remote device kept after the scrape")
+	}
+}
@@ -0,0 +1,524 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+// RAIDController - cache and battery backup unit state of a RAID controller
+type RAIDController struct {
+	Name         string
+	BBUState     string
+	BBUOptimal   bool
+	CachePresent bool
+	// Volumes and PhysicalDrives are only read from cciss_vol_status,
+	// Volumes is nil for other controllers.
+	Volumes        []RAIDVolume
+	PhysicalDrives int
+}
+
+// RAIDVolume - logical volume of a RAID controller
+type RAIDVolume struct {
+	Volume    string
+	RAIDLevel string
+	Status    string
+}
+
+// RAIDDriveLocation - physical location of a drive behind a RAID controller
+type RAIDDriveLocation struct {
+	Enclosure string
+	Slot      string
+}
+
+// RAIDCache caching controller state
+type RAIDCache struct {
+	Controllers []RAIDController
+	// DegradedDrives are the enclosure:slot of the drives in a degraded
+	// MegaRAID virtual drive, nil if storcli was not run.
+	DegradedDrives map[string]bool
+	// MdstatDisks and ZpoolDisks are the disks of the last mdstat and zpool
+	// reads, mapped to whether their array is degraded. Like the controllers
+	// they are read once per interval and kept for maintenance mode.
+	MdstatDisks       map[string]bool
+	ZpoolDisks        map[string]bool
+	ArraysLastCollect time.Time
+	LastCollect       time.Time
+}
+
+var (
+	raidCache      RAIDCache
+	raidCacheMutex sync.Mutex
+
+	raidDriveLocations      map[string]RAIDDriveLocation
+	raidDriveLocationsMutex sync.RWMutex
+
+	storcliDriveRe    = regexp.MustCompile(`^Drive /c\d+(?:/e(\d+))?/s(\d+) - Detailed Information$`)
+	storcliVDRe       = regexp.MustCompile(`^/c\d+/v(\d+)$`)
+	mdstatArrayRe     = regexp.MustCompile(`^(md\S+) : (\S+) (.*)$`)
+	mdstatStatusRe    = regexp.MustCompile(`\[(\d+)/(\d+)\]`)
+	mdstatMemberRe    = regexp.MustCompile(`^([^\[\s]+)\[\d+\](\(\w\))?$`)
+	zpoolStateRe      = regexp.MustCompile(`^\s*state: (\S+)`)
+	ccissCacheBoardRe = regexp.MustCompile(`(?im)^\s*cache board present:\s*(\S+)`)
+	ccissBatteryRe    = regexp.MustCompile(`(?im)^\s*(?:battery|capacitor)[^:\n]*status:\s*(.+?)\s*$`)
+	// e.g. "/dev/sg0: (Smart Array P420i) RAID 1 Volume 0 status: OK."
+	ccissVolumeRe         = regexp.MustCompile(`(?m)^\S+: \([^)]*\) (.+?) Volume (\d+) status: (.+?)\.?\s*$`)
+	ccissPhysicalDrivesRe = regexp.MustCompile(`(?m)Physical drives: (\d+)`)
+	arcconfCountRe        = regexp.MustCompile(`(?m)^Controllers found: (\d+)`)
+	arcconfMemoryRe       = regexp.MustCompile(`(?m)^\s*Installed memory\s*: (.+?)\s*$`)
+	arcconfBackupUnitRe   = regexp.MustCompile(`(?m)^\s*Overall Backup Unit Status\s*: (.+?)\s*$`)
+	// The battery status is the first status after the battery section
+	// heading of older controllers.
+	arcconfBatteryRe = regexp.MustCompile(`(?s)Controller Battery Information\s*-+\s*Status\s*: ([^\n]+?)\s*\n`)
+)
+
+// readRAIDControllers returns the cache/BBU state of every RAID controller
+// backing the given devices. Controller tools are only invoked when devices
+// of the matching type are present, and not at all in maintenance mode.
+func readRAIDControllers(logger log.Logger, devices []Device) []RAIDController {
+	raidCacheMutex.Lock()
+	defer raidCacheMutex.Unlock()
+	if inMaintenance() || time.Now().Before(raidCache.LastCollect.Add(currentSettings().interval)) {
+		return raidCache.Controllers
+	}
+
+	controllers := []RAIDController{}
+	ccissSeen := map[string]bool{}
+	megaraid, aacraid := false, false
+	for _, device := range devices {
+		switch {
+		case strings.Contains(device.Type, AacraidType):
+			aacraid = true
+		case strings.Contains(device.Type, CcissType):
+			if !ccissSeen[device.Name] {
+				ccissSeen[device.Name] = true
+				controllers = append(controllers, readCcissController(logger, device.Name)...)
+			}
+		case strings.Contains(device.Type, MegaraidType):
+			megaraid = true
+		}
+	}
+	if aacraid && *arcconfPath != "" {
+		controllers = append(controllers, readArcconfControllers(logger)...)
+	}
+	var degraded map[string]bool
+	if megaraid && *storcliPath != "" {
+		controllers = append(controllers, readStorcliControllers(logger)...)
+		degraded = readStorcliDegradedDrives(logger)
+	}
+
+	raidCache.Controllers = controllers
+	raidCache.DegradedDrives = degraded
+	raidCache.LastCollect = time.Now()
+	return controllers
+}
+
+// readStorcliDegradedDrives returns the enclosure:slot of the drives of all
+// MegaRAID virtual drives that are not optimal.
+func readStorcliDegradedDrives(logger log.Logger) map[string]bool {
+	return parseStorcliDegradedDrives(readStorcli(logger, "/call/vall", "show", "all", "J"))
+}
+
+// parseStorcliDegradedDrives parses the output of storcli /call/vall show
+// all J.
+func parseStorcliDegradedDrives(json gjson.Result) map[string]bool {
+	degraded := map[string]bool{}
+	for _, c := range json.Get("Controllers").Array() {
+		data := c.Get("Response Data")
+		data.ForEach(func(key, value gjson.Result) bool {
+			match := storcliVDRe.FindStringSubmatch(key.String())
+			if match == nil || value.Get("0.State").String() == "Optl" {
+				return true
+			}
+			for _, pd := range data.Get(gjson.Escape("PDs for VD " + match[1])).Array() {
+				degraded[pd.Get(gjson.Escape("EID:Slt")).String()] = true
+			}
+			return true
+		})
+	}
+	return degraded
+}
+
+// readMdstatDegradedDisks returns the disks of all Linux software RAID
+// arrays, mapped to whether the array is degraded, from the mdstat file.
+func readMdstatDegradedDisks(logger log.Logger) map[string]bool {
+	out, err := os.ReadFile(*mdstatPath)
+	if err != nil {
+		level.Warn(logger).Log("msg", "mdstat reading", "err", err, "path", *mdstatPath)
+		return nil
+	}
+	return parseMdstat(string(out), parentDisk)
+}
+
+// parseMdstat parses the arrays of an mdstat file. The status line
+// following each array lists the number of configured and active members,
+// the array is degraded if fewer are active or a member is marked failed.
+func parseMdstat(mdstat string, disk func(string) string) map[string]bool {
+	disks := map[string]bool{}
+	lines := strings.Split(mdstat, "\n")
+	for idx, line := range lines {
+		match := mdstatArrayRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		members := []string{}
+		degraded := false
+		for _, field := range strings.Fields(match[3]) {
+			member := mdstatMemberRe.FindStringSubmatch(field)
+			if member == nil {
+				continue
+			}
+			members = append(members, member[1])
+			degraded = degraded || member[2] == "(F)"
+		}
+		if idx+1 < len(lines) {
+			if status := mdstatStatusRe.FindStringSubmatch(lines[idx+1]); status != nil {
+				degraded = degraded || status[1] != status[2]
+			}
+		}
+		for _, member := range members {
+			name := disk(member)
+			disks[name] = disks[name] || degraded
+		}
+	}
+	return disks
+}
+
+// readZpoolDegradedDisks returns the disks of all ZFS pools, mapped to
+// whether the pool is degraded. -P prints the full paths of the vdevs and -L
+// resolves them to the block devices.
+func readZpoolDegradedDisks(logger log.Logger) map[string]bool {
+	out, err := runTool(*zpoolPath, "status", "-P", "-L")
+	if err != nil {
+		level.Warn(logger).Log("msg", "zpool output reading", "err", err)
+		return nil
+	}
+	return parseZpoolStatus(string(out), parentDisk)
+}
+
+// parseZpoolStatus parses the output of zpool status -P -L. A pool is
+// degraded unless its state is ONLINE, all vdevs below /dev/ belong to the
+// pool named last.
+func parseZpoolStatus(status string, disk func(string) string) map[string]bool {
+	disks := map[string]bool{}
+	degraded := false
+	for _, line := range strings.Split(status, "\n") {
+		if match := zpoolStateRe.FindStringSubmatch(line); match != nil {
+			degraded = match[1] != "ONLINE"
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "/dev/") {
+			continue
+		}
+		name := disk(filepath.Base(fields[0]))
+		disks[name] = disks[name] || degraded
+	}
+	return disks
+}
+
+// collectDegradedArrays sends for every device whether it belongs to a
+// degraded array, if any array integration is enabled.
+func collectDegradedArrays(logger log.Logger, ch chan<- prometheus.Metric, devices []Device, serials map[Device]string) {
+	raidCacheMutex.Lock()
+	if !inMaintenance() && !time.Now().Before(raidCache.ArraysLastCollect.Add(currentSettings().interval)) {
+		raidCache.MdstatDisks, raidCache.ZpoolDisks = nil, nil
+		if *mdstatPath != "" {
+			raidCache.MdstatDisks = readMdstatDegradedDisks(logger)
+		}
+		if *zpoolPath != "" {
+			raidCache.ZpoolDisks = readZpoolDegradedDisks(logger)
+		}
+		raidCache.ArraysLastCollect = time.Now()
+	}
+	storcliDegraded := raidCache.DegradedDrives
+	mdstatDegraded := raidCache.MdstatDisks
+	zpoolDegraded := raidCache.ZpoolDisks
+	raidCacheMutex.Unlock()
+	if storcliDegraded == nil && mdstatDegraded == nil && zpoolDegraded == nil {
+		return
+	}
+
+	for _, device := range devices {
+		disk := filepath.Base(blockDeviceName(device.Name))
+		degraded := mdstatDegraded[disk] || zpoolDegraded[disk]
+		if strings.Contains(device.Type, MegaraidType) {
+			location := raidDriveLocation(serials[device])
+			degraded = degraded || storcliDegraded[location.Enclosure+":"+location.Slot]
+		}
+		value := 0.0
+		if degraded {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricDeviceInDegradedArray,
+			prometheus.GaugeValue,
+			value,
+			deviceLabel(device),
+		)
+	}
+}
+
+// readCcissController reads the controller of the device with
+// cciss_vol_status -V.
+func readCcissController(logger log.Logger, name string) []RAIDController {
+	out, err := runTool(*ccissVolStatusPath, name, "-V")
+	if exiterr, ok := err.(*exec.ExitError); ok {
+		// 1 - One or more configured logical drives queried have status other than "OK."
+		if exiterr.ExitCode() > 1 {
+			level.Warn(logger).Log("msg", "cciss_vol_status output reading", "err", err, "device", name)
+			return nil
+		}
+	} else if err != nil {
+		level.Warn(logger).Log("msg", "cciss_vol_status output reading", "err", err, "device", name)
+		return nil
+	}
+	return parseCcissController(name, out)
+}
+
+// parseCcissController parses the output of cciss_vol_status -V.
+func parseCcissController(name string, out []byte) []RAIDController {
+	controller := RAIDController{Name: name, Volumes: []RAIDVolume{}}
+	for _, match := range ccissVolumeRe.FindAllSubmatch(out, -1) {
+		controller.Volumes = append(controller.Volumes, RAIDVolume{
+			RAIDLevel: string(match[1]),
+			Volume:    string(match[2]),
+			Status:    string(match[3]),
+		})
+	}
+	if match := ccissPhysicalDrivesRe.FindSubmatch(out); match != nil {
+		controller.PhysicalDrives, _ = strconv.Atoi(string(match[1]))
+	}
+	if match := ccissCacheBoardRe.FindSubmatch(out); match != nil {
+		present := strings.ToLower(string(match[1]))
+		controller.CachePresent = present == "true" || present == "yes"
+	}
+	match := ccissBatteryRe.FindSubmatch(out)
+	if match == nil {
+		return []RAIDController{controller}
+	}
+	controller.BBUState = string(match[1])
+	controller.BBUOptimal = strings.HasPrefix(strings.ToLower(controller.BBUState), "ok")
+	return []RAIDController{controller}
+}
+
+// readStorcliControllers reads all MegaRAID controllers with storcli.
+func readStorcliControllers(logger log.Logger) []RAIDController {
+	json := readStorcli(logger, "/call", "show", "all", "J")
+	controllers := []RAIDController{}
+	for _, c := range json.Get("Controllers").Array() {
+		if c.Get("Command Status.Status").String() != "Success" {
+			continue
+		}
+		data := c.Get("Response Data")
+		controller := RAIDController{
+			Name: fmt.Sprintf("c%d", c.Get("Command Status.Controller").Int()),
+		}
+		memory := strings.TrimSpace(data.Get(`HwCfg.On Board Memory Size`).String())
+		controller.CachePresent = memory != "" && !strings.HasPrefix(memory, "0")
+		for _, path := range []string{"Cachevault_Info", "BBU_Info"} {
+			if unit := data.Get(path + ".0"); unit.Exists() {
+				controller.BBUState = unit.Get("State").String()
+				controller.BBUOptimal = controller.BBUState == "Optimal"
+				break
+			}
+		}
+		controllers = append(controllers, controller)
+	}
+	return controllers
+}
+
+// readArcconfControllers reads all Adaptec controllers with arcconf. Areca
+// controllers have their own tool and are not read.
+func readArcconfControllers(logger log.Logger) []RAIDController {
+	out, err := runTool(*arcconfPath, "GETVERSION")
+	if err != nil {
+		level.Warn(logger).Log("msg", "arcconf output reading", "err", err, "args", "GETVERSION")
+		return nil
+	}
+	match := arcconfCountRe.FindSubmatch(out)
+	if match == nil {
+		return nil
+	}
+	count, _ := strconv.Atoi(string(match[1]))
+	controllers := []RAIDController{}
+	for n := 1; n <= count; n++ {
+		out, err := runTool(*arcconfPath, "GETCONFIG", strconv.Itoa(n), "AD")
+		if err != nil {
+			level.Warn(logger).Log("msg", "arcconf output reading", "err", err, "args", fmt.Sprintf("GETCONFIG %d AD", n))
+			continue
+		}
+		controllers = append(controllers, parseArcconfController(fmt.Sprintf("arcconf%d", n), out))
+	}
+	return controllers
+}
+
+// parseArcconfController parses the output of arcconf GETCONFIG N AD. Newer
+// controllers report a cache backup unit (supercap), older ones a battery.
+func parseArcconfController(name string, out []byte) RAIDController {
+	controller := RAIDController{Name: name}
+	if match := arcconfMemoryRe.FindSubmatch(out); match != nil {
+		controller.CachePresent = !strings.HasPrefix(string(match[1]), "0")
+	}
+	match := arcconfBackupUnitRe.FindSubmatch(out)
+	if match == nil {
+		match = arcconfBatteryRe.FindSubmatch(out)
+	}
+	if match == nil || string(match[1]) == "Not Installed" {
+		return controller
+	}
+	controller.BBUState = string(match[1])
+	controller.BBUOptimal = controller.BBUState == "Ready" || controller.BBUState == "Optimal"
+	return controller
+}
+
+// refreshRAIDDriveLocations caches the enclosure and slot of every MegaRAID
+// drive by serial number. It is called whenever the devices are loaded,
+// whichever source they come from.
+func refreshRAIDDriveLocations(logger log.Logger, devices []Device) {
+	if *storcliPath == "" || inMaintenance() {
+		return
+	}
+	megaraid := false
+	for _, device := range devices {
+		if strings.Contains(device.Type, MegaraidType) {
+			megaraid = true
+			break
+		}
+	}
+	if !megaraid {
+		return
+	}
+
+	locations := parseStorcliDriveLocations(readStorcli(logger, "/call/eall/sall", "show", "all", "J"))
+	level.Debug(logger).Log("msg", "RAID drive locations found", "count", len(locations))
+
+	raidDriveLocationsMutex.Lock()
+	raidDriveLocations = locations
+	raidDriveLocationsMutex.Unlock()
+}
+
+// parseStorcliDriveLocations returns the location of the drives by serial
+// number from the output of storcli /call/eall/sall show all J. Drives
+// attached to the controller directly have no enclosure.
+func parseStorcliDriveLocations(json gjson.Result) map[string]RAIDDriveLocation {
+	locations := map[string]RAIDDriveLocation{}
+	for _, c := range json.Get("Controllers").Array() {
+		c.Get("Response Data").ForEach(func(key, value gjson.Result) bool {
+			match := storcliDriveRe.FindStringSubmatch(key.String())
+			if match == nil {
+				return true
+			}
+			value.ForEach(func(section, attributes gjson.Result) bool {
+				if strings.HasSuffix(section.String(), "Device attributes") {
+					serial := strings.TrimSpace(attributes.Get("SN").String())
+					if serial != "" {
+						locations[serial] = RAIDDriveLocation{Enclosure: match[1], Slot: match[2]}
+					}
+				}
+				return true
+			})
+			return true
+		})
+	}
+	return locations
+}
+
+// raidDriveLocation returns the cached location of the drive, if known.
+func raidDriveLocation(serial string) RAIDDriveLocation {
+	raidDriveLocationsMutex.RLock()
+	defer raidDriveLocationsMutex.RUnlock()
+	return raidDriveLocations[serial]
+}
+
+func readStorcli(logger log.Logger, args ...string) gjson.Result {
+	out, err := runTool(*storcliPath, args...)
+	if err != nil {
+		level.Warn(logger).Log("msg", "storcli output reading", "err", err, "args", strings.Join(args, " "))
+		return gjson.Result{}
+	}
+	return parseJSON(string(out))
+}
+
+func collectRAIDControllers(ch chan<- prometheus.Metric, controllers []RAIDController) {
+	for _, controller := range controllers {
+		cachePresent := 0.0
+		if controller.CachePresent {
+			cachePresent = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricRAIDCachePresent,
+			prometheus.GaugeValue,
+			cachePresent,
+			controller.Name,
+		)
+		collectRAIDVolumes(ch, controller)
+		if controller.BBUState == "" {
+			continue
+		}
+		bbuOptimal := 0.0
+		if controller.BBUOptimal {
+			bbuOptimal = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricRAIDBBUState,
+			prometheus.GaugeValue,
+			bbuOptimal,
+			controller.Name,
+			controller.BBUState,
+		)
+	}
+}
+
+// collectRAIDVolumes sends the logical volume status and the number of
+// physical drives of cciss controllers.
+func collectRAIDVolumes(ch chan<- prometheus.Metric, controller RAIDController) {
+	if controller.Volumes == nil {
+		return
+	}
+	for _, volume := range controller.Volumes {
+		ok := 0.0
+		if volume.Status == "OK" {
+			ok = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricCcissVolumeStatus,
+			prometheus.GaugeValue,
+			ok,
+			controller.Name,
+			volume.Volume,
+			volume.RAIDLevel,
+			volume.Status,
+		)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricCcissPhysicalDrives,
+		prometheus.GaugeValue,
+		float64(controller.PhysicalDrives),
+		controller.Name,
+	)
+}
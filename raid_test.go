@@ -0,0 +1,295 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseCcissController(t *testing.T) {
+	for file, want := range map[string]RAIDController{
+		"testdata/raid/cciss_vol_status_ok.txt": {
+			Name:           "/dev/sg0",
+			BBUState:       "OK",
+			BBUOptimal:     true,
+			CachePresent:   true,
+			Volumes:        []RAIDVolume{{Volume: "0", RAIDLevel: "RAID 1", Status: "OK"}},
+			PhysicalDrives: 2,
+		},
+		"testdata/raid/cciss_vol_status_degraded.txt": {
+			Name: "/dev/sg1",
+			Volumes: []RAIDVolume{
+				{Volume: "0", RAIDLevel: "RAID 5", Status: "Using interim recovery mode"},
+				{Volume: "1", RAIDLevel: "RAID 0", Status: "OK"},
+			},
+			PhysicalDrives: 4,
+		},
+	} {
+		out, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		controllers := parseCcissController(want.Name, out)
+		if len(controllers) != 1 || !reflect.DeepEqual(controllers[0], want) {
+			t.Errorf("%s: got %+v, want %+v", file, controllers, want)
+		}
+	}
+}
+
+func TestParseCcissControllerEdgeCases(t *testing.T) {
+	for name, test := range map[string]struct {
+		out  string
+		want RAIDController
+	}{
+		"no output": {
+			"",
+			RAIDController{Name: "/dev/sg0", Volumes: []RAIDVolume{}},
+		},
+		"failed capacitor, no cache board": {
+			"  Cache board present: False\n  Capacitor charge status: Failed (Replace Batteries)  \n",
+			RAIDController{Name: "/dev/sg0", Volumes: []RAIDVolume{}, BBUState: "Failed (Replace Batteries)"},
+		},
+		"volume status without trailing period": {
+			"/dev/sg0: (Smart Array P410) RAID 6 (ADG) Volume 2 status: Ready for recovery operation\n",
+			RAIDController{Name: "/dev/sg0", Volumes: []RAIDVolume{{Volume: "2", RAIDLevel: "RAID 6 (ADG)", Status: "Ready for recovery operation"}}},
+		},
+	} {
+		controllers := parseCcissController("/dev/sg0", []byte(test.out))
+		if len(controllers) != 1 || !reflect.DeepEqual(controllers[0], test.want) {
+			t.Errorf("%s: got %+v, want %+v", name, controllers, test.want)
+		}
+	}
+}
+
+// TestReadCcissController checks that degraded volumes, reported with exit
+// status 1, are parsed and other failures are not.
+func TestReadCcissController(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	degraded, err := filepath.Abs("testdata/raid/cciss_vol_status_degraded.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *ccissVolStatusPath
+	defer func() { *ccissVolStatusPath = saved }()
+	dir := t.TempDir()
+
+	*ccissVolStatusPath = writeShim(t, dir, "cciss_vol_status", "cat "+degraded+"\nexit 1\n")
+	if controllers := readCcissController(log.NewNopLogger(), "/dev/sg1"); len(controllers) != 1 || len(controllers[0].Volumes) != 2 {
+		t.Errorf("degraded controller %+v, want its 2 volumes", controllers)
+	}
+	*ccissVolStatusPath = writeShim(t, dir, "cciss_vol_status", "cat "+degraded+"\nexit 2\n")
+	if controllers := readCcissController(log.NewNopLogger(), "/dev/sg1"); controllers != nil {
+		t.Errorf("controllers %+v read from a failed run", controllers)
+	}
+	*ccissVolStatusPath = filepath.Join(dir, "missing")
+	if controllers := readCcissController(log.NewNopLogger(), "/dev/sg1"); controllers != nil {
+		t.Errorf("controllers %+v read without cciss_vol_status", controllers)
+	}
+}
+
+var diskRe = regexp.MustCompile(`^(sd[a-z]+|nvme\d+n\d+)`)
+
+// parentPartition returns the disk of a partition like parentDisk does
+// through sysfs.
+func parentPartition(name string) string {
+	return diskRe.FindString(name)
+}
+
+func TestParseDegradedArrays(t *testing.T) {
+	read := func(file string) string {
+		out, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	for name, test := range map[string]struct {
+		got  map[string]bool
+		want map[string]bool
+	}{
+		"mdstat": {
+			got: parseMdstat(read("testdata/raid/mdstat"), parentPartition),
+			want: map[string]bool{
+				"sda": false, "sdb": false,
+				"sdc": true, "sdd": true, "sde": true,
+				"nvme0n1": true, "nvme1n1": true,
+			},
+		},
+		"zpool": {
+			got: parseZpoolStatus(read("testdata/raid/zpool_status.txt"), parentPartition),
+			want: map[string]bool{
+				"nvme0n1": false, "nvme1n1": false,
+				"sda": true, "sdb": true, "sdc": true, "sdd": true,
+			},
+		},
+		"storcli": {
+			got: parseStorcliDegradedDrives(parseJSON(read("testdata/raid/storcli_vall.json"))),
+			want: map[string]bool{
+				"252:2": true, "252:3": true, "252:4": true, "252:5": true,
+			},
+		},
+	} {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %v, want %v", name, test.got, test.want)
+		}
+	}
+}
+
+func TestParseStorcliDriveLocations(t *testing.T) {
+	out, err := os.ReadFile("testdata/raid/storcli_drives.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := parseStorcliDriveLocations(parseJSON(string(out)))
+	want := map[string]RAIDDriveLocation{
+		"S45PNA0M512345": {Enclosure: "252", Slot: "0"},
+		"ZC20ABCD":       {Enclosure: "", Slot: "4"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestConfigDevicesRefreshLocations checks that the drive locations are read
+// for configured devices, not only for scanned ones.
+func TestConfigDevicesRefreshLocations(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := filepath.Abs("testdata/raid/storcli_drives.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storcli := filepath.Join(t.TempDir(), "storcli")
+	if err := os.WriteFile(storcli, []byte("#!/bin/sh\ncat "+fixture+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := *storcliPath
+	*storcliPath = storcli
+	defer func() {
+		*storcliPath = saved
+		raidDriveLocationsMutex.Lock()
+		raidDriveLocations = nil
+		raidDriveLocationsMutex.Unlock()
+	}()
+
+	config := &Config{Devices: []ConfigDevice{{Name: "/dev/bus/0", Type: "megaraid,4"}}}
+	loadDevices(log.NewNopLogger(), log.NewNopLogger(), config)
+	if got := raidDriveLocation("ZC20ABCD"); got != (RAIDDriveLocation{Slot: "4"}) {
+		t.Errorf("location = %+v, want slot 4", got)
+	}
+}
+
+// TestDegradedArraysCache checks that zpool is run once per interval, not on
+// every collection.
+func TestDegradedArraysCache(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	zpool := filepath.Join(dir, "zpool")
+	if err := os.WriteFile(zpool, []byte("#!/bin/sh\necho run >> "+runs+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := *zpoolPath
+	*zpoolPath = zpool
+	raidCacheMutex.Lock()
+	raidCache = RAIDCache{}
+	raidCacheMutex.Unlock()
+	defer func() {
+		*zpoolPath = saved
+		raidCacheMutex.Lock()
+		raidCache = RAIDCache{}
+		raidCacheMutex.Unlock()
+	}()
+
+	for i := 0; i < 3; i++ {
+		ch := make(chan prometheus.Metric, 1)
+		collectDegradedArrays(log.NewNopLogger(), ch, []Device{{Name: "/dev/sda", Info_Name: "sda"}}, nil)
+	}
+	out, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(out), "run"); got != 1 {
+		t.Errorf("zpool run %d times, want 1", got)
+	}
+}
+
+func TestParseArcconfController(t *testing.T) {
+	for file, want := range map[string]RAIDController{
+		"testdata/raid/arcconf_getconfig_supercap.txt": {Name: "arcconf1", BBUState: "Ready", BBUOptimal: true, CachePresent: true},
+		"testdata/raid/arcconf_getconfig_battery.txt":  {Name: "arcconf1", BBUState: "Charging", CachePresent: true},
+		"testdata/raid/arcconf_getconfig_nobackup.txt": {Name: "arcconf1"},
+	} {
+		out, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := parseArcconfController("arcconf1", out); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", file, got, want)
+		}
+	}
+}
+
+func TestReadArcconfControllers(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	fixtures := map[string]string{}
+	for arg, file := range map[string]string{
+		"GETVERSION": "testdata/raid/arcconf_getversion.txt",
+		"1":          "testdata/raid/arcconf_getconfig_supercap.txt",
+		"2":          "testdata/raid/arcconf_getconfig_battery.txt",
+	} {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fixtures[arg] = path
+	}
+	arcconf := filepath.Join(t.TempDir(), "arcconf")
+	script := "#!/bin/sh\n" +
+		"[ \"$1\" = GETVERSION ] && exec cat " + fixtures["GETVERSION"] + "\n" +
+		"[ \"$2\" = 1 ] && exec cat " + fixtures["1"] + "\n" +
+		"[ \"$2\" = 2 ] && exec cat " + fixtures["2"] + "\n" +
+		"exit 2\n"
+	if err := os.WriteFile(arcconf, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := *arcconfPath
+	*arcconfPath = arcconf
+	defer func() { *arcconfPath = saved }()
+
+	controllers := readArcconfControllers(log.NewNopLogger())
+	want := []RAIDController{
+		{Name: "arcconf1", BBUState: "Ready", BBUOptimal: true, CachePresent: true},
+		{Name: "arcconf2", BBUState: "Charging", CachePresent: true},
+	}
+	if !reflect.DeepEqual(controllers, want) {
+		t.Errorf("got %+v, want %+v", controllers, want)
+	}
+}
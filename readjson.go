@@ -14,13 +14,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kit/log"
@@ -36,6 +41,35 @@ type JSONCache struct {
 
 var (
 	jsonCache sync.Map
+
+	// subprocessDurations keeps the duration of the last smartctl run per
+	// Device.
+	subprocessDurations sync.Map
+
+	// Host-level smartctl invocation counters, regardless of device.
+	smartctlSubprocessTotal    atomic.Uint64
+	smartctlSubprocessFailures atomic.Uint64
+
+	// smartctlAvailable is whether the last local smartctl run could start
+	// the binary.
+	smartctlAvailable atomic.Bool
+
+	// smartctlJSONUnsupported is whether smartctl --version showed a
+	// smartctl without --json, see smartctl.text-fallback.
+	smartctlJSONUnsupported atomic.Bool
+
+	// collectRetries counts the retried smartctl runs per Device, see
+	// smartctl.retries.
+	collectRetries sync.Map
+)
+
+// retryBackoff is the wait before the first retry of a failed smartctl run,
+// it doubles with every further retry. Retries stop before the waits of a
+// device add up to more than retryBudget, as the collection holds the
+// collector mutex and the default scrape timeout is 10s.
+const (
+	retryBackoff = 500 * time.Millisecond
+	retryBudget  = 2 * time.Second
 )
 
 func init() {
@@ -63,30 +97,235 @@ func readFakeSMARTctl(logger log.Logger, device Device) gjson.Result {
 	return parseJSON(string(jsonFile))
 }
 
-// Get json from smartctl and parse it
-func readSMARTctl(logger log.Logger, device Device) (gjson.Result, bool) {
-	start := time.Now()
+// fakeJSONDevices returns a device for every *.json file in the directory,
+// labeled after the file as captured outputs often share the device name.
+func fakeJSONDevices(logger log.Logger, dir string) []Device {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		level.Error(logger).Log("msg", "Fake JSON files listing", "err", err)
+	}
+	devices := []Device{}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		devices = append(devices, Device{
+			Name:       file,
+			Info_Name:  name,
+			TypeSource: TypeSourceFakeJSON,
+			Label:      name,
+		})
+	}
+	level.Info(logger).Log("msg", "Devices read from fake JSON files", "dir", dir, "count", len(devices))
+	return devices
+}
+
+// readFakeJSON reads the smartctl output of the device from its JSON file.
+func readFakeJSON(logger log.Logger, device Device) gjson.Result {
+	data, err := os.ReadFile(device.Name)
+	if err != nil {
+		level.Error(logger).Log("msg", "Fake JSON file reading", "err", err)
+		return gjson.Result{}
+	}
+	if !gjson.ValidBytes(data) {
+		level.Error(logger).Log("msg", "Fake JSON file is not valid JSON", "file", device.Name)
+		return gjson.Result{}
+	}
+	return gjson.ParseBytes(data)
+}
+
+// runSmartctl runs smartctl, through the privileged helper when one is
+// configured, and returns its output. smartctl is killed after
+// smartctl.timeout, as a hung device would block the collection otherwise.
+func runSmartctl(args ...string) ([]byte, error) {
+	return runSmartctlOn("", args...)
+}
+
+// errSudo is returned when sudo refused to run smartctl, e.g. because the
+// sudoers entry is missing and a password would be required.
+var errSudo = errors.New("sudo did not run smartctl")
+
+// runSmartctlOn runs smartctl on the target host with
+// remote.command-template, or locally for an empty target.
+func runSmartctlOn(target string, args ...string) ([]byte, error) {
+	command := []string{*smartctlPath}
+	if *smartctlHelperPath != "" {
+		command = []string{*smartctlHelperPath}
+	}
+	if *smartctlSudo {
+		// -n fails instead of prompting for a password.
+		command = append([]string{*smartctlSudoPath, "-n"}, command...)
+	}
+	if target != "" {
+		command = strings.Fields(strings.ReplaceAll(*remoteCommandTemplate, "{target}", target))
+	}
+	timeout := currentSettings().timeout
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, command[0], append(command[1:], args...)...)
+	// Do not wait for children of a killed smartctl keeping the output open.
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if target == "" {
+		// Without a process state the binary could not be started at all.
+		smartctlAvailable.Store(err == nil || cmd.ProcessState != nil)
+	}
+	if ctx.Err() != nil {
+		return out, fmt.Errorf("smartctl killed after %s: %w", timeout, ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if *smartctlSudo && target == "" && errors.As(err, &exitErr) && strings.HasPrefix(string(exitErr.Stderr), "sudo:") {
+		return out, fmt.Errorf("%w: %s", errSudo, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return out, err
+}
+
+// runTool runs a tool other than smartctl, such as nvme-cli or a RAID
+// controller utility. Like smartctl it is killed after smartctl.timeout, a
+// hung tool would otherwise block the collection.
+func runTool(path string, args ...string) ([]byte, error) {
+	timeout := currentSettings().timeout
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return out, fmt.Errorf("%s killed after %s: %w", path, timeout, ctx.Err())
+	}
+	return out, err
+}
+
+// readSMARTctlText reads the device with the text output of smartctl -a,
+// for smartctl versions without --json. See parseSMARTctlText.
+func readSMARTctlText(logger log.Logger, device Device) (gjson.Result, error) {
+	args := append([]string{"-a", "--nocheck=" + *smartctlNocheck}, smartctlDeviceArgs(device)...)
+	out, err := runSmartctlOn(device.Target, args...)
+	exitStatus := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitStatus = exitErr.ExitCode()
+	} else if err != nil {
+		return gjson.Result{}, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return gjson.Result{}, errors.New("no smartctl output")
+	}
+	level.Debug(logger).Log("msg", "S.M.A.R.T. data read from the text output", "device", device.Info_Name)
+	return parseSMARTctlText(device, string(out), exitStatus), nil
+}
 
-	args := []string{"--json", "--info", "--health", "--attributes", "--tolerance=verypermissive", "--nocheck=standby", "--format=brief", "--log=error", device.Name}
-	if strings.Contains(device.Type, CcissType) || strings.Contains(device.Type, MegaraidType) {
+// smartctlDeviceArgs returns the smartctl arguments addressing the device.
+// Scanned types other than the RAID controller ones are detected by smartctl
+// anyway, explicitly given types are always passed on. The extra arguments
+// of the device come last.
+func smartctlDeviceArgs(device Device) []string {
+	args := []string{device.Name}
+	explicit := device.TypeSource != "" && device.TypeSource != TypeSourceScan && device.TypeSource != TypeSourceSat
+	if strings.Contains(device.Type, CcissType) || strings.Contains(device.Type, MegaraidType) ||
+		(explicit && device.Type != "" && device.Type != "auto") {
 		args = append(args, "-d", device.Type)
 	}
+	return append(args, strings.Fields(device.ExtraArgs)...)
+}
+
+// readSMARTctlInfo reads only the device information, without waking up
+// sleeping devices. It is used to filter devices during scanning.
+func readSMARTctlInfo(logger log.Logger, device Device) gjson.Result {
+	args := append([]string{"--json", "--info", "--nocheck=" + *smartctlNocheck}, smartctlDeviceArgs(device)...)
+	out, err := runSmartctl(args...)
+	if err != nil {
+		level.Debug(logger).Log("msg", "S.M.A.R.T. info reading", "err", err, "device", device.Info_Name)
+	}
+	return parseJSON(string(out))
+}
 
-	out, err := exec.Command(*smartctlPath, args...).Output()
+// Get json from smartctl and parse it. A *CollectError is returned when the
+// output holds no usable data.
+func readSMARTctl(logger log.Logger, device Device) (gjson.Result, error) {
+	start := time.Now()
+
+	var json gjson.Result
+	var err error
+	if *smartctlTextFallback && smartctlJSONUnsupported.Load() {
+		// Known from smartctl --version, so --json is not tried first.
+		json, err = readSMARTctlText(logger, device)
+	} else {
+		args := []string{"--json", "--info", "--health", "--attributes", "--capabilities", "--tolerance=verypermissive", "--nocheck=" + *smartctlNocheck, "--format=brief", "--log=error", "--log=selftest", "--log=sataphy"}
+		args = append(args, smartctlDeviceArgs(device)...)
+
+		var out []byte
+		out, err = runSmartctlOn(device.Target, args...)
+		json = parseJSON(string(out))
+		if *smartctlTextFallback && !gjson.Valid(string(out)) &&
+			!errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, errSudo) {
+			smartctlSubprocessTotal.Add(1)
+			json, err = readSMARTctlText(logger, device)
+		}
+	}
+	subprocessDurations.Store(device, time.Since(start))
 	if err != nil {
 		level.Warn(logger).Log("msg", "S.M.A.R.T. output reading", "err", err, "device", device.Info_Name)
 	}
-	json := parseJSON(string(out))
+	deviceType := device.Type
+	if deviceType == "" {
+		deviceType = GetStringIfExists(json, "device.type", "unknown")
+	}
+	// Keep one series per type, not per RAID disk, e.g. megaraid for
+	// megaraid,12.
+	deviceType, _, _ = strings.Cut(deviceType, ",")
+	metricScrapeDuration.WithLabelValues(deviceType).Observe(time.Since(start).Seconds())
+	smartctlSubprocessTotal.Add(1)
+	if errors.Is(err, context.DeadlineExceeded) {
+		smartctlSubprocessFailures.Add(1)
+		return gjson.Result{}, &CollectError{Reason: CollectReasonTimeout, Time: time.Now()}
+	}
+	if errors.Is(err, errSudo) {
+		smartctlSubprocessFailures.Add(1)
+		return gjson.Result{}, &CollectError{Reason: CollectReasonSudo, Time: time.Now()}
+	}
+	// Without any output smartctl could not be run at all.
+	if !json.Get("smartctl").Exists() {
+		smartctlSubprocessFailures.Add(1)
+		return gjson.Result{}, &CollectError{Reason: CollectReasonFailed, Time: time.Now()}
+	}
 	rcOk := resultCodeIsOk(logger, device, json.Get("smartctl.exit_status").Int())
 	jsonOk := jsonIsOk(logger, json)
 	level.Debug(logger).Log("msg", "Collected S.M.A.R.T. json data", "device", device.Info_Name, "duration", time.Since(start))
-	return json, rcOk && jsonOk
+	if rcOk && jsonOk {
+		return json, nil
+	}
+	collectErr := newCollectError(json)
+	// Locked drives are expected to fail until they are unlocked, drives in
+	// a low-power mode are skipped on purpose.
+	if collectErr.Reason != CollectReasonLocked && collectErr.Reason != CollectReasonStandby {
+		smartctlSubprocessFailures.Add(1)
+	}
+	return json, collectErr
 }
 
 func readSMARTctlDevices(logger log.Logger, args ...string) gjson.Result {
 	level.Debug(logger).Log("msg", "Scanning for devices")
-	args = append([]string{"--json", "--scan"}, args...)
-	out, err := exec.Command(*smartctlPath, args...).Output()
+	var out []byte
+	var err error
+	if !*smartctlTextFallback || !smartctlJSONUnsupported.Load() {
+		out, err = runSmartctl(append([]string{"--json", "--scan"}, args...)...)
+	}
+	if *smartctlTextFallback && !gjson.Valid(string(out)) {
+		level.Debug(logger).Log("msg", "Scanning for devices with the text output")
+		out, err = runSmartctl(append([]string{"--scan"}, args...)...)
+		if err != nil {
+			level.Warn(logger).Log("msg", "S.M.A.R.T. output reading error", "err", err)
+			return gjson.Result{}
+		}
+		return parseSMARTctlScanText(string(out))
+	}
 	if exiterr, ok := err.(*exec.ExitError); ok {
 		level.Debug(logger).Log("msg", "Exit Status", "exit_code", exiterr.ExitCode())
 		// The smartctl command returns 2 if devices are sleeping, ignore this error.
@@ -102,13 +341,14 @@ func formatDevices(logger log.Logger, raid gjson.Result) []Device {
 	devices := []Device{}
 
 	device := Device{
-		Name:      raid.Get("name").String(),
-		Info_Name: extractDiskName(strings.TrimSpace(raid.Get("name").String())),
-		Type:      CcissType,
+		Name:       raid.Get("name").String(),
+		Info_Name:  extractDiskName(strings.TrimSpace(raid.Get("name").String())),
+		Type:       CcissType,
+		TypeSource: TypeSourceSat,
 	}
 
 	level.Debug(logger).Log("raid_device: ", device.Info_Name)
-	out, err := exec.Command(*ccissVolStatusPath, device.Name, "-V").Output()
+	out, err := runTool(*ccissVolStatusPath, device.Name, "-V")
 	if exiterr, ok := err.(*exec.ExitError); ok {
 		level.Debug(logger).Log("msg", "Exit Status", "exit_code", exiterr.ExitCode())
 		// 0 - All configured logical drives queried have status of "OK."
@@ -143,11 +383,45 @@ func readData(logger log.Logger, device Device) gjson.Result {
 	if *smartctlFakeData {
 		return readFakeSMARTctl(logger, device)
 	}
+	if device.TypeSource == TypeSourceFakeJSON {
+		return readFakeJSON(logger, device)
+	}
+
+	if inMaintenance() {
+		if cacheValue, ok := jsonCache.Load(device); ok {
+			return cacheValue.(JSONCache).JSON
+		}
+		return gjson.Result{}
+	}
+
+	// Reading a locked drive fails until it is unlocked, it is retried only
+	// once per interval.
+	if collectErr, ok := lastCollectError(device); ok && collectErr.Reason == CollectReasonLocked &&
+		time.Now().Before(collectErr.Time.Add(currentSettings().interval)) {
+		return gjson.Result{}
+	}
 
 	cacheValue, cacheOk := jsonCache.Load(device)
-	if !cacheOk || time.Now().After(cacheValue.(JSONCache).LastCollect.Add(*smartctlInterval)) {
-		json, ok := readSMARTctl(logger, device)
-		if ok {
+	if !cacheOk || time.Now().After(cacheValue.(JSONCache).LastCollect.Add(currentSettings().interval)) {
+		json, err := readSMARTctl(logger, device)
+		waited := time.Duration(0)
+		for retry := 1; retry <= *smartctlRetries && transientCollectError(json, err); retry++ {
+			backoff := retryBackoff << (retry - 1)
+			if waited+backoff > retryBudget {
+				break
+			}
+			waited += backoff
+			level.Debug(logger).Log("msg", "Retrying S.M.A.R.T. data reading", "device", device.Info_Name, "retry", retry, "backoff", backoff, "err", err)
+			time.Sleep(backoff)
+			retries, _ := collectRetries.LoadOrStore(device, new(atomic.Uint64))
+			retries.(*atomic.Uint64).Add(1)
+			json, err = readSMARTctl(logger, device)
+		}
+		if err != nil {
+			level.Debug(logger).Log("msg", "S.M.A.R.T. data not collected", "device", device.Info_Name, "err", err)
+			collectErrors.Store(device, err)
+		} else {
+			collectErrors.Delete(device)
 			jsonCache.Store(device, JSONCache{JSON: json, LastCollect: time.Now()})
 			j, found := jsonCache.Load(device)
 			if !found {
@@ -160,6 +434,42 @@ func readData(logger log.Logger, device Device) gjson.Result {
 	return cacheValue.(JSONCache).JSON
 }
 
+// lastCollect returns when the cached data of the device was read, that is
+// the last successful read.
+func lastCollect(device Device) (time.Time, bool) {
+	cacheValue, ok := jsonCache.Load(device)
+	if !ok {
+		return time.Time{}, false
+	}
+	return cacheValue.(JSONCache).LastCollect, true
+}
+
+// forgetDevice drops the state kept for a device that is no longer read, so
+// devices coming and going do not grow the memory of the exporter.
+func forgetDevice(device Device) {
+	jsonCache.Delete(device)
+	subprocessDurations.Delete(device)
+	collectRetries.Delete(device)
+	collectErrors.Delete(device)
+	ocpCache.Delete(device)
+	deviceLabels.Delete(device)
+	logPageCache.Range(func(key, _ any) bool {
+		if key.(logPageCacheKey).device == device {
+			logPageCache.Delete(key)
+		}
+		return true
+	})
+}
+
+// cacheAge returns how long ago the cached data of the device was read.
+func cacheAge(device Device) (time.Duration, bool) {
+	collected, ok := lastCollect(device)
+	if !ok {
+		return 0, false
+	}
+	return time.Since(collected), true
+}
+
 // Parse smartctl return code
 func resultCodeIsOk(logger log.Logger, device Device, SMARTCtlResult int64) bool {
 	result := true
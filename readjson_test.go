@@ -0,0 +1,236 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestScrapeDurationType checks that RAID disks share the series of their
+// device type.
+func TestScrapeDurationType(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	smartctl := filepath.Join(t.TempDir(), "smartctl")
+	script := `#!/bin/sh
+echo '{"smartctl":{"exit_status":0},"device":{"type":"megaraid,12"}}'
+`
+	if err := os.WriteFile(smartctl, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	*smartctlPath = smartctl
+	defer func() { *smartctlPath = saved }()
+	devices := []Device{
+		{Name: "/dev/bus/0", Info_Name: "bus_0_megaraid_disk_12", Type: "megaraid,12"},
+		{Name: "/dev/bus/0", Info_Name: "bus_0_megaraid_disk_13", Type: "megaraid,13"},
+		{Name: "/dev/sdy", Info_Name: "sdy"},
+	}
+	for _, device := range devices {
+		defer forgetDevice(device)
+		readSMARTctl(log.NewNopLogger(), device)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(metricScrapeDuration)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := map[string]bool{}
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				types[label.GetValue()] = true
+			}
+		}
+	}
+	for _, typ := range []string{"megaraid,12", "megaraid,13"} {
+		if types[typ] {
+			t.Errorf("type %s not trimmed", typ)
+		}
+	}
+	if !types["megaraid"] {
+		t.Errorf("types = %v, want megaraid", types)
+	}
+}
+
+// TestSubprocessCounters checks which smartctl runs count as failed.
+func TestSubprocessCounters(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	saved := *smartctlPath
+	defer func() { *smartctlPath = saved }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	defer forgetDevice(device)
+
+	tests := []struct {
+		name   string
+		script string
+		failed uint64
+	}{
+		{"success", `echo '{"smartctl":{"exit_status":0},"device":{"protocol":"ATA"}}'`, 0},
+		{"no output", "exit 1", 1},
+		{"open failed", `echo '{"smartctl":{"exit_status":2,"messages":[{"string":"Smartctl open device: /dev/sda failed: No such device","severity":"error"}]}}'; exit 2`, 1},
+		{"standby", `echo '{"smartctl":{"exit_status":2,"messages":[{"string":"Device is in STANDBY mode, exit(2)","severity":"information"}]},"power_mode":"STANDBY"}'; exit 2`, 0},
+	}
+	for _, test := range tests {
+		*smartctlPath = writeShim(t, dir, "smartctl-"+strings.ReplaceAll(test.name, " ", "-"), test.script+"\n")
+		total, failures := smartctlSubprocessTotal.Load(), smartctlSubprocessFailures.Load()
+		readSMARTctl(log.NewNopLogger(), device)
+		if got := smartctlSubprocessTotal.Load() - total; got != 1 {
+			t.Errorf("%s: %d runs counted, want 1", test.name, got)
+		}
+		if got := smartctlSubprocessFailures.Load() - failures; got != test.failed {
+			t.Errorf("%s: %d failures counted, want %d", test.name, got, test.failed)
+		}
+	}
+}
+
+// TestReadSMARTctlTimeout checks that a hung smartctl is killed after
+// smartctl.timeout, even with a child process keeping its output open.
+func TestReadSMARTctlTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	saved, timeout := *smartctlPath, *smartctlTimeout
+	*smartctlPath = writeShim(t, t.TempDir(), "smartctl", "sleep 10\n")
+	*smartctlTimeout = 100 * time.Millisecond
+	defer func() { *smartctlPath, *smartctlTimeout = saved, timeout }()
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	defer forgetDevice(device)
+
+	start := time.Now()
+	_, err := readSMARTctl(log.NewNopLogger(), device)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("smartctl not killed, reading took %s", elapsed)
+	}
+	var collectErr *CollectError
+	if !errors.As(err, &collectErr) || collectErr.Reason != CollectReasonTimeout {
+		t.Errorf("err = %v, want a %s collect error", err, CollectReasonTimeout)
+	}
+}
+
+func TestSmartctlDeviceArgs(t *testing.T) {
+	for _, test := range []struct {
+		device Device
+		want   string
+	}{
+		{Device{Name: "/dev/sda", Type: "sat", TypeSource: TypeSourceScan}, "/dev/sda"},
+		{Device{Name: "/dev/sda", Type: "sat", TypeSource: TypeSourceSat}, "/dev/sda"},
+		{Device{Name: "/dev/sda", Type: "sat", TypeSource: TypeSourceConfig}, "/dev/sda -d sat"},
+		{Device{Name: "/dev/sda", Type: "auto", TypeSource: TypeSourceConfig}, "/dev/sda"},
+		{Device{Name: "/dev/sda", TypeSource: TypeSourceProbe}, "/dev/sda"},
+		{Device{Name: "/dev/bus/0", Type: "megaraid,12", TypeSource: TypeSourceScan}, "/dev/bus/0 -d megaraid,12"},
+		{Device{Name: "/dev/sg1", Type: "sat+cciss,2"}, "/dev/sg1 -d sat+cciss,2"},
+		{Device{Name: "/dev/sda", Type: "sat", TypeSource: TypeSourceConfig, ExtraArgs: "--nocheck=never  -T permissive"}, "/dev/sda -d sat --nocheck=never -T permissive"},
+	} {
+		if got := strings.Join(smartctlDeviceArgs(test.device), " "); got != test.want {
+			t.Errorf("%+v: args %q, want %q", test.device, got, test.want)
+		}
+	}
+}
+
+// TestLoadDevicesExtraArgs checks that smartctl.device-args applies to the
+// devices without arguments in the config file.
+func TestLoadDevicesExtraArgs(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{
+		"--smartctl.device-args=/dev/sda=--nocheck=never",
+		"--smartctl.device-args=/dev/sdb=-T permissive",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer kingpin.CommandLine.Parse(nil)
+	config := &Config{Devices: []ConfigDevice{
+		{Name: "/dev/sda"},
+		{Name: "/dev/sdb", Args: []string{"--nocheck=idle"}},
+		{Name: "/dev/sdc"},
+	}}
+	args := map[string]string{}
+	for _, device := range loadDevices(log.NewNopLogger(), log.NewNopLogger(), config) {
+		args[device.Name] = device.ExtraArgs
+	}
+	want := map[string]string{"/dev/sda": "--nocheck=never", "/dev/sdb": "--nocheck=idle", "/dev/sdc": ""}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+// TestSmartctlAvailable checks that only a binary failing to start counts as
+// unavailable, not smartctl exiting with an error.
+func TestSmartctlAvailable(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	defer func() {
+		*smartctlPath = saved
+		smartctlAvailable.Store(true)
+	}()
+	dir := t.TempDir()
+	for _, test := range []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(dir, "missing"), false},
+		{writeShim(t, dir, "smartctl", "exit 2\n"), true},
+		{filepath.Join(dir, "missing"), false},
+		{writeShim(t, dir, "smartctl", "echo '{}'\n"), true},
+	} {
+		*smartctlPath = test.path
+		runSmartctl("--json", "--version")
+		if got := smartctlAvailable.Load(); got != test.want {
+			t.Errorf("%s: available %t, want %t", test.path, got, test.want)
+		}
+	}
+
+	// Remote runs do not change the local state.
+	template := *remoteCommandTemplate
+	*remoteCommandTemplate = filepath.Join(dir, "missing") + " {target}"
+	defer func() { *remoteCommandTemplate = template }()
+	runSmartctlOn("db1", "--json", "--version")
+	if !smartctlAvailable.Load() {
+		t.Error("failed remote run marked the local smartctl unavailable")
+	}
+
+	*smartctlPath = filepath.Join(dir, "missing")
+	runSmartctl("--json", "--version")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&SMARTctlManagerCollector{
+		SuccessRatios: newSuccessRatios(),
+		logger:        log.NewNopLogger(),
+		collections:   map[string]uint64{},
+		failures:      map[string]uint64{},
+	})
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available, ok := familyValue(families, "smartctl_binary_available"); !ok || available != 0 {
+		t.Errorf("smartctl_binary_available = %v (%t), want 0", available, ok)
+	}
+}
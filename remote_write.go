@@ -0,0 +1,194 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWriter pushes the gathered metrics to a Prometheus remote write
+// endpoint, for hosts that cannot be scraped.
+type RemoteWriter struct {
+	URL             string
+	BearerTokenFile string
+	Labels          map[string]string
+
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	logger   log.Logger
+}
+
+func newRemoteWriter(url string, gatherer prometheus.Gatherer, logger log.Logger) *RemoteWriter {
+	labels := map[string]string{"job": "smartctl_exporter"}
+	if hostname, err := os.Hostname(); err == nil {
+		labels["instance"] = hostname
+	}
+	return &RemoteWriter{
+		URL:      url,
+		Labels:   labels,
+		gatherer: gatherer,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		logger:   logger,
+	}
+}
+
+// Run pushes the metrics each interval, read anew after every push so a
+// reloaded config applies. Failed pushes are not retried, the next push
+// sends the then current values.
+func (w *RemoteWriter) Run() {
+	for {
+		if err := w.push(); err != nil {
+			level.Warn(w.logger).Log("msg", "Remote write failed", "url", w.URL, "err", err)
+		}
+		time.Sleep(currentSettings().interval)
+	}
+}
+
+func (w *RemoteWriter) push() error {
+	families, err := w.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(families, w.Labels, time.Now().UnixMilli()))
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "smartctl_exporter/"+version.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.BearerTokenFile != "" {
+		token, err := os.ReadFile(w.BearerTokenFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	level.Debug(w.logger).Log("msg", "Remote write succeeded", "url", w.URL, "families", len(families))
+	return nil
+}
+
+// encodeWriteRequest encodes the metric families as remote write
+// WriteRequest protobuf message. Histograms and summaries are split into
+// their classic series.
+func encodeWriteRequest(families []*dto.MetricFamily, extraLabels map[string]string, timestamp int64) []byte {
+	var request []byte
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for k, v := range extraLabels {
+				labels[k] = v
+			}
+			for _, pair := range metric.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			addSeries := func(suffix string, value float64, extra ...string) {
+				series := map[string]string{}
+				for k, v := range labels {
+					series[k] = v
+				}
+				for i := 0; i+1 < len(extra); i += 2 {
+					series[extra[i]] = extra[i+1]
+				}
+				series["__name__"] = name + suffix
+				request = protowire.AppendTag(request, 1, protowire.BytesType)
+				request = protowire.AppendBytes(request, encodeTimeSeries(series, value, timestamp))
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				addSeries("", metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				addSeries("", metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				addSeries("", metric.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, q := range summary.GetQuantile() {
+					addSeries("", q.GetValue(), "quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64))
+				}
+				addSeries("_sum", summary.GetSampleSum())
+				addSeries("_count", float64(summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				for _, b := range histogram.GetBucket() {
+					addSeries("_bucket", float64(b.GetCumulativeCount()), "le", strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64))
+				}
+				addSeries("_bucket", float64(histogram.GetSampleCount()), "le", "+Inf")
+				addSeries("_sum", histogram.GetSampleSum())
+				addSeries("_count", float64(histogram.GetSampleCount()))
+			}
+		}
+	}
+	return request
+}
+
+// encodeTimeSeries encodes a TimeSeries message with a single sample. Remote
+// write requires the labels sorted by name.
+func encodeTimeSeries(labels map[string]string, value float64, timestamp int64) []byte {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var series []byte
+	for _, name := range names {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, name)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, labels[name])
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, label)
+	}
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+	sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(timestamp))
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+	return series
+}
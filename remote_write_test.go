@@ -0,0 +1,147 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// writeRequestDescriptor returns the WriteRequest message of the remote
+// write protocol, prometheus/prompb/remote.proto and types.proto.
+func writeRequestDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, message string, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: kind.Enum(), Label: label.Enum()}
+		if message != "" {
+			f.TypeName = proto.String(".prometheus." + message)
+		}
+		return f
+	}
+	message := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("remote.proto"),
+		Package: proto.String("prometheus"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("WriteRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("timeseries", 1, message, "TimeSeries", true),
+			}},
+			{Name: proto.String("TimeSeries"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("labels", 1, message, "Label", true),
+				field("samples", 2, message, "Sample", true),
+			}},
+			{Name: proto.String("Label"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+				field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+			}},
+			{Name: proto.String("Sample"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("value", 1, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, "", false),
+				field("timestamp", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, "", false),
+			}},
+		},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Messages().ByName("WriteRequest")
+}
+
+// TestRemoteWriteRequest decodes a pushed request with the reference snappy
+// and protobuf implementations.
+func TestRemoteWriteRequest(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	temperature := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "smartctl_device_temperature",
+		Help: "Temperature",
+	}, []string{"device"})
+	temperature.WithLabelValues("sda").Set(30.5)
+	reg.MustRegister(temperature)
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "smartctl_scrape_duration_seconds",
+		Help:    "Duration",
+		Buckets: []float64{1},
+	})
+	duration.Observe(0.5)
+	reg.MustRegister(duration)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(families, map[string]string{"job": "smartctl_exporter"}, 1700000000000))
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := dynamicpb.NewMessage(writeRequestDescriptor(t))
+	if err := proto.Unmarshal(data, request); err != nil {
+		t.Fatal(err)
+	}
+	if unknown := request.GetUnknown(); len(unknown) > 0 {
+		t.Errorf("unknown fields in the request: %x", unknown)
+	}
+
+	got := map[string]float64{}
+	series := request.Get(request.Descriptor().Fields().ByName("timeseries")).List()
+	for i := 0; i < series.Len(); i++ {
+		ts := series.Get(i).Message()
+		labels := ts.Get(ts.Descriptor().Fields().ByName("labels")).List()
+		key, previous := "", ""
+		for j := 0; j < labels.Len(); j++ {
+			label := labels.Get(j).Message()
+			name := label.Get(label.Descriptor().Fields().ByName("name")).String()
+			if name < previous {
+				t.Errorf("labels not sorted: %s after %s", name, previous)
+			}
+			previous = name
+			key += name + "=" + label.Get(label.Descriptor().Fields().ByName("value")).String() + ","
+		}
+		samples := ts.Get(ts.Descriptor().Fields().ByName("samples")).List()
+		if samples.Len() != 1 {
+			t.Fatalf("%s: %d samples, want 1", key, samples.Len())
+		}
+		sample := samples.Get(0).Message()
+		if timestamp := sample.Get(sample.Descriptor().Fields().ByName("timestamp")).Int(); timestamp != 1700000000000 {
+			t.Errorf("%s: timestamp %d", key, timestamp)
+		}
+		got[key] = sample.Get(sample.Descriptor().Fields().ByName("value")).Float()
+	}
+
+	for key, value := range map[string]float64{
+		"__name__=smartctl_device_temperature,device=sda,job=smartctl_exporter,":          30.5,
+		"__name__=smartctl_scrape_duration_seconds_bucket,job=smartctl_exporter,le=1,":    1,
+		"__name__=smartctl_scrape_duration_seconds_bucket,job=smartctl_exporter,le=+Inf,": 1,
+		"__name__=smartctl_scrape_duration_seconds_count,job=smartctl_exporter,":          1,
+		"__name__=smartctl_scrape_duration_seconds_sum,job=smartctl_exporter,":            0.5,
+	} {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+	if len(got) != 5 {
+		t.Errorf("%d series, want 5: %v", len(got), got)
+	}
+}
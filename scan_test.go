@@ -0,0 +1,118 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+)
+
+func TestParseScannedDevicesMegaraid(t *testing.T) {
+	scan, err := os.ReadFile("testdata/scan/megaraid_two_controllers.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices, _ := parseScannedDevices(log.NewNopLogger(), parseJSON(string(scan)))
+
+	var got []Device
+	for _, d := range devices {
+		got = append(got, Device{Name: d.Name, Info_Name: d.Info_Name, Type: d.Type})
+	}
+	want := []Device{
+		{Name: "/dev/sda", Info_Name: "sda", Type: "scsi"},
+		{Name: "/dev/sdb", Info_Name: "sdb", Type: "scsi"},
+		{Name: "/dev/bus/0", Info_Name: "bus_0_megaraid_disk_08", Type: "megaraid,8"},
+		{Name: "/dev/bus/0", Info_Name: "bus_0_megaraid_disk_09", Type: "megaraid,9"},
+		{Name: "/dev/bus/0", Info_Name: "bus_0_megaraid_disk_33", Type: "megaraid,33"},
+		{Name: "/dev/bus/1", Info_Name: "bus_1_megaraid_disk_08", Type: "megaraid,8"},
+		{Name: "/dev/bus/1", Info_Name: "bus_1_megaraid_disk_09", Type: "megaraid,9"},
+		{Name: "/dev/nvme0", Info_Name: "nvme0", Type: "nvme"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseScannedDevices() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+// fakeScan sets smartctl to a script listing sda and sdb, or failing if
+// fail is set.
+func fakeScan(t *testing.T, fail bool) {
+	script := `case "$*" in
+*"-d sat"*) echo '{"smartctl":{"exit_status":0},"devices":[]}' ;;
+*--scan*) echo '{"smartctl":{"exit_status":0},"devices":[{"name":"/dev/sda","info_name":"/dev/sda","type":"sat"},{"name":"/dev/sdb","info_name":"/dev/sdb","type":"sat"}]}' ;;
+*) echo '{"smartctl":{"exit_status":0}}' ;;
+esac
+`
+	if fail {
+		script = "exit 1\n"
+	}
+	*smartctlPath = writeShim(t, t.TempDir(), "smartctl", script)
+}
+
+func TestLastScan(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	saved, scanned := *smartctlPath, lastScan.Load()
+	defer func() { *smartctlPath = saved; lastScan.Store(scanned) }()
+
+	lastScan.Store(0)
+	fakeScan(t, true)
+	scanDevices(log.NewNopLogger(), deviceFilter{})
+	if got := lastScan.Load(); got != 0 {
+		t.Errorf("failed scan recorded at %d", got)
+	}
+	start := time.Now().Unix()
+	fakeScan(t, false)
+	scanDevices(log.NewNopLogger(), deviceFilter{})
+	if got := lastScan.Load(); got < start {
+		t.Errorf("scan recorded at %d, want at least %d", got, start)
+	}
+}
+
+func TestScanMetrics(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	defer func() { *smartctlPath = saved }()
+
+	before := scans.Load()
+	fakeScan(t, false)
+	devices := scanDevices(log.NewNopLogger(), newDeviceFilter("sdb", ""))
+	if got := scans.Load() - before; got != 1 {
+		t.Errorf("%d scans counted, want 1", got)
+	}
+	// Ignored devices are not counted as found.
+	if got := scanDevicesFound.Load(); got != 1 || len(devices) != 1 {
+		t.Errorf("%d devices found (%d returned), want 1", got, len(devices))
+	}
+	if scanDuration.Load() <= 0 {
+		t.Errorf("scan duration %s, want above 0", time.Duration(scanDuration.Load()))
+	}
+
+	// Failed scans are counted too.
+	fakeScan(t, true)
+	scanDevices(log.NewNopLogger(), deviceFilter{})
+	if got := scans.Load() - before; got != 2 {
+		t.Errorf("%d scans counted, want 2", got)
+	}
+	if got := scanDevicesFound.Load(); got != 0 {
+		t.Errorf("%d devices found by a failed scan, want 0", got)
+	}
+}
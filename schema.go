@@ -0,0 +1,125 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/tidwall/gjson"
+)
+
+// schemaVersion is the smartctl version that printed the JSON output. Some
+// fields are reported in different places depending on the version, the
+// protocol and whether the text fallback was used.
+type schemaVersion struct {
+	major, minor int64
+}
+
+// jsonSchemaVersion returns the smartctl version of the output, zero if it
+// is unknown.
+func jsonSchemaVersion(json gjson.Result) schemaVersion {
+	version := json.Get("smartctl.version").Array()
+	if len(version) < 2 {
+		return schemaVersion{}
+	}
+	return schemaVersion{major: version[0].Int(), minor: version[1].Int()}
+}
+
+// before returns whether v is known and older than other.
+func (v schemaVersion) before(other schemaVersion) bool {
+	if v == (schemaVersion{}) {
+		return false
+	}
+	return v.major < other.major || (v.major == other.major && v.minor < other.minor)
+}
+
+// schemaPath is a gjson path a field is read from, for output of smartctl
+// since the given version.
+type schemaPath struct {
+	path  string
+	since schemaVersion
+}
+
+// schemaFields are the paths the fields are read from, in order of
+// preference. The first existing path of a version is used.
+var schemaFields = map[string][]schemaPath{
+	"model_name": {
+		{path: "model_name"},
+		{path: "scsi_model_name"},
+	},
+	"firmware_version": {
+		{path: "firmware_version"},
+		{path: "scsi_revision"},
+	},
+	// NVMe devices with multiple namespaces only report the total capacity.
+	"capacity_bytes": {
+		{path: "user_capacity.bytes"},
+		{path: "nvme_total_capacity"},
+	},
+	"temperature": {
+		{path: "temperature.current"},
+		{path: "nvme_smart_health_information_log.temperature"},
+		{path: "scsi_environmental_reports.temperature_1.current", since: schemaVersion{7, 4}},
+	},
+	// Older smartctl versions only report the power-on time in the NVMe log
+	// or the ATA attribute table.
+	"power_on_hours": {
+		{path: "power_on_time.hours"},
+		{path: "nvme_smart_health_information_log.power_on_hours"},
+		{path: `ata_smart_attributes.table.#(name=="Power_On_Hours").raw.value`},
+	},
+	"power_on_minutes": {
+		{path: "power_on_time.minutes"},
+	},
+	"power_cycles": {
+		{path: "power_cycle_count"},
+		{path: "scsi_start_stop_cycle_counter.accumulated_start_stop_cycles"},
+		{path: "nvme_smart_health_information_log.power_cycles"},
+		{path: `ata_smart_attributes.table.#(name=="Power_Cycle_Count").raw.value`},
+	},
+}
+
+// schemaField returns the field of the smartctl output, read from the path
+// matching its smartctl version.
+func schemaField(json gjson.Result, field string) gjson.Result {
+	version := jsonSchemaVersion(json)
+	for _, path := range schemaFields[field] {
+		if version.before(path.since) {
+			continue
+		}
+		if value := json.Get(path.path); value.Exists() {
+			return value
+		}
+	}
+	return gjson.Result{}
+}
+
+// unknownJSONFormats are the json_format_version major versions already
+// warned about.
+var unknownJSONFormats sync.Map
+
+// checkJSONFormatVersion warns once per version about output of a JSON
+// format other than 1, its fields may have moved without the exporter
+// knowing.
+func checkJSONFormatVersion(logger log.Logger, json gjson.Result) {
+	version := json.Get("json_format_version.0")
+	if !version.Exists() || version.Int() == 1 {
+		return
+	}
+	if _, warned := unknownJSONFormats.LoadOrStore(version.Int(), true); !warned {
+		level.Warn(logger).Log("msg", "Unknown smartctl JSON format version, metrics may be missing", "json_format_version", version.Int())
+	}
+}
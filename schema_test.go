@@ -0,0 +1,157 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/tidwall/gjson"
+)
+
+// collectedDescs returns the descriptors of the metrics collected from the
+// smartctl output.
+func collectedDescs(json gjson.Result) map[*prometheus.Desc]bool {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		smart := NewSMARTctl(log.NewNopLogger(), json, ch)
+		smart.Collect()
+		close(ch)
+	}()
+	descs := map[*prometheus.Desc]bool{}
+	for metric := range ch {
+		descs[metric.Desc()] = true
+	}
+	return descs
+}
+
+func TestSchemaVersions(t *testing.T) {
+	common := []*prometheus.Desc{
+		metricDeviceModel,
+		metricDeviceSmartStatus,
+		metricDeviceTemperature,
+		metricDeviceCapacityBytes,
+	}
+	tests := []struct {
+		name string
+		file string
+		want []*prometheus.Desc
+	}{
+		{"6.2 ATA text", "testdata/text/ata.txt", []*prometheus.Desc{metricDevicePowerOnSeconds, metricDevicePowerCycleCount, metricDeviceReallocatedSectors}},
+		{"7.1 ATA", "testdata/sat-Dell_Certified_Intel_S3520_Series_SSDs-SSDSCKJB240G7R-sdm.json", []*prometheus.Desc{metricDevicePowerOnSeconds, metricDevicePowerCycleCount, metricDeviceReallocatedSectors}},
+		{"7.1 NVMe", "testdata/nvme-null-HUSMR7632BHP301-nvme0.json", []*prometheus.Desc{metricDevicePowerOnSeconds, metricDevicePowerCycleCount, metricDevicePercentageUsed}},
+		{"7.3 ATA", "testdata/HGST_HUS724020ALE640_28.json", []*prometheus.Desc{metricDevicePowerOnSeconds, metricDevicePowerCycleCount, metricDeviceReallocatedSectors}},
+		{"7.3 NVMe", "testdata/INTEL_SSDPE2KX080T8_1.json", []*prometheus.Desc{metricDevicePowerOnSeconds, metricDevicePowerCycleCount, metricDevicePercentageUsed}},
+		{"7.3 SCSI", "testdata/HITACHI_H109060SESUN600G_10.json", []*prometheus.Desc{metricDevicePowerOnSeconds, metricDevicePowerCycleCount, metricSCSIGrownDefectList}},
+		{"7.4 SCSI", "testdata/HP_73.4G_MAS3735NC_25.json", []*prometheus.Desc{metricSCSIGrownDefectList}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			json := parseJSON(string(data))
+			if !gjson.Valid(string(data)) {
+				json = parseSMARTctlText(Device{Name: "/dev/sda", Info_Name: "sda"}, string(data), 0)
+			}
+			descs := collectedDescs(json)
+			for _, desc := range append(common, tt.want...) {
+				if !descs[desc] {
+					t.Errorf("%s not collected", desc)
+				}
+			}
+		})
+	}
+}
+
+func TestSchemaField(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		field string
+		want  string
+	}{
+		{"ATA model", `{"model_name":"ST1000NM0033"}`, "model_name", "ST1000NM0033"},
+		{"SCSI model", `{"scsi_model_name":"HP MAS3735NC"}`, "model_name", "HP MAS3735NC"},
+		{"NVMe namespaces capacity", `{"nvme_total_capacity":1024}`, "capacity_bytes", "1024"},
+		{"NVMe log temperature", `{"nvme_smart_health_information_log":{"temperature":40}}`, "temperature", "40"},
+		{"7.4 environmental temperature", `{"smartctl":{"version":[7,4]},"scsi_environmental_reports":{"temperature_1":{"current":31}}}`, "temperature", "31"},
+		{"7.3 environmental temperature", `{"smartctl":{"version":[7,3]},"scsi_environmental_reports":{"temperature_1":{"current":31}}}`, "temperature", ""},
+		{"ATA attribute power-on hours", `{"ata_smart_attributes":{"table":[{"id":9,"name":"Power_On_Hours","raw":{"value":1200}}]}}`, "power_on_hours", "1200"},
+		{"ATA attribute power-on minutes", `{"ata_smart_attributes":{"table":[{"id":9,"name":"Power_On_Minutes","raw":{"value":1200}}]}}`, "power_on_hours", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schemaField(gjson.Parse(tt.json), tt.field).String(); got != tt.want {
+				t.Errorf("schemaField(%s) = %q, want %q", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSchemaTemperature checks that the current temperature is read through
+// the schema even if the output has a temperature object without it.
+func TestSchemaTemperature(t *testing.T) {
+	json := `{"smartctl":{"version":[7,4]},"temperature":{"drive_trip":70},"scsi_environmental_reports":{"temperature_1":{"current":31}}}`
+	ch := make(chan prometheus.Metric)
+	go func() {
+		smart := NewSMARTctl(log.NewNopLogger(), parseJSON(json), ch)
+		smart.mineTemperatures()
+		close(ch)
+	}()
+	temperatures := map[string]float64{}
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		for _, label := range m.Label {
+			if label.GetName() == "temperature_type" {
+				temperatures[label.GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	if temperatures["current"] != 31 || temperatures["drive_trip"] != 70 {
+		t.Errorf("temperatures = %v, want current 31 and drive_trip 70", temperatures)
+	}
+}
+
+func TestJSONFormatVersion(t *testing.T) {
+	series := collectedSeries(t, `{"json_format_version":[1,0],"smartctl":{"version":[7,4],"exit_status":0}}`)
+	if got := series["smartctl_device_json_format_version{1.0,7.4}"]; got != 1 {
+		t.Errorf("smartctl_device_json_format_version{1.0,7.4} = %v, want 1", got)
+	}
+	series = collectedSeries(t, `{"json_format_version":[1,0],"smartctl":{"exit_status":0}}`)
+	for key := range series {
+		if strings.HasPrefix(key, "smartctl_device_json_format_version") {
+			t.Errorf("%s collected without the smartctl version", key)
+		}
+	}
+
+	// Unknown format versions are warned about once.
+	var buf bytes.Buffer
+	logger := log.NewLogfmtLogger(&buf)
+	for _, json := range []string{`{"json_format_version":[1,0]}`, `{"json_format_version":[99,0]}`, `{"json_format_version":[99,1]}`} {
+		checkJSONFormatVersion(logger, gjson.Parse(json))
+	}
+	if got := strings.Count(buf.String(), "json_format_version=99"); got != 1 {
+		t.Errorf("%d warnings about format version 99, want 1:\n%s", got, buf.String())
+	}
+}
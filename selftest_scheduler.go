@@ -0,0 +1,159 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// selfTestKey identifies the triggered self-tests of one type on a device.
+type selfTestKey struct {
+	device   string
+	testType string
+}
+
+// SelfTestScheduler starts SMART self-tests on all collected devices at a
+// fixed interval. This writes to the devices, so it only runs when
+// explicitly enabled.
+type SelfTestScheduler struct {
+	collector *SMARTctlManagerCollector
+	logger    log.Logger
+	// start is the time of day (15:04) the runs are pinned to, empty to
+	// count the interval from the exporter start.
+	start string
+	// stagger is the delay between starting the self-tests of consecutive
+	// devices, so they do not all load the storage at once.
+	stagger time.Duration
+
+	mutex         sync.Mutex
+	triggered     map[selfTestKey]float64
+	lastTriggered map[selfTestKey]time.Time
+}
+
+func newSelfTestScheduler(collector *SMARTctlManagerCollector, logger log.Logger, start string, stagger time.Duration) *SelfTestScheduler {
+	return &SelfTestScheduler{
+		collector:     collector,
+		logger:        logger,
+		start:         start,
+		stagger:       stagger,
+		triggered:     map[selfTestKey]float64{},
+		lastTriggered: map[selfTestKey]time.Time{},
+	}
+}
+
+// parseSelfTestStart checks the time of day of smartctl.selftest-start.
+func parseSelfTestStart(start string) error {
+	if start == "" {
+		return nil
+	}
+	_, err := time.Parse("15:04", start)
+	return err
+}
+
+// nextSelfTestRun returns when the self-tests run next after now. With a
+// start time of day the runs happen at it and every interval from it, e.g.
+// within a maintenance window, otherwise the interval counts from now.
+func nextSelfTestRun(now time.Time, start string, interval time.Duration) time.Time {
+	clock, err := time.Parse("15:04", start)
+	if start == "" || err != nil {
+		return now.Add(interval)
+	}
+	year, month, day := now.Date()
+	anchor := time.Date(year, month, day, clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	// The number of intervals from the anchor to now, rounded down.
+	diff := now.Sub(anchor)
+	n := diff / interval
+	if diff < 0 && diff%interval != 0 {
+		n--
+	}
+	return anchor.Add((n + 1) * interval)
+}
+
+// Run starts a self-test of the given type ("short" or "long") on every
+// device each interval, the devices one stagger apart.
+func (s *SelfTestScheduler) Run(testType string, interval time.Duration) {
+	for {
+		next := nextSelfTestRun(time.Now(), s.start, interval)
+		level.Debug(s.logger).Log("msg", "Next self-tests", "type", testType, "time", next)
+		time.Sleep(time.Until(next))
+		if inMaintenance() {
+			level.Info(s.logger).Log("msg", "Skipping self-tests in maintenance mode", "type", testType)
+			continue
+		}
+		s.collector.mutex.Lock()
+		devices := append([]Device{}, s.collector.Devices...)
+		s.collector.mutex.Unlock()
+		for idx, device := range devices {
+			if idx > 0 {
+				time.Sleep(s.stagger)
+			}
+			s.trigger(device, testType)
+		}
+	}
+}
+
+func (s *SelfTestScheduler) trigger(device Device, testType string) {
+	// Never abort a running self-test by starting another one. Devices whose
+	// status cannot be read are skipped as well.
+	json, err := readSMARTctl(s.logger, device)
+	if err != nil {
+		level.Warn(s.logger).Log("msg", "Skipping self-test, device status unknown", "device", device.Info_Name, "err", err)
+		return
+	}
+	if inProgress, _, _ := selfTestProgress(json); inProgress {
+		level.Info(s.logger).Log("msg", "Skipping self-test, another one is in progress", "device", device.Info_Name)
+		return
+	}
+
+	args := append([]string{"--json", "--test=" + testType}, smartctlDeviceArgs(device)...)
+	out, err := runSmartctl(args...)
+	if err != nil || !jsonIsOk(s.logger, parseJSON(string(out))) {
+		level.Warn(s.logger).Log("msg", "Starting self-test failed", "device", device.Info_Name, "type", testType, "err", err)
+		return
+	}
+	level.Info(s.logger).Log("msg", "Started self-test", "device", device.Info_Name, "type", testType)
+
+	key := selfTestKey{device: device.Info_Name, testType: testType}
+	s.mutex.Lock()
+	s.triggered[key]++
+	s.lastTriggered[key] = time.Now()
+	s.mutex.Unlock()
+}
+
+// Collect sends the self-test trigger metrics.
+func (s *SelfTestScheduler) Collect(ch chan<- prometheus.Metric) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, count := range s.triggered {
+		ch <- prometheus.MustNewConstMetric(
+			metricDeviceSelfTestsTriggered,
+			prometheus.CounterValue,
+			count,
+			key.device,
+			key.testType,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricDeviceSelfTestLastTriggered,
+			prometheus.GaugeValue,
+			float64(s.lastTriggered[key].Unix()),
+			key.device,
+			key.testType,
+		)
+	}
+}
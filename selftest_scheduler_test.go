@@ -0,0 +1,103 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+)
+
+func TestNextSelfTestRun(t *testing.T) {
+	now := time.Date(2024, 3, 10, 6, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		start    string
+		interval time.Duration
+		want     time.Time
+	}{
+		{"", 24 * time.Hour, time.Date(2024, 3, 11, 6, 0, 0, 0, time.UTC)},
+		{"02:00", 24 * time.Hour, time.Date(2024, 3, 11, 2, 0, 0, 0, time.UTC)},
+		{"23:30", 24 * time.Hour, time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC)},
+		{"23:00", 6 * time.Hour, time.Date(2024, 3, 10, 11, 0, 0, 0, time.UTC)},
+		{"06:00", 24 * time.Hour, time.Date(2024, 3, 11, 6, 0, 0, 0, time.UTC)},
+		{"03:00", 7 * 24 * time.Hour, time.Date(2024, 3, 17, 3, 0, 0, 0, time.UTC)},
+	} {
+		if got := nextSelfTestRun(now, tt.start, tt.interval); !got.Equal(tt.want) {
+			t.Errorf("start %q, interval %s: got %s, want %s", tt.start, tt.interval, got, tt.want)
+		}
+	}
+	for start, ok := range map[string]bool{"": true, "02:00": true, "25:00": false, "noon": false} {
+		if err := parseSelfTestStart(start); (err == nil) != ok {
+			t.Errorf("start %q: err %v", start, err)
+		}
+	}
+}
+
+// TestSelfTestTrigger checks that a self-test is only started while none is
+// in progress, with a fake smartctl recording the started tests.
+func TestSelfTestTrigger(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	started := filepath.Join(dir, "started")
+	status := filepath.Join(dir, "status.json")
+	smartctl := filepath.Join(dir, "smartctl")
+	script := "#!/bin/sh\n" +
+		"case \"$*\" in\n" +
+		"*--test=*) echo \"$*\" >> " + started + "; echo '{\"smartctl\":{\"exit_status\":0}}' ;;\n" +
+		"*) cat " + status + " ;;\n" +
+		"esac\n"
+	if err := os.WriteFile(smartctl, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	*smartctlPath = smartctl
+	defer func() { *smartctlPath = saved }()
+
+	device := Device{Name: "/dev/sda", Info_Name: "sda"}
+	scheduler := newSelfTestScheduler(&SMARTctlManagerCollector{}, log.NewNopLogger(), "", 0)
+	trigger := func(selfTestStatus int) string {
+		json := `{"smartctl":{"exit_status":0},"device":{"protocol":"ATA"},"ata_smart_data":{"self_test":{"status":{"value":` +
+			strconv.Itoa(selfTestStatus) + `,"remaining_percent":60}}}}`
+		if err := os.WriteFile(status, []byte(json), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(started)
+		scheduler.trigger(device, "short")
+		out, _ := os.ReadFile(started)
+		return strings.TrimSpace(string(out))
+	}
+
+	// 0xf6: a self-test is in progress, 60% remaining.
+	if got := trigger(0xf6); got != "" {
+		t.Errorf("started %q during a running self-test", got)
+	}
+	if len(scheduler.triggered) != 0 {
+		t.Errorf("triggered counted during a running self-test: %v", scheduler.triggered)
+	}
+	// 0: the last self-test completed without error.
+	if got := trigger(0); got != "--json --test=short /dev/sda" {
+		t.Errorf("started %q, want a short self-test of /dev/sda", got)
+	}
+	if got := scheduler.triggered[selfTestKey{device: "sda", testType: "short"}]; got != 1 {
+		t.Errorf("triggered %v, want 1", got)
+	}
+}
@@ -14,8 +14,13 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"math"
+	"os"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/go-kit/log"
@@ -35,12 +40,111 @@ type SMARTDevice struct {
 	protocol   string
 }
 
+// parserField is a JSON field the metrics of a protocol are mined from.
+// Expected fields are reported by every device of the protocol, if one is
+// missing the smartctl output format usually changed and the metrics relying
+// on it silently disappear.
+type parserField struct {
+	path     string
+	expected bool
+}
+
+// parserFields are the fields of all protocols and of each protocol. The
+// expected ones are checked by the schema validation, all are reported by
+// the field presence debug metric to tell whether a missing metric was not
+// reported by the drive.
+var parserFields = map[string][]parserField{
+	"": {
+		{path: "json_format_version", expected: true},
+		{path: "smartctl.exit_status", expected: true},
+		{path: "device.name", expected: true},
+		{path: "device.type", expected: true},
+		{path: "device.protocol", expected: true},
+		{path: "serial_number", expected: true},
+		{path: "smart_status.passed", expected: true},
+		{path: "temperature.current", expected: true},
+		{path: "power_on_time.hours", expected: true},
+		{path: "rotation_rate"},
+		{path: "interface_speed"},
+		{path: "form_factor.name"},
+	},
+	"ATA": {
+		{path: "model_name", expected: true},
+		{path: "firmware_version", expected: true},
+		{path: "user_capacity.bytes", expected: true},
+		{path: "logical_block_size", expected: true},
+		{path: "power_cycle_count", expected: true},
+		{path: "ata_smart_attributes.table", expected: true},
+		{path: "ata_smart_error_log", expected: true},
+		{path: "ata_device_statistics.pages"},
+		{path: "ata_sct_status"},
+		{path: "ata_sct_erc"},
+		{path: "ata_smart_self_test_log"},
+		{path: "ata_smart_data.self_test.status"},
+		{path: "ata_security"},
+		{path: "sata_phy_event_counters.table"},
+	},
+	"NVMe": {
+		{path: "model_name", expected: true},
+		{path: "firmware_version", expected: true},
+		{path: "power_cycle_count", expected: true},
+		{path: "nvme_smart_health_information_log.percentage_used", expected: true},
+		{path: "nvme_smart_health_information_log.available_spare", expected: true},
+		{path: "nvme_smart_health_information_log.media_errors", expected: true},
+		{path: "nvme_smart_health_information_log.data_units_read", expected: true},
+		{path: "nvme_smart_health_information_log.data_units_written", expected: true},
+		{path: "user_capacity.bytes"},
+		{path: "nvme_total_capacity"},
+		{path: "nvme_smart_health_information_log.critical_warning"},
+		{path: "nvme_smart_health_information_log.available_spare_threshold"},
+		{path: "nvme_smart_health_information_log.num_err_log_entries"},
+		{path: "nvme_smart_health_information_log.host_reads"},
+		{path: "nvme_smart_health_information_log.host_writes"},
+		{path: "nvme_smart_health_information_log.controller_busy_time"},
+		{path: "nvme_smart_health_information_log.temperature_sensors"},
+		{path: "nvme_self_test_log"},
+	},
+	"SCSI": {
+		{path: "scsi_model_name", expected: true},
+		{path: "scsi_revision", expected: true},
+		{path: "user_capacity.bytes", expected: true},
+		{path: "logical_block_size", expected: true},
+		{path: "scsi_grown_defect_list", expected: true},
+		{path: "scsi_error_counter_log", expected: true},
+		{path: "power_cycle_count"},
+		{path: "scsi_start_stop_cycle_counter"},
+	},
+}
+
+// protocolFields returns the paths of the parser fields of the protocol,
+// only the expected ones if expectedOnly is set.
+func protocolFields(protocol string, expectedOnly bool) []string {
+	fields := parserFields[""]
+	if protocol != "" {
+		fields = append(fields[:len(fields):len(fields)], parserFields[protocol]...)
+	}
+	var paths []string
+	for _, field := range fields {
+		if field.expected || !expectedOnly {
+			paths = append(paths, field.path)
+		}
+	}
+	return paths
+}
+
+// virtualDiskRe matches the vendor or model of disks emulated by hypervisors.
+var virtualDiskRe = regexp.MustCompile(`(?i)^(QEMU|VMware|VBOX|Virtual|Msft Virtual)`)
+
 // SMARTctl object
 type SMARTctl struct {
 	ch     chan<- prometheus.Metric
 	json   gjson.Result
 	logger log.Logger
 	device SMARTDevice
+	// ambient is the ambient temperature read once per collection, valid
+	// if hasAmbient is set.
+	ambient    float64
+	hasAmbient bool
 }
 
 func extractDiskName(input string) string {
@@ -94,12 +198,7 @@ func getDiskName(input, extInput string) string {
 
 // NewSMARTctl is smartctl constructor
 func NewSMARTctl(logger log.Logger, json gjson.Result, ch chan<- prometheus.Metric) SMARTctl {
-	var model_name string
-	if obj := json.Get("model_name"); obj.Exists() {
-		model_name = obj.String()
-	} else if obj := json.Get("scsi_model_name"); obj.Exists() {
-		model_name = obj.String()
-	}
+	model_name := schemaField(json, "model_name").String()
 	// If the drive returns an empty model name, replace that with unknown.
 	if model_name == "" {
 		model_name = "unknown"
@@ -109,6 +208,12 @@ func NewSMARTctl(logger log.Logger, json gjson.Result, ch chan<- prometheus.Metr
 		strings.TrimSpace(json.Get("device.name").String()),
 		strings.TrimSpace(json.Get("device.info_name").String()),
 	)
+	serial := strings.TrimSpace(json.Get("serial_number").String())
+	// A label configured for the serial keeps the series of the drive when
+	// its address changes, e.g. after moving it to another controller.
+	if label, ok := serialDeviceLabel(serial); ok {
+		deviceName = label
+	}
 
 	return SMARTctl{
 		ch:     ch,
@@ -116,7 +221,7 @@ func NewSMARTctl(logger log.Logger, json gjson.Result, ch chan<- prometheus.Metr
 		logger: logger,
 		device: SMARTDevice{
 			device:     deviceName,
-			serial:     strings.TrimSpace(json.Get("serial_number").String()),
+			serial:     serial,
 			family:     strings.TrimSpace(GetStringIfExists(json, "model_family", "unknown")),
 			model:      strings.TrimSpace(model_name),
 			interface_: strings.TrimSpace(json.Get("device.type").String()),
@@ -128,8 +233,11 @@ func NewSMARTctl(logger log.Logger, json gjson.Result, ch chan<- prometheus.Metr
 // Collect metrics
 func (smart *SMARTctl) Collect() {
 	level.Debug(smart.logger).Log("msg", "Collecting metrics from", "device", smart.device.device, "family", smart.device.family, "model", smart.device.model)
+	checkJSONFormatVersion(smart.logger, smart.json)
 	smart.mineExitStatus()
+	smart.mineJSONFormatVersion()
 	smart.mineDevice()
+	smart.mineDeviceInfo()
 	smart.mineCapacity()
 	smart.mineBlockSize()
 	smart.mineInterfaceSpeed()
@@ -137,16 +245,31 @@ func (smart *SMARTctl) Collect() {
 	smart.minePowerOnSeconds()
 	smart.mineRotationRate()
 	smart.mineTemperatures()
+	smart.mineTemperatureDelta()
 	smart.minePowerCycleCount() // ATA/SATA, NVME, SCSI, SAS
+	smart.mineSectorHealth()
+	smart.mineWear()
 	smart.mineDeviceSCTStatus()
 	smart.mineDeviceStatistics()
 	smart.mineDeviceErrorLog()
 	smart.mineDeviceSelfTestLog()
+	smart.mineSelfTestResults()
+	smart.mineSelfTestProgress()
 	smart.mineDeviceERC()
 	smart.mineSmartStatus()
+	smart.mineSecurity()
+
+	if *smartctlHealthScore {
+		smart.mineHealthScore()
+	}
+	if *smartctlSchemaValidation {
+		smart.mineSchemaFieldsMissing()
+	}
+	if *smartctlDebugFieldPresence {
+		smart.mineParserFieldPresence()
+	}
 
 	if smart.device.interface_ == "nvme" {
-		smart.mineNvmePercentageUsed()
 		smart.mineNvmeAvailableSpare()
 		smart.mineNvmeAvailableSpareThreshold()
 		smart.mineNvmeCriticalWarning()
@@ -154,6 +277,9 @@ func (smart *SMARTctl) Collect() {
 		smart.mineNvmeNumErrLogEntries()
 		smart.mineNvmeBytesRead()
 		smart.mineNvmeBytesWritten()
+		smart.mineNvmeHostCommands()
+		smart.mineNvmeControllerBusyTime()
+		smart.mineNvmeTemperatureSensors()
 	}
 	// SCSI, SAS
 	if smart.device.interface_ == "scsi" {
@@ -161,19 +287,70 @@ func (smart *SMARTctl) Collect() {
 		smart.mineSCSIErrorCounterLog()
 		smart.mineSCSIBytesRead()
 		smart.mineSCSIBytesWritten()
+		smart.mineSCSICycleWear()
+	}
+	// ATA, SATA
+	if smart.device.protocol == "ATA" {
+		smart.mineATABytes()
 	}
 }
 
+// smartctlExitStatusBits names the bits of the smartctl exit status, see
+// the RETURN VALUES of smartctl(8).
+var smartctlExitStatusBits = []string{
+	"command_line_error",
+	"device_open_failed",
+	"command_failed",
+	"disk_failing",
+	"prefail_below_threshold",
+	"past_below_threshold",
+	"error_log",
+	"self_test_log",
+}
+
+// exitStatusDiskFailing is the exit status bit of a failed SMART status check.
+const exitStatusDiskFailing = 1 << 3
+
 func (smart *SMARTctl) mineExitStatus() {
+	exitStatus := smart.json.Get("smartctl.exit_status")
 	smart.ch <- prometheus.MustNewConstMetric(
 		metricDeviceExitStatus,
 		prometheus.GaugeValue,
-		smart.json.Get("smartctl.exit_status").Float(),
+		exitStatus.Float(),
 		smart.device.device,
 	)
+	for i, bit := range smartctlExitStatusBits {
+		smart.ch <- prometheus.MustNewConstMetric(
+			metricDeviceExitStatusBit,
+			prometheus.GaugeValue,
+			float64(exitStatus.Uint()>>i&1),
+			smart.device.device,
+			bit,
+		)
+	}
+}
+
+// mineJSONFormatVersion exports the output format version of the smartctl
+// run that read the device. Devices may be read by different smartctl
+// versions, e.g. through the helper, so it is reported per device.
+func (smart *SMARTctl) mineJSONFormatVersion() {
+	jsonVersion := smart.json.Get("json_format_version").Array()
+	smartctlVersion := smart.json.Get("smartctl.version").Array()
+	if len(jsonVersion) < 2 || len(smartctlVersion) < 2 {
+		return
+	}
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceJSONFormatVersion,
+		prometheus.GaugeValue,
+		1,
+		smart.device.device,
+		fmt.Sprintf("%d.%d", jsonVersion[0].Int(), jsonVersion[1].Int()),
+		fmt.Sprintf("%d.%d", smartctlVersion[0].Int(), smartctlVersion[1].Int()),
+	)
 }
 
 func (smart *SMARTctl) mineDevice() {
+	location := raidDriveLocation(smart.device.serial)
 	smart.ch <- prometheus.MustNewConstMetric(
 		metricDeviceModel,
 		prometheus.GaugeValue,
@@ -183,9 +360,9 @@ func (smart *SMARTctl) mineDevice() {
 		smart.device.protocol,
 		smart.device.family,
 		smart.device.model,
-		smart.device.serial,
+		serialLabel(smart.device.serial),
 		GetStringIfExists(smart.json, "ata_additional_product_id", "unknown"),
-		smart.json.Get("firmware_version").String(),
+		schemaField(smart.json, "firmware_version").String(),
 		smart.json.Get("ata_version.string").String(),
 		smart.json.Get("sata_version.string").String(),
 		smart.json.Get("form_factor.name").String(),
@@ -194,9 +371,69 @@ func (smart *SMARTctl) mineDevice() {
 		smart.json.Get("scsi_product").String(),
 		smart.json.Get("scsi_revision").String(),
 		smart.json.Get("scsi_version").String(),
+		location.Enclosure,
+		location.Slot,
+		strconv.FormatBool(smart.isVirtual()),
+	)
+}
+
+// serialLabel returns the serial number as exported in labels, according to
+// smartctl.serial-mode. Hashed serials are stable across scrapes and restarts.
+func serialLabel(serial string) string {
+	switch *smartctlSerialMode {
+	case "hashed":
+		if serial == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(serial))
+		return hex.EncodeToString(sum[:8])
+	case "omit":
+		return ""
+	}
+	return serial
+}
+
+// wwn formats the World Wide Name the way smartctl prints it, or returns an
+// empty string if the device does not report one.
+func wwn(json gjson.Result) string {
+	wwn := json.Get("wwn")
+	if !wwn.Exists() {
+		return ""
+	}
+	return fmt.Sprintf("0x%x%06x%09x", wwn.Get("naa").Uint(), wwn.Get("oui").Uint(), wwn.Get("id").Uint())
+}
+
+// mineDeviceInfo exports the identity of the device. Unlike smartctl_device,
+// fields the device does not report are empty.
+func (smart *SMARTctl) mineDeviceInfo() {
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceInfo,
+		prometheus.GaugeValue,
+		1,
+		smart.device.device,
+		smart.device.interface_,
+		strings.TrimSpace(smart.json.Get("model_family").String()),
+		smart.device.model,
+		serialLabel(smart.device.serial),
+		schemaField(smart.json, "firmware_version").String(),
+		wwn(smart.json),
 	)
 }
 
+// isVirtual returns whether the device is backed by a file, device-mapper or
+// a hypervisor instead of a physical drive.
+func (smart *SMARTctl) isVirtual() bool {
+	if isVirtualDevice(smart.json.Get("device.name").String()) {
+		return true
+	}
+	for _, field := range []string{"scsi_vendor", "model_name", "scsi_model_name"} {
+		if virtualDiskRe.MatchString(smart.json.Get(field).String()) {
+			return true
+		}
+	}
+	return false
+}
+
 func (smart *SMARTctl) mineCapacity() {
 	// The user_capacity exists only when NVMe have single namespace. Otherwise,
 	// for NVMe devices with multiple namespaces, when device name used without
@@ -222,6 +459,35 @@ func (smart *SMARTctl) mineCapacity() {
 			smart.device.device,
 		)
 	}
+
+	capacity := schemaField(smart.json, "capacity_bytes").Float()
+	if capacity > 0 {
+		smart.ch <- prometheus.MustNewConstMetric(
+			metricDeviceCapacityInfo,
+			prometheus.GaugeValue,
+			1,
+			smart.device.device,
+			formatCapacity(capacity, 1000, []string{"B", "kB", "MB", "GB", "TB", "PB"}),
+			formatCapacity(capacity, 1024, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}),
+		)
+	}
+}
+
+// formatCapacity formats bytes with three significant digits like smartctl
+// does, e.g. "1.00 TB" or "931 GiB".
+func formatCapacity(bytes float64, base float64, units []string) string {
+	unit := 0
+	for bytes >= base && unit < len(units)-1 {
+		bytes /= base
+		unit++
+	}
+	decimals := 0
+	if bytes < 10 {
+		decimals = 2
+	} else if bytes < 100 {
+		decimals = 1
+	}
+	return fmt.Sprintf("%.*f %s", decimals, bytes, units[unit])
 }
 
 func (smart *SMARTctl) mineBlockSize() {
@@ -256,17 +522,37 @@ func (smart *SMARTctl) mineInterfaceSpeed() {
 }
 
 func (smart *SMARTctl) mineDeviceAttribute() {
-	for _, attribute := range smart.json.Get("ata_smart_attributes.table").Array() {
+	table := smart.json.Get("ata_smart_attributes.table")
+	if !table.Exists() {
+		return
+	}
+	attributes := table.Array()
+	count := len(attributes)
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceAttributeCount,
+		prometheus.GaugeValue,
+		float64(count),
+		smart.device.device,
+	)
+	if count > *smartctlAttributeWarnCount {
+		level.Warn(smart.logger).Log("msg", "Device reports an unusual number of attributes", "device", smart.device.device, "count", count)
+	}
+	filtered := attributes[:0:0]
+	for _, attribute := range attributes {
+		if !exportedAttributes.ignored(attribute.Get("id").String(), strings.TrimSpace(attribute.Get("name").String())) {
+			filtered = append(filtered, attribute)
+		}
+	}
+	attributes = filtered
+	count = len(attributes)
+	if *smartctlAttributeLimit > 0 && count > *smartctlAttributeLimit {
+		level.Warn(smart.logger).Log("msg", "Limiting exported attributes", "device", smart.device.device, "count", count, "limit", *smartctlAttributeLimit)
+		attributes = attributes[:*smartctlAttributeLimit]
+	}
+	for _, attribute := range attributes {
 		name := strings.TrimSpace(attribute.Get("name").String())
 		flagsShort := strings.TrimSpace(attribute.Get("flags.string").String())
-		flagsLong := smart.mineLongFlags(attribute.Get("flags"), []string{
-			"prefailure",
-			"updated_online",
-			"performance",
-			"error_rate",
-			"event_count",
-			"auto_keep",
-		})
+		flagsLong := smart.mineLongFlags(attribute.Get("flags"), attributeFlagNames)
 		id := attribute.Get("id").String()
 		for key, path := range map[string]string{
 			"value":  "value",
@@ -274,10 +560,17 @@ func (smart *SMARTctl) mineDeviceAttribute() {
 			"thresh": "thresh",
 			"raw":    "raw.value",
 		} {
+			value := attribute.Get(path).Float()
+			if key == "raw" {
+				if scale, ok := attributeConfigFor(attributeScales, id, name); ok {
+					value = scale.apply(attribute.Get(path))
+					key = "raw_" + scale.unit
+				}
+			}
 			smart.ch <- prometheus.MustNewConstMetric(
 				metricDeviceAttribute,
 				prometheus.GaugeValue,
-				attribute.Get(path).Float(),
+				value,
 				smart.device.device,
 				name,
 				flagsShort,
@@ -286,68 +579,199 @@ func (smart *SMARTctl) mineDeviceAttribute() {
 				id,
 			)
 		}
+		smart.ch <- prometheus.MustNewConstMetric(
+			metricDeviceAttributeFlags,
+			prometheus.GaugeValue,
+			1,
+			append([]string{smart.device.device, name, id}, attributeFlags(attribute.Get("flags"))...)...,
+		)
+		if threshold, ok := attributeConfigFor(attributeThresholds, id, name); ok {
+			over := 0.0
+			if threshold.exceeded(attribute) {
+				over = 1
+			}
+			smart.ch <- prometheus.MustNewConstMetric(
+				metricDeviceAttributeOverUserThreshold,
+				prometheus.GaugeValue,
+				over,
+				smart.device.device,
+				name,
+				id,
+			)
+		}
 	}
 }
 
+// ataAttributeRaw returns the raw value of the ATA attribute with the given
+// id and name, or any name if empty.
+func (smart *SMARTctl) ataAttributeRaw(id int64, name string) gjson.Result {
+	for _, attribute := range smart.json.Get("ata_smart_attributes.table").Array() {
+		if attribute.Get("id").Int() == id && (name == "" || attribute.Get("name").String() == name) {
+			return attribute.Get("raw.value")
+		}
+	}
+	return gjson.Result{}
+}
+
 func (smart *SMARTctl) minePowerOnSeconds() {
-	pot := smart.json.Get("power_on_time")
-	// If the power_on_time is NOT present, do not report as 0.
-	if pot.Exists() {
+	hours := schemaField(smart.json, "power_on_hours")
+	// If the power-on time is NOT present, do not report as 0.
+	if !hours.Exists() {
+		return
+	}
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDevicePowerOnSeconds,
+		prometheus.CounterValue,
+		hours.Float()*60*60+schemaField(smart.json, "power_on_minutes").Float()*60,
+		smart.device.device,
+	)
+}
+
+// sectorHealth returns the classic failure predictors the device reports,
+// by the same names for all protocols:
+//
+//	             reallocated             pending  uncorrectable
+//	ATA          attribute 5             197      198
+//	SCSI         grown defect list       -        uncorrected read, write and verify errors
+//	NVMe         -                       -        media errors
+//
+// The ATA attributes are matched by id only, as vendors name them
+// differently.
+func sectorHealth(json gjson.Result) map[string]float64 {
+	values := map[string]float64{}
+	set := func(name string, value gjson.Result) {
+		if value.Exists() {
+			values[name] = value.Float()
+		}
+	}
+	switch {
+	case json.Get("ata_smart_attributes.table").Exists():
+		attributes := map[int64]gjson.Result{}
+		for _, attribute := range json.Get("ata_smart_attributes.table").Array() {
+			if id := attribute.Get("id").Int(); !attributes[id].Exists() {
+				attributes[id] = attribute.Get("raw.value")
+			}
+		}
+		set("reallocated", attributes[5])
+		set("pending", attributes[197])
+		set("uncorrectable", attributes[198])
+	case json.Get("scsi_error_counter_log").Exists() || json.Get("scsi_grown_defect_list").Exists():
+		set("reallocated", json.Get("scsi_grown_defect_list"))
+		if counters := json.Get("scsi_error_counter_log"); counters.Exists() {
+			for _, operation := range []string{"read", "write", "verify"} {
+				values["uncorrectable"] += counters.Get(operation + ".total_uncorrected_errors").Float()
+			}
+		}
+	case json.Get("nvme_smart_health_information_log").Exists():
+		set("uncorrectable", json.Get("nvme_smart_health_information_log.media_errors"))
+	}
+	return values
+}
+
+// sectorHealthMetrics are the metrics of the sectorHealth values.
+var sectorHealthMetrics = map[string]*prometheus.Desc{
+	"reallocated":   metricDeviceReallocatedSectors,
+	"pending":       metricDevicePendingSectors,
+	"uncorrectable": metricDeviceUncorrectableSectors,
+}
+
+// mineSectorHealth exports the sectorHealth values.
+func (smart *SMARTctl) mineSectorHealth() {
+	for name, value := range sectorHealth(smart.json) {
 		smart.ch <- prometheus.MustNewConstMetric(
-			metricDevicePowerOnSeconds,
-			prometheus.CounterValue,
-			GetFloatIfExists(pot, "hours", 0)*60*60+GetFloatIfExists(pot, "minutes", 0)*60,
+			sectorHealthMetrics[name],
+			prometheus.GaugeValue,
+			value,
 			smart.device.device,
 		)
 	}
 }
 
 func (smart *SMARTctl) mineRotationRate() {
-	rRate := GetFloatIfExists(smart.json, "rotation_rate", 0)
-	// TODO: what should be done if this is absent vs really zero (for
-	// solid-state drives)?
-	if rRate > 0 {
+	// smartctl reports 0 for solid-state drives, devices without the field
+	// (e.g. NVMe) get no metric.
+	rRate := smart.json.Get("rotation_rate")
+	if rRate.Exists() {
 		smart.ch <- prometheus.MustNewConstMetric(
 			metricDeviceRotationRate,
 			prometheus.GaugeValue,
-			rRate,
+			rRate.Float(),
 			smart.device.device,
 		)
 	}
 }
 
+// sendTemperature sends a temperature reported by smartctl in celsius. With
+// smartctl.temperature-unit=fahrenheit it is sent converted under the
+// fahrenheit metric as well, the celsius metric is always kept as is.
+func (smart *SMARTctl) sendTemperature(celsius, fahrenheit *prometheus.Desc, value float64, labels ...string) {
+	smart.ch <- prometheus.MustNewConstMetric(celsius, prometheus.GaugeValue, value, labels...)
+	if *smartctlTemperatureUnit == "fahrenheit" {
+		smart.ch <- prometheus.MustNewConstMetric(fahrenheit, prometheus.GaugeValue, value*9/5+32, labels...)
+	}
+}
+
 func (smart *SMARTctl) mineTemperatures() {
-	temperatures := smart.json.Get("temperature")
-	// TODO: Implement scsi_environmental_reports
-	if temperatures.Exists() {
-		temperatures.ForEach(func(key, value gjson.Result) bool {
-			smart.ch <- prometheus.MustNewConstMetric(
-				metricDeviceTemperature,
-				prometheus.GaugeValue,
-				value.Float(),
-				smart.device.device,
-				key.String(),
-			)
-			return true
-		})
+	if current := schemaField(smart.json, "temperature"); current.Exists() {
+		smart.sendTemperature(metricDeviceTemperature, metricDeviceTemperatureFahrenheit, current.Float(), smart.device.device, "current")
 	}
+	smart.json.Get("temperature").ForEach(func(key, value gjson.Result) bool {
+		if key.String() != "current" {
+			smart.sendTemperature(metricDeviceTemperature, metricDeviceTemperatureFahrenheit, value.Float(), smart.device.device, key.String())
+		}
+		return true
+	})
 }
 
-func (smart *SMARTctl) minePowerCycleCount() {
-	// ATA & NVME
-	powerCycleCount := smart.json.Get("power_cycle_count")
-	if powerCycleCount.Exists() {
-		smart.ch <- prometheus.MustNewConstMetric(
-			metricDevicePowerCycleCount,
-			prometheus.CounterValue,
-			powerCycleCount.Float(),
-			smart.device.device,
-		)
+// mineNvmeTemperatureSensors exports the temperature sensors of NVMe devices
+// besides the composite temperature. smartctl reports sensor N at index N-1,
+// sensors whose value is absent or 0 are unused and skipped.
+func (smart *SMARTctl) mineNvmeTemperatureSensors() {
+	for i, value := range smart.json.Get("nvme_smart_health_information_log.temperature_sensors").Array() {
+		if value.Float() == 0 {
+			continue
+		}
+		smart.sendTemperature(metricDeviceTemperatureSensor, metricDeviceTemperatureSensorFahrenheit, value.Float(), smart.device.device, strconv.Itoa(i+1))
+	}
+}
+
+// readAmbientTemperature reads the ambient temperature file. ok is false if
+// no file is configured or it cannot be read.
+func readAmbientTemperature(logger log.Logger) (ambient float64, ok bool) {
+	if *smartctlAmbientTemperatureFile == "" {
+		return 0, false
+	}
+	data, err := os.ReadFile(*smartctlAmbientTemperatureFile)
+	if err != nil {
+		level.Warn(logger).Log("msg", "Ambient temperature reading error", "err", err)
+		return 0, false
+	}
+	ambient, err = strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		level.Warn(logger).Log("msg", "Ambient temperature parsing error", "err", err)
+		return 0, false
+	}
+	return ambient, true
+}
+
+func (smart *SMARTctl) mineTemperatureDelta() {
+	if !smart.hasAmbient {
 		return
 	}
+	current := schemaField(smart.json, "temperature")
+	if !current.Exists() {
+		return
+	}
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceTemperatureDelta,
+		prometheus.GaugeValue,
+		current.Float()-smart.ambient,
+		smart.device.device,
+	)
+}
 
-	// SCSI
-	powerCycleCount = smart.json.Get("scsi_start_stop_cycle_counter.accumulated_start_stop_cycles")
+func (smart *SMARTctl) minePowerCycleCount() {
+	powerCycleCount := schemaField(smart.json, "power_cycles")
 	if powerCycleCount.Exists() {
 		smart.ch <- prometheus.MustNewConstMetric(
 			metricDevicePowerCycleCount,
@@ -355,7 +779,6 @@ func (smart *SMARTctl) minePowerCycleCount() {
 			powerCycleCount.Float(),
 			smart.device.device,
 		)
-		return
 	}
 }
 
@@ -371,13 +794,79 @@ func (smart *SMARTctl) mineDeviceSCTStatus() {
 	}
 }
 
-func (smart *SMARTctl) mineNvmePercentageUsed() {
-	smart.ch <- prometheus.MustNewConstMetric(
-		metricDevicePercentageUsed,
-		prometheus.CounterValue,
-		smart.json.Get("nvme_smart_health_information_log.percentage_used").Float(),
-		smart.device.device,
-	)
+// wearPaths are the paths the SSD wear and spare capacity are read from by
+// protocol, in order of preference. NVMe devices may report more than 100
+// percent used. ATA vendors report the remaining life in the normalized value
+// of their attribute instead of the device statistics, the ids are shared with
+// unrelated HDD attributes so they are matched by name. The NVMe spare
+// capacity is already exported as smartctl_device_available_spare.
+var wearPaths = map[string]struct {
+	used, remaining, spare []string
+}{
+	"NVMe": {
+		used: []string{"nvme_smart_health_information_log.percentage_used"},
+	},
+	"SCSI": {
+		used: []string{"scsi_percentage_used_endurance_indicator"},
+	},
+	"ATA": {
+		used: []string{`ata_device_statistics.pages.#(number==7).table.#(name=="Percentage Used Endurance Indicator").value`},
+		remaining: []string{
+			`ata_smart_attributes.table.#(name=="Media_Wearout_Indicator").value`,
+			`ata_smart_attributes.table.#(name=="Wear_Leveling_Count").value`,
+			`ata_smart_attributes.table.#(name=="SSD_Life_Left").value`,
+			`ata_smart_attributes.table.#(name=="Percent_Lifetime_Remain").value`,
+		},
+		spare: []string{
+			`ata_smart_attributes.table.#(name=="Available_Reservd_Space").value`,
+			`ata_smart_attributes.table.#(name=="Unused_Rsvd_Blk_Cnt_Tot").value`,
+		},
+	},
+}
+
+// firstPath returns the value of the first existing path.
+func firstPath(json gjson.Result, paths []string) gjson.Result {
+	for _, path := range paths {
+		if value := json.Get(path); value.Exists() {
+			return value
+		}
+	}
+	return gjson.Result{}
+}
+
+// percentageUsed returns the SSD wear of the protocol in percent used, derived
+// from the remaining life if the device does not report it directly.
+func percentageUsed(json gjson.Result, protocol string) (float64, bool) {
+	paths := wearPaths[protocol]
+	if used := firstPath(json, paths.used); used.Exists() {
+		return used.Float(), true
+	}
+	if remaining := firstPath(json, paths.remaining); remaining.Exists() {
+		return math.Max(100-remaining.Float(), 0), true
+	}
+	return 0, false
+}
+
+// mineWear exports the SSD wear and spare capacity of all protocols under
+// the same names, the remaining life as 100 minus its value.
+func (smart *SMARTctl) mineWear() {
+	paths := wearPaths[smart.device.protocol]
+	if used, ok := percentageUsed(smart.json, smart.device.protocol); ok {
+		smart.ch <- prometheus.MustNewConstMetric(
+			metricDevicePercentageUsed,
+			prometheus.CounterValue,
+			used,
+			smart.device.device,
+		)
+	}
+	if spare := firstPath(smart.json, paths.spare); spare.Exists() {
+		smart.ch <- prometheus.MustNewConstMetric(
+			metricDeviceAvailableSparePercent,
+			prometheus.GaugeValue,
+			spare.Float(),
+			smart.device.device,
+		)
+	}
 }
 
 func (smart *SMARTctl) mineNvmeAvailableSpare() {
@@ -398,13 +887,35 @@ func (smart *SMARTctl) mineNvmeAvailableSpareThreshold() {
 	)
 }
 
+// nvmeCriticalWarningBits names the bits of the NVMe Critical Warning field.
+var nvmeCriticalWarningBits = []string{
+	"available_spare",
+	"temperature",
+	"reliability",
+	"read_only",
+	"backup_failed",
+}
+
 func (smart *SMARTctl) mineNvmeCriticalWarning() {
+	criticalWarning := smart.json.Get("nvme_smart_health_information_log.critical_warning")
 	smart.ch <- prometheus.MustNewConstMetric(
 		metricDeviceCriticalWarning,
 		prometheus.CounterValue,
-		smart.json.Get("nvme_smart_health_information_log.critical_warning").Float(),
+		criticalWarning.Float(),
 		smart.device.device,
 	)
+	if !criticalWarning.Exists() {
+		return
+	}
+	for i, bit := range nvmeCriticalWarningBits {
+		smart.ch <- prometheus.MustNewConstMetric(
+			metricDeviceCriticalWarningBit,
+			prometheus.GaugeValue,
+			float64(criticalWarning.Uint()>>i&1),
+			smart.device.device,
+			bit,
+		)
+	}
 }
 
 func (smart *SMARTctl) mineNvmeMediaErrors() {
@@ -480,6 +991,38 @@ func (smart *SMARTctl) mineNvmeBytesWritten() {
 	)
 }
 
+func (smart *SMARTctl) mineNvmeHostCommands() {
+	for field, metric := range map[string]*prometheus.Desc{
+		"host_reads":  metricDeviceHostReadCommands,
+		"host_writes": metricDeviceHostWriteCommands,
+	} {
+		value := smart.json.Get("nvme_smart_health_information_log." + field)
+		if !value.Exists() {
+			continue
+		}
+		smart.ch <- prometheus.MustNewConstMetric(
+			metric,
+			prometheus.CounterValue,
+			value.Float(),
+			smart.device.device,
+		)
+	}
+}
+
+// Controller Busy Time is reported in minutes.
+func (smart *SMARTctl) mineNvmeControllerBusyTime() {
+	busyTime := smart.json.Get("nvme_smart_health_information_log.controller_busy_time")
+	if !busyTime.Exists() {
+		return
+	}
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceControllerBusyTime,
+		prometheus.CounterValue,
+		busyTime.Float()*60,
+		smart.device.device,
+	)
+}
+
 func (smart *SMARTctl) mineSCSIBytesRead() {
 	SCSIHealth := smart.json.Get("scsi_error_counter_log")
 	if SCSIHealth.Exists() {
@@ -510,11 +1053,173 @@ func (smart *SMARTctl) mineSCSIBytesWritten() {
 	}
 }
 
+// ataDataAttributes lists the ATA attributes counting the data read and
+// written by the host, in order of preference, with the bytes per raw unit, 0
+// for the logical block size. Vendors reuse ids for different units, so they
+// are matched by name.
+var ataDataAttributes = []struct {
+	name    string
+	written bool
+	unit    float64
+}{
+	{"Host_Writes_32MiB", true, 32 << 20},
+	{"Host_Reads_32MiB", false, 32 << 20},
+	{"Lifetime_Writes_GiB", true, 1 << 30},
+	{"Lifetime_Reads_GiB", false, 1 << 30},
+	{"Host_Writes_GiB", true, 1 << 30},
+	{"Host_Reads_GiB", false, 1 << 30},
+	{"Host_Writes_MiB", true, 1 << 20},
+	{"Host_Reads_MiB", false, 1 << 20},
+	{"Total_LBAs_Written", true, 0},
+	{"Total_LBAs_Read", false, 0},
+}
+
+// mineATABytes exports the bytes read and written by the host on ATA devices,
+// so the counters match the other protocols:
+//
+//	NVMe   data units of 1000 * 512 bytes
+//	SCSI   gigabytes (10^9) processed from the error counter log
+//	ATA    logical sectors of the General Statistics page times the logical
+//	       block size, else the first attribute of ataDataAttributes
+func (smart *SMARTctl) mineATABytes() {
+	blockSize := smart.json.Get("logical_block_size").Float()
+	if blockSize == 0 {
+		blockSize = 512
+	}
+	attributes := smart.json.Get("ata_smart_attributes.table")
+	lbaUnit := blockSize
+	// Intel drives report their 32MiB counters under the default Total_LBAs
+	// names, given away by attribute 225 mirroring 241. The written bytes
+	// come from 225 already, so this only scales Total_LBAs_Read.
+	host := attributes.Get(`#(name=="Host_Writes_32MiB").raw.value`)
+	written := attributes.Get(`#(name=="Total_LBAs_Written").raw.value`)
+	if host.Exists() && written.Exists() && host.Int() != 0 && host.Int() == written.Int() {
+		lbaUnit = 32 << 20
+	}
+	values := map[*prometheus.Desc]float64{}
+	statistics := smart.json.Get("ata_device_statistics.pages.#(number==1).table")
+	for name, metric := range map[string]*prometheus.Desc{
+		"Logical Sectors Written": metricDeviceBytesWritten,
+		"Logical Sectors Read":    metricDeviceBytesRead,
+	} {
+		if value := statistics.Get(`#(name=="` + name + `").value`); value.Exists() {
+			values[metric] = value.Float() * blockSize
+		}
+	}
+	for _, attribute := range ataDataAttributes {
+		metric := metricDeviceBytesRead
+		if attribute.written {
+			metric = metricDeviceBytesWritten
+		}
+		if _, ok := values[metric]; ok {
+			continue
+		}
+		raw := attributes.Get(`#(name=="` + attribute.name + `").raw.value`)
+		if !raw.Exists() {
+			continue
+		}
+		unit := attribute.unit
+		if unit == 0 {
+			unit = lbaUnit
+		}
+		values[metric] = raw.Float() * unit
+	}
+	for metric, value := range values {
+		smart.ch <- prometheus.MustNewConstMetric(
+			metric,
+			prometheus.CounterValue,
+			value,
+			smart.device.device,
+		)
+	}
+}
+
 func (smart *SMARTctl) mineSmartStatus() {
+	passed := smart.json.Get("smart_status.passed").Float()
+	// The exit status reports a failed check even if the JSON lacks it.
+	if smart.json.Get("smartctl.exit_status").Uint()&exitStatusDiskFailing != 0 {
+		passed = 0
+	}
 	smart.ch <- prometheus.MustNewConstMetric(
 		metricDeviceSmartStatus,
 		prometheus.GaugeValue,
-		smart.json.Get("smart_status.passed").Float(),
+		passed,
+		smart.device.device,
+	)
+}
+
+func (smart *SMARTctl) mineHealthScore() {
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceHealthScore,
+		prometheus.GaugeValue,
+		healthScore(smart.json, healthScoreWeights),
+		smart.device.device,
+	)
+}
+
+func (smart *SMARTctl) mineSchemaFieldsMissing() {
+	for _, field := range protocolFields(smart.device.protocol, true) {
+		if !smart.json.Get(field).Exists() {
+			level.Debug(smart.logger).Log("msg", "Expected field is missing", "device", smart.device.device, "field", field)
+			smart.ch <- prometheus.MustNewConstMetric(
+				metricDeviceSchemaFieldsMissing,
+				prometheus.GaugeValue,
+				1,
+				smart.device.device,
+				field,
+			)
+		}
+	}
+}
+
+func (smart *SMARTctl) mineParserFieldPresence() {
+	for _, field := range protocolFields(smart.device.protocol, false) {
+		present := 0.0
+		if smart.json.Get(field).Exists() {
+			present = 1
+		}
+		smart.ch <- prometheus.MustNewConstMetric(
+			metricParserFieldPresent,
+			prometheus.GaugeValue,
+			present,
+			smart.device.device,
+			field,
+		)
+	}
+}
+
+func (smart *SMARTctl) mineSecurity() {
+	// Only ATA devices report their security state. Its absence says nothing
+	// about encryption, so nothing is exported then.
+	security := smart.json.Get("ata_security")
+	if !security.Exists() {
+		return
+	}
+	// Bit 0 of the security status (IDENTIFY word 128) is set if the feature
+	// set is supported, bit 2 while locked.
+	state := security.Get("state").Int()
+	supported := 0.0
+	if state&1 != 0 {
+		supported = 1
+	}
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceATASecuritySupported,
+		prometheus.GaugeValue,
+		supported,
+		smart.device.device,
+	)
+	locked := state&(1<<2) != 0
+	if l := security.Get("locked"); l.Exists() {
+		locked = l.Bool()
+	}
+	value := 0.0
+	if locked {
+		value = 1
+	}
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceATASecurityLocked,
+		prometheus.GaugeValue,
+		value,
 		smart.device.device,
 	)
 }
@@ -546,20 +1251,40 @@ func (smart *SMARTctl) mineDeviceStatistics() {
 		}
 	}
 
+	// The SATA PHY event counters are exported by their own metric only,
+	// they used to be in smartctl_device_statistics as well.
 	for _, statistic := range smart.json.Get("sata_phy_event_counters.table").Array() {
 		smart.ch <- prometheus.MustNewConstMetric(
-			metricDeviceStatistics,
+			metricDeviceSATAPhyEvent,
 			prometheus.GaugeValue,
 			statistic.Get("value").Float(),
 			smart.device.device,
-			"SATA PHY Event Counters",
+			statistic.Get("id").String(),
 			strings.TrimSpace(statistic.Get("name").String()),
-			"V---",
-			"valid",
 		)
 	}
 }
 
+// attributeFlagNames are the ATA attribute flags, in the label order of
+// smartctl_device_attribute_flags.
+var attributeFlagNames = []string{
+	"prefailure",
+	"updated_online",
+	"performance",
+	"error_rate",
+	"event_count",
+	"auto_keep",
+}
+
+// attributeFlags returns "true" or "false" for each of attributeFlagNames.
+func attributeFlags(json gjson.Result) []string {
+	flags := make([]string, len(attributeFlagNames))
+	for i, flag := range attributeFlagNames {
+		flags[i] = strconv.FormatBool(json.Get(flag).Bool())
+	}
+	return flags
+}
+
 func (smart *SMARTctl) mineLongFlags(json gjson.Result, flags []string) string {
 	var result []string
 	for _, flag := range flags {
@@ -581,6 +1306,19 @@ func (smart *SMARTctl) mineDeviceErrorLog() {
 			logType,
 		)
 	}
+	// Prefer the summary log, devices with only the extended log report
+	// their count there.
+	for _, logType := range []string{"summary", "extended"} {
+		if count := smart.json.Get("ata_smart_error_log." + logType + ".count"); count.Exists() {
+			smart.ch <- prometheus.MustNewConstMetric(
+				metricDeviceATAErrorLogCount,
+				prometheus.GaugeValue,
+				count.Float(),
+				smart.device.device,
+			)
+			break
+		}
+	}
 }
 
 func (smart *SMARTctl) mineDeviceSelfTestLog() {
@@ -602,6 +1340,136 @@ func (smart *SMARTctl) mineDeviceSelfTestLog() {
 	}
 }
 
+// SelfTestResult is an entry of the self-test log of any protocol.
+type SelfTestResult struct {
+	Type   string
+	Status string
+	Hours  float64
+	Failed bool
+}
+
+// selfTestResults returns the self-test log, most recent entry first.
+func selfTestResults(json gjson.Result) []SelfTestResult {
+	var results []SelfTestResult
+	for _, entry := range json.Get("ata_smart_self_test_log.standard.table").Array() {
+		results = append(results, SelfTestResult{
+			Type:   entry.Get("type.string").String(),
+			Status: entry.Get("status.string").String(),
+			Hours:  entry.Get("lifetime_hours").Float(),
+			Failed: entry.Get("status.passed").Exists() && !entry.Get("status.passed").Bool(),
+		})
+	}
+	for _, entry := range json.Get("nvme_self_test_log.table").Array() {
+		// 5 to 7 are fatal errors and failed segments, the other results
+		// are successes or aborts.
+		result := entry.Get("self_test_result.value").Int()
+		results = append(results, SelfTestResult{
+			Type:   entry.Get("self_test_code.string").String(),
+			Status: entry.Get("self_test_result.string").String(),
+			Hours:  entry.Get("power_on_hours").Float(),
+			Failed: result >= 5 && result <= 7,
+		})
+	}
+	for i := 0; ; i++ {
+		entry := json.Get(fmt.Sprintf("scsi_self_test_%d", i))
+		if !entry.Exists() {
+			break
+		}
+		// 3 to 7 are unknown errors and failed segments.
+		result := entry.Get("result.value").Int()
+		results = append(results, SelfTestResult{
+			Type:   entry.Get("code.string").String(),
+			Status: entry.Get("result.string").String(),
+			Hours:  entry.Get("power_on_time.hours").Float(),
+			Failed: result >= 3 && result <= 7,
+		})
+	}
+	return results
+}
+
+// selfTestStatusLabel turns a self-test status like "Completed without
+// error" into "completed_without_error".
+func selfTestStatusLabel(status string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(status), func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	}), "_")
+}
+
+func (smart *SMARTctl) mineSelfTestResults() {
+	results := selfTestResults(smart.json)
+	if len(results) == 0 {
+		return
+	}
+	last := results[0]
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceSelfTestLastStatus,
+		prometheus.GaugeValue,
+		1,
+		smart.device.device,
+		selfTestStatusLabel(last.Type),
+		selfTestStatusLabel(last.Status),
+	)
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceSelfTestLastHours,
+		prometheus.GaugeValue,
+		last.Hours,
+		smart.device.device,
+	)
+	errors := 0
+	for _, result := range results {
+		if result.Failed {
+			errors++
+		}
+	}
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceSelfTestErrors,
+		prometheus.GaugeValue,
+		float64(errors),
+		smart.device.device,
+	)
+}
+
+// selfTestProgress returns whether a self-test is running and the percentage
+// remaining. ok is false if the device does not report self-test status.
+func selfTestProgress(json gjson.Result) (inProgress bool, remaining float64, ok bool) {
+	if status := json.Get("ata_smart_data.self_test.status"); status.Exists() {
+		// The upper nibble of the self-test execution status is 15 while a
+		// self-test is in progress.
+		return status.Get("value").Int()>>4 == 15, status.Get("remaining_percent").Float(), true
+	}
+	if selfTestLog := json.Get("nvme_self_test_log"); selfTestLog.Exists() {
+		return selfTestLog.Get("current_self_test_operation.value").Int() != 0,
+			100 - selfTestLog.Get("current_self_test_completion_percent").Float(), true
+	}
+	return false, 0, false
+}
+
+func (smart *SMARTctl) mineSelfTestProgress() {
+	inProgress, remaining, ok := selfTestProgress(smart.json)
+	if !ok {
+		return
+	}
+
+	value := 0.0
+	if inProgress {
+		value = 1
+	}
+	smart.ch <- prometheus.MustNewConstMetric(
+		metricDeviceSelfTestInProgress,
+		prometheus.GaugeValue,
+		value,
+		smart.device.device,
+	)
+	if inProgress {
+		smart.ch <- prometheus.MustNewConstMetric(
+			metricDeviceSelfTestRemainingPercent,
+			prometheus.GaugeValue,
+			remaining,
+			smart.device.device,
+		)
+	}
+}
+
 func (smart *SMARTctl) mineDeviceERC() {
 	for ercType, status := range smart.json.Get("ata_sct_erc").Map() {
 		smart.ch <- prometheus.MustNewConstMetric(
@@ -677,6 +1545,76 @@ func (smart *SMARTctl) mineSCSIErrorCounterLog() {
 			SCSIHealth.Get("write.total_uncorrected_errors").Float(),
 			smart.device.device,
 		)
-		// TODO: Should we also export the verify category?
+	}
+	// Not all drives report the verify counters.
+	if verify := SCSIHealth.Get("verify"); verify.Exists() {
+		for metric, field := range map[*prometheus.Desc]string{
+			metricVerifyErrorsCorrectedByRereadsRewrites: "errors_corrected_by_rereads_rewrites",
+			metricVerifyErrorsCorrectedByEccFast:         "errors_corrected_by_eccfast",
+			metricVerifyErrorsCorrectedByEccDelayed:      "errors_corrected_by_eccdelayed",
+			metricVerifyTotalUncorrectedErrors:           "total_uncorrected_errors",
+		} {
+			smart.ch <- prometheus.MustNewConstMetric(
+				metric,
+				prometheus.GaugeValue,
+				verify.Get(field).Float(),
+				smart.device.device,
+			)
+		}
+	}
+	smart.mineSCSIErrorCounterTotals(SCSIHealth)
+}
+
+// mineSCSIErrorCounterTotals exports the error counter log totals that have
+// no per-operation metric, labeled by operation. The corrected and
+// uncorrected error counts are exported above.
+func (smart *SMARTctl) mineSCSIErrorCounterTotals(SCSIHealth gjson.Result) {
+	for _, operation := range []string{"read", "write", "verify"} {
+		counters := SCSIHealth.Get(operation)
+		if !counters.Exists() {
+			continue
+		}
+		for metric, field := range map[*prometheus.Desc]string{
+			metricSCSIErrorsCorrectedTotal:           "total_errors_corrected",
+			metricSCSICorrectionAlgorithmInvocations: "correction_algorithm_invocations",
+		} {
+			if value := counters.Get(field); value.Exists() {
+				smart.ch <- prometheus.MustNewConstMetric(
+					metric,
+					prometheus.CounterValue,
+					value.Float(),
+					smart.device.device,
+					operation,
+				)
+			}
+		}
+	}
+}
+
+// mineSCSICycleWear exports the mechanical wear of SCSI drives from their
+// cycle counters. smartctl does not report the rated annualized workload, so
+// the cycle ratings are the only lifetime ratings available.
+func (smart *SMARTctl) mineSCSICycleWear() {
+	counter := smart.json.Get("scsi_start_stop_cycle_counter")
+	if !counter.Exists() {
+		return
+	}
+	for cycleType, paths := range map[string][2]string{
+		"start_stop":  {"accumulated_start_stop_cycles", "specified_cycle_count_over_device_lifetime"},
+		"load_unload": {"accumulated_load_unload_cycles", "specified_load_unload_count_over_device_lifetime"},
+	} {
+		accumulated := counter.Get(paths[0])
+		specified := counter.Get(paths[1])
+		// Drives that do not report a rating return 0 or omit the field.
+		if !accumulated.Exists() || specified.Float() <= 0 {
+			continue
+		}
+		smart.ch <- prometheus.MustNewConstMetric(
+			metricDeviceCycleWearRatio,
+			prometheus.GaugeValue,
+			accumulated.Float()/specified.Float(),
+			smart.device.device,
+			cycleType,
+		)
 	}
 }
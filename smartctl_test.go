@@ -0,0 +1,805 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// collectedValues returns the value of every metric collected from the
+// smartctl output, by descriptor.
+func collectedValues(t *testing.T, json string) map[*prometheus.Desc]float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		smart := NewSMARTctl(log.NewNopLogger(), parseJSON(json), ch)
+		smart.Collect()
+		close(ch)
+	}()
+	values := map[*prometheus.Desc]float64{}
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		values[metric.Desc()] = m.GetCounter().GetValue() + m.GetGauge().GetValue()
+	}
+	return values
+}
+
+// smartctlCollector collects the metrics of a smartctl output.
+type smartctlCollector string
+
+func (c smartctlCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c smartctlCollector) Collect(ch chan<- prometheus.Metric) {
+	smart := NewSMARTctl(log.NewNopLogger(), parseJSON(string(c)), ch)
+	smart.Collect()
+}
+
+// collectedSeries returns the value of every series collected from the
+// smartctl output, keyed by the metric name followed by the values of the
+// labels besides device, e.g. smartctl_device_cycle_wear_ratio{start_stop}.
+func collectedSeries(t *testing.T, json string) map[string]float64 {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(smartctlCollector(json))
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			values := []string{}
+			for _, label := range m.Label {
+				if label.GetName() != "device" {
+					values = append(values, label.GetValue())
+				}
+			}
+			key := family.GetName()
+			if len(values) > 0 {
+				key += "{" + strings.Join(values, ",") + "}"
+			}
+			series[key] = m.GetCounter().GetValue() + m.GetGauge().GetValue()
+		}
+	}
+	return series
+}
+
+func TestATABytes(t *testing.T) {
+	tests := []struct {
+		name          string
+		json          string
+		read, written float64
+	}{
+		{
+			"statistics page before attributes",
+			`{"device":{"protocol":"ATA"},"logical_block_size":4096,
+			"ata_device_statistics":{"pages":[{"number":1,"table":[{"name":"Logical Sectors Written","value":10},{"name":"Logical Sectors Read","value":20}]}]},
+			"ata_smart_attributes":{"table":[{"id":241,"name":"Total_LBAs_Written","raw":{"value":99}},{"id":242,"name":"Total_LBAs_Read","raw":{"value":99}}]}}`,
+			20 * 4096, 10 * 4096,
+		},
+		{
+			"statistics page written only",
+			`{"device":{"protocol":"ATA"},"ata_device_statistics":{"pages":[{"number":1,"table":[{"name":"Logical Sectors Written","value":10}]}]},
+			"ata_smart_attributes":{"table":[{"id":242,"name":"Total_LBAs_Read","raw":{"value":30}}]}}`,
+			30 * 512, 10 * 512,
+		},
+		{
+			"vendor units",
+			`{"device":{"protocol":"ATA"},"ata_smart_attributes":{"table":[{"id":241,"name":"Lifetime_Writes_GiB","raw":{"value":3}},{"id":242,"name":"Host_Reads_MiB","raw":{"value":5}}]}}`,
+			5 << 20, 3 << 30,
+		},
+		{
+			"Intel 32MiB mirror",
+			`{"device":{"protocol":"ATA"},"ata_smart_attributes":{"table":[{"id":225,"name":"Host_Writes_32MiB","raw":{"value":7}},{"id":241,"name":"Total_LBAs_Written","raw":{"value":7}},{"id":242,"name":"Total_LBAs_Read","raw":{"value":9}}]}}`,
+			9 << 25, 7 << 25,
+		},
+		{
+			"zero counters are not a mirror",
+			`{"device":{"protocol":"ATA"},"ata_smart_attributes":{"table":[{"id":225,"name":"Host_Writes_32MiB","raw":{"value":0}},{"id":241,"name":"Total_LBAs_Written","raw":{"value":0}},{"id":242,"name":"Total_LBAs_Read","raw":{"value":9}}]}}`,
+			9 * 512, 0,
+		},
+		{
+			"no Total_LBAs_Written is not a mirror",
+			`{"device":{"protocol":"ATA"},"ata_smart_attributes":{"table":[{"id":225,"name":"Host_Writes_32MiB","raw":{"value":0}},{"id":242,"name":"Total_LBAs_Read","raw":{"value":9}}]}}`,
+			9 * 512, 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := collectedValues(t, tt.json)
+			if got := values[metricDeviceBytesRead]; got != tt.read {
+				t.Errorf("bytes read = %v, want %v", got, tt.read)
+			}
+			if got := values[metricDeviceBytesWritten]; got != tt.written {
+				t.Errorf("bytes written = %v, want %v", got, tt.written)
+			}
+		})
+	}
+}
+
+// attributesJSON is the output of an ATA device with three SMART attributes.
+const attributesJSON = `{"device":{"protocol":"ATA"},"ata_smart_attributes":{"table":[
+	{"id":5,"name":"Reallocated_Sector_Ct","value":100,"worst":100,"thresh":10,"flags":{"value":51,"string":"PO--CK ","prefailure":true,"updated_online":true,"performance":false,"error_rate":false,"event_count":true,"auto_keep":true},"raw":{"value":12,"string":"12"}},
+	{"id":9,"name":"Power_On_Hours","value":90,"worst":90,"thresh":0,"flags":{"value":50,"string":"-O--CK ","prefailure":false,"updated_online":true,"performance":false,"error_rate":false,"event_count":true,"auto_keep":true},"raw":{"value":9000,"string":"9000"}},
+	{"id":241,"name":"Total_LBAs_Written","value":100,"worst":100,"thresh":0,"flags":{"value":50,"string":"-O--CK ","prefailure":false,"updated_online":true,"performance":false,"error_rate":false,"event_count":true,"auto_keep":true},"raw":{"value":3500000000,"string":"3500000000"}}]}}`
+
+// attributeSeries returns the exported attribute ids of the series.
+func attributeSeries(series map[string]float64) map[string]bool {
+	ids := map[string]bool{}
+	for key := range series {
+		if strings.HasPrefix(key, "smartctl_device_attribute{") {
+			// The long flags contain commas, the id is third from the end.
+			values := strings.Split(key, ",")
+			ids[values[len(values)-3]] = true
+		}
+	}
+	return ids
+}
+
+func TestAttributeLimit(t *testing.T) {
+	saved := *smartctlAttributeLimit
+	defer func() { *smartctlAttributeLimit = saved }()
+	for limit, want := range map[int]map[string]bool{
+		0: {"5": true, "9": true, "241": true},
+		2: {"5": true, "9": true},
+	} {
+		*smartctlAttributeLimit = limit
+		series := collectedSeries(t, attributesJSON)
+		if got := series["smartctl_device_attribute_count"]; got != 3 {
+			t.Errorf("limit %d: attribute count %v, want 3", limit, got)
+		}
+		if got := attributeSeries(series); !reflect.DeepEqual(got, want) {
+			t.Errorf("limit %d: exported attributes %v, want %v", limit, got, want)
+		}
+	}
+}
+
+func TestWear(t *testing.T) {
+	tests := []struct {
+		name        string
+		json        string
+		used, spare float64
+		ok          bool
+	}{
+		{
+			"NVMe health log",
+			`{"device":{"protocol":"NVMe"},"nvme_smart_health_information_log":{"percentage_used":120,"available_spare":90}}`,
+			120, 0, true,
+		},
+		{
+			"SCSI endurance indicator",
+			`{"device":{"protocol":"SCSI"},"scsi_percentage_used_endurance_indicator":3}`,
+			3, 0, true,
+		},
+		{
+			"ATA device statistics before attributes",
+			`{"device":{"protocol":"ATA"},
+			"ata_device_statistics":{"pages":[{"number":7,"table":[{"name":"Percentage Used Endurance Indicator","value":6}]}]},
+			"ata_smart_attributes":{"table":[{"id":233,"name":"Media_Wearout_Indicator","value":97},{"id":232,"name":"Available_Reservd_Space","value":95}]}}`,
+			6, 95, true,
+		},
+		{
+			"ATA wear attribute",
+			`{"device":{"protocol":"ATA"},"ata_smart_attributes":{"table":[{"id":233,"name":"Media_Wearout_Indicator","value":97}]}}`,
+			3, 0, true,
+		},
+		{
+			"ATA wear attribute above 100",
+			`{"device":{"protocol":"ATA"},"ata_smart_attributes":{"table":[{"id":177,"name":"Wear_Leveling_Count","value":114}]}}`,
+			0, 0, true,
+		},
+		{
+			"ATA HDD attribute 202",
+			`{"device":{"protocol":"ATA"},"ata_smart_attributes":{"table":[{"id":202,"name":"Data_Address_Mark_Errs","value":100}]}}`,
+			0, 0, false,
+		},
+		{
+			"ATA attribute on NVMe",
+			`{"device":{"protocol":"NVMe"},"ata_smart_attributes":{"table":[{"id":233,"name":"Media_Wearout_Indicator","value":97}]}}`,
+			0, 0, false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := collectedValues(t, tt.json)
+			used, ok := values[metricDevicePercentageUsed]
+			if ok != tt.ok || used != tt.used {
+				t.Errorf("percentage used = %v (%t), want %v (%t)", used, ok, tt.used, tt.ok)
+			}
+			if got := values[metricDeviceAvailableSparePercent]; got != tt.spare {
+				t.Errorf("available spare = %v, want %v", got, tt.spare)
+			}
+		})
+	}
+}
+
+func TestTemperatureFahrenheit(t *testing.T) {
+	saved := *smartctlTemperatureUnit
+	defer func() { *smartctlTemperatureUnit = saved }()
+	json := `{"temperature":{"current":30,"lifetime_max":50},"nvme_smart_health_information_log":{"temperature_sensors":[40]}}`
+	for _, unit := range []string{"celsius", "fahrenheit"} {
+		*smartctlTemperatureUnit = unit
+		ch := make(chan prometheus.Metric)
+		go func() {
+			smart := NewSMARTctl(log.NewNopLogger(), parseJSON(json), ch)
+			smart.mineTemperatures()
+			smart.mineNvmeTemperatureSensors()
+			close(ch)
+		}()
+		values := map[string]float64{}
+		for metric := range ch {
+			var m dto.Metric
+			if err := metric.Write(&m); err != nil {
+				t.Fatal(err)
+			}
+			key := metric.Desc().String()
+			for _, label := range m.Label {
+				if label.GetName() != "device" {
+					key = label.GetValue()
+				}
+			}
+			if metric.Desc() == metricDeviceTemperatureFahrenheit || metric.Desc() == metricDeviceTemperatureSensorFahrenheit {
+				key += " fahrenheit"
+			}
+			values[key] = m.GetGauge().GetValue()
+		}
+		want := map[string]float64{"current": 30, "lifetime_max": 50, "1": 40}
+		if unit == "fahrenheit" {
+			want["current fahrenheit"] = 86
+			want["lifetime_max fahrenheit"] = 122
+			want["1 fahrenheit"] = 104
+		}
+		if !reflect.DeepEqual(values, want) {
+			t.Errorf("%s: temperatures = %v, want %v", unit, values, want)
+		}
+	}
+}
+
+func TestHealthScoreWear(t *testing.T) {
+	for protocol, json := range map[string]string{
+		"NVMe": `{"device":{"protocol":"NVMe"},"nvme_smart_health_information_log":{"percentage_used":50}}`,
+		"SCSI": `{"device":{"protocol":"SCSI"},"scsi_percentage_used_endurance_indicator":50}`,
+		"ATA":  `{"device":{"protocol":"ATA"},"ata_smart_attributes":{"table":[{"id":233,"name":"Media_Wearout_Indicator","value":50}]}}`,
+	} {
+		if got := healthScorePenalties(parseJSON(json))["wear"]; got != 0.5 {
+			t.Errorf("%s: wear penalty %v, want 0.5", protocol, got)
+		}
+	}
+}
+
+func TestHealthScoreSectors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want map[string]float64
+	}{
+		{
+			"ATA",
+			`{"ata_smart_attributes":{"table":[{"id":5,"raw":{"value":50}},{"id":197,"raw":{"value":2}},{"id":198,"raw":{"value":3}}]},"temperature":{"current":60}}`,
+			map[string]float64{"reallocated": 0.5, "pending": 0.5, "temperature": 0.5},
+		},
+		{
+			"SCSI",
+			`{"scsi_grown_defect_list":20,"scsi_error_counter_log":{"read":{"total_uncorrected_errors":1},"write":{"total_uncorrected_errors":0},"verify":{"total_uncorrected_errors":1}}}`,
+			map[string]float64{"reallocated": 0.2, "pending": 0.2},
+		},
+		{
+			"NVMe",
+			`{"nvme_smart_health_information_log":{"media_errors":20,"temperature":80}}`,
+			map[string]float64{"pending": 1, "temperature": 1},
+		},
+	}
+	for _, tt := range tests {
+		if got := healthScorePenalties(parseJSON(tt.json)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: penalties %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSCSICycleWear(t *testing.T) {
+	data, err := os.ReadFile("testdata/HITACHI_H109060SESUN600G_10.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := collectedSeries(t, string(data))
+	for key, want := range map[string]float64{
+		"smartctl_device_cycle_wear_ratio{start_stop}":  70.0 / 50000,
+		"smartctl_device_cycle_wear_ratio{load_unload}": 3472.0 / 600000,
+	} {
+		if got, ok := series[key]; !ok || got != want {
+			t.Errorf("%s = %v (%t), want %v", key, got, ok, want)
+		}
+	}
+
+	series = collectedSeries(t, `{"device":{"protocol":"SCSI"},"scsi_start_stop_cycle_counter":{"accumulated_start_stop_cycles":70,"specified_cycle_count_over_device_lifetime":0}}`)
+	for key := range series {
+		if strings.HasPrefix(key, "smartctl_device_cycle_wear_ratio") {
+			t.Errorf("%s exported without a rating", key)
+		}
+	}
+}
+
+func TestSelfTestResults(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want map[string]float64
+	}{
+		{
+			"ATA",
+			`{"device":{"protocol":"ATA"},"ata_smart_self_test_log":{"standard":{"revision":1,"table":[
+			{"type":{"value":1,"string":"Short offline"},"status":{"value":0,"string":"Completed without error","passed":true},"lifetime_hours":5020},
+			{"type":{"value":2,"string":"Extended offline"},"status":{"value":121,"string":"Completed: read failure","remaining_percent":90,"passed":false},"lifetime_hours":4900},
+			{"type":{"value":1,"string":"Short offline"},"status":{"value":33,"string":"Aborted by host"},"lifetime_hours":4800}],"count":3,"error_count_total":1,"error_count_outdated":0}}}`,
+			map[string]float64{
+				"smartctl_device_self_test_last_status{completed_without_error,short_offline}": 1,
+				"smartctl_device_self_test_last_hours":                                         5020,
+				"smartctl_device_self_test_errors":                                             1,
+			},
+		},
+		{
+			"NVMe",
+			`{"device":{"protocol":"NVMe"},"nvme_self_test_log":{"current_self_test_operation":{"value":0,"string":"No self-test in progress"},"table":[
+			{"self_test_code":{"value":2,"string":"Extended self-test"},"self_test_result":{"value":7,"string":"Completed: failed segments"},"power_on_hours":812},
+			{"self_test_code":{"value":1,"string":"Short self-test"},"self_test_result":{"value":0,"string":"Completed without error"},"power_on_hours":700},
+			{"self_test_code":{"value":1,"string":"Short self-test"},"self_test_result":{"value":5,"string":"Completed: failed segments"},"power_on_hours":600}]}}`,
+			map[string]float64{
+				"smartctl_device_self_test_last_status{completed_failed_segments,extended_self_test}": 1,
+				"smartctl_device_self_test_last_hours":                                                812,
+				"smartctl_device_self_test_errors":                                                    2,
+			},
+		},
+		{
+			"SCSI",
+			`{"device":{"protocol":"SCSI"},
+			"scsi_self_test_0":{"code":{"value":1,"string":"Background short"},"result":{"value":0,"string":"Completed"},"power_on_time":{"hours":10020}},
+			"scsi_self_test_1":{"code":{"value":2,"string":"Background long"},"result":{"value":7,"string":"Failed in read element"},"power_on_time":{"hours":9000}},
+			"scsi_self_test_3":{"code":{"value":2,"string":"Background long"},"result":{"value":7,"string":"Failed in read element"},"power_on_time":{"hours":8000}}}`,
+			map[string]float64{
+				"smartctl_device_self_test_last_status{completed,background_short}": 1,
+				"smartctl_device_self_test_last_hours":                              10020,
+				"smartctl_device_self_test_errors":                                  1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := collectedSeries(t, tt.json)
+			for key, want := range tt.want {
+				if got, ok := series[key]; !ok || got != want {
+					t.Errorf("%s = %v (%t), want %v", key, got, ok, want)
+				}
+			}
+		})
+	}
+
+	series := collectedSeries(t, `{"device":{"protocol":"ATA"},"ata_smart_self_test_log":{"standard":{"revision":1,"count":0}}}`)
+	for key := range series {
+		if strings.HasPrefix(key, "smartctl_device_self_test_last") || key == "smartctl_device_self_test_errors" {
+			t.Errorf("%s exported without self-test log entries", key)
+		}
+	}
+}
+
+func TestTemperatureDelta(t *testing.T) {
+	saved := *smartctlAmbientTemperatureFile
+	defer func() { *smartctlAmbientTemperatureFile = saved }()
+	dir := t.TempDir()
+	ambientFile := filepath.Join(dir, "ambient")
+	*smartctlAmbientTemperatureFile = ambientFile
+
+	if _, ok := readAmbientTemperature(log.NewNopLogger()); ok {
+		t.Error("ambient temperature read from a missing file")
+	}
+	if err := os.WriteFile(ambientFile, []byte("warm\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := readAmbientTemperature(log.NewNopLogger()); ok {
+		t.Error("ambient temperature parsed from an invalid file")
+	}
+	if err := os.WriteFile(ambientFile, []byte("22.5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ambient, ok := readAmbientTemperature(log.NewNopLogger())
+	if !ok || ambient != 22.5 {
+		t.Fatalf("ambient temperature = %v (%t), want 22.5", ambient, ok)
+	}
+
+	// The NVMe output of older smartctl versions has the temperature in
+	// the health log only.
+	for json, want := range map[string]float64{
+		`{"temperature":{"current":40}}`:                           17.5,
+		`{"nvme_smart_health_information_log":{"temperature":30}}`: 7.5,
+	} {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			smart := NewSMARTctl(log.NewNopLogger(), parseJSON(json), ch)
+			smart.ambient, smart.hasAmbient = ambient, ok
+			smart.mineTemperatureDelta()
+			close(ch)
+		}()
+		var got []float64
+		for metric := range ch {
+			var m dto.Metric
+			if err := metric.Write(&m); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, m.GetGauge().GetValue())
+		}
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("%s: delta = %v, want %v", json, got, want)
+		}
+	}
+}
+
+func TestSATAPhyEvents(t *testing.T) {
+	series := collectedSeries(t, `{"device":{"protocol":"ATA"},"sata_phy_event_counters":{"table":[
+		{"id":1,"name":"Command failed due to ICRC error","size":16,"value":3,"overflow":false},
+		{"id":10,"name":"Device-to-host register FISes sent due to a COMRESET","size":16,"value":2,"overflow":false}],"reset":false}}`)
+	for key, want := range map[string]float64{
+		"smartctl_device_sata_phy_event{1,Command failed due to ICRC error}":                      3,
+		"smartctl_device_sata_phy_event{10,Device-to-host register FISes sent due to a COMRESET}": 2,
+	} {
+		if got, ok := series[key]; !ok || got != want {
+			t.Errorf("%s = %v (%t), want %v", key, got, ok, want)
+		}
+	}
+	for key := range series {
+		if strings.HasPrefix(key, "smartctl_device_statistics") {
+			t.Errorf("%s duplicates a SATA PHY event counter", key)
+		}
+	}
+}
+
+func TestParserFields(t *testing.T) {
+	for protocol := range parserFields {
+		seen := map[string]bool{}
+		for _, path := range protocolFields(protocol, false) {
+			if seen[path] {
+				t.Errorf("%s: field %s listed twice", protocol, path)
+			}
+			seen[path] = true
+		}
+	}
+
+	validation, presence := *smartctlSchemaValidation, *smartctlDebugFieldPresence
+	defer func() { *smartctlSchemaValidation, *smartctlDebugFieldPresence = validation, presence }()
+	*smartctlSchemaValidation, *smartctlDebugFieldPresence = true, true
+	data, err := os.ReadFile("testdata/nvme-null-INTEL_SSDPE2KX020T8-nvme2.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json := parseJSON(string(data))
+	series := collectedSeries(t, strings.Replace(string(data), `"media_errors"`, `"renamed_media_errors"`, 1))
+	for _, path := range protocolFields("NVMe", false) {
+		want := 0.0
+		if json.Get(path).Exists() && path != "nvme_smart_health_information_log.media_errors" {
+			want = 1
+		}
+		if got, ok := series["smartctl_parser_field_present{"+path+"}"]; !ok || got != want {
+			t.Errorf("%s present = %v (%t), want %v", path, got, ok, want)
+		}
+	}
+	for key := range series {
+		if strings.HasPrefix(key, "smartctl_device_schema_fields_missing") && key != "smartctl_device_schema_fields_missing{nvme_smart_health_information_log.media_errors}" {
+			t.Errorf("%s reported missing", key)
+		}
+	}
+	if _, ok := series["smartctl_device_schema_fields_missing{nvme_smart_health_information_log.media_errors}"]; !ok {
+		t.Error("renamed media_errors not reported missing")
+	}
+}
+
+func TestIsVirtual(t *testing.T) {
+	for json, want := range map[string]bool{
+		`{"device":{"name":"/dev/nonexistent"},"model_name":"QEMU HARDDISK"}`:                            true,
+		`{"device":{"name":"/dev/nonexistent"},"model_name":"VBOX HARDDISK"}`:                            true,
+		`{"device":{"name":"/dev/nonexistent"},"scsi_vendor":"VMware","scsi_model_name":"Virtual disk"}`: true,
+		`{"device":{"name":"/dev/nonexistent"},"scsi_vendor":"Msft","scsi_model_name":"Virtual Disk"}`:   true,
+		`{"device":{"name":"/dev/nonexistent"},"model_name":"ST4000NM0245-1Z2107"}`:                      false,
+		`{"device":{"name":"/dev/nonexistent"},"model_name":"Samsung SSD 860 EVO (Virtualized)"}`:        false,
+	} {
+		smart := NewSMARTctl(log.NewNopLogger(), parseJSON(json), nil)
+		if got := smart.isVirtual(); got != want {
+			t.Errorf("%s: virtual %t, want %t", json, got, want)
+		}
+	}
+}
+
+func TestCapacityInfo(t *testing.T) {
+	for _, test := range []struct {
+		json            string
+		decimal, binary string
+	}{
+		{`{"user_capacity":{"bytes":1000204886016}}`, "1.00 TB", "932 GiB"},
+		{`{"user_capacity":{"bytes":240057409536}}`, "240 GB", "224 GiB"},
+		{`{"user_capacity":{"bytes":4000787030016}}`, "4.00 TB", "3.64 TiB"},
+		{`{"user_capacity":{"bytes":512}}`, "512 B", "512 B"},
+		// NVMe devices with multiple namespaces report the total only.
+		{`{"nvme_total_capacity":2000398934016}`, "2.00 TB", "1.82 TiB"},
+	} {
+		series := collectedSeries(t, test.json)
+		key := "smartctl_device_capacity_info{" + test.binary + "," + test.decimal + "}"
+		if _, ok := series[key]; !ok {
+			t.Errorf("%s: %s not exported", test.json, key)
+		}
+	}
+	for key := range collectedSeries(t, `{"device":{"protocol":"NVMe"}}`) {
+		if strings.HasPrefix(key, "smartctl_device_capacity_info") {
+			t.Errorf("%s exported without a capacity", key)
+		}
+	}
+}
+
+func TestNVMeHostCommands(t *testing.T) {
+	series := collectedSeries(t, `{"device":{"type":"nvme","protocol":"NVMe"},"nvme_smart_health_information_log":{"host_reads":10,"controller_busy_time":2}}`)
+	if got := series["smartctl_device_host_read_commands"]; got != 10 {
+		t.Errorf("host read commands = %v, want 10", got)
+	}
+	if got := series["smartctl_device_controller_busy_time_seconds"]; got != 120 {
+		t.Errorf("controller busy time = %v, want 120", got)
+	}
+	// Fields missing from the log are not exported as 0.
+	if _, ok := series["smartctl_device_host_write_commands"]; ok {
+		t.Error("host write commands exported without host_writes")
+	}
+}
+
+func TestNVMeCriticalWarningBits(t *testing.T) {
+	// Spare below threshold and read-only media.
+	series := collectedSeries(t, `{"device":{"type":"nvme","protocol":"NVMe"},"nvme_smart_health_information_log":{"critical_warning":9}}`)
+	if got := series["smartctl_device_critical_warning"]; got != 9 {
+		t.Errorf("critical warning = %v, want 9", got)
+	}
+	for bit, want := range map[string]float64{
+		"available_spare": 1,
+		"temperature":     0,
+		"reliability":     0,
+		"read_only":       1,
+		"backup_failed":   0,
+	} {
+		key := "smartctl_device_critical_warning_bit{" + bit + "}"
+		if got, ok := series[key]; !ok || got != want {
+			t.Errorf("%s = %v (%t), want %v", key, got, ok, want)
+		}
+	}
+
+	series = collectedSeries(t, `{"device":{"type":"nvme","protocol":"NVMe"},"nvme_smart_health_information_log":{}}`)
+	for key := range series {
+		if strings.HasPrefix(key, "smartctl_device_critical_warning_bit") {
+			t.Errorf("%s exported without the critical warning", key)
+		}
+	}
+}
+
+func TestATAErrorLogCount(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want float64
+		ok   bool
+	}{
+		{"summary preferred", `{"ata_smart_error_log":{"extended":{"count":7},"summary":{"count":5}}}`, 5, true},
+		{"extended only", `{"ata_smart_error_log":{"extended":{"count":7}}}`, 7, true},
+		{"no error log", `{}`, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := collectedSeries(t, tt.json)["smartctl_device_ata_error_log_count"]
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("error log count = %v (%t), want %v (%t)", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDeviceInfo(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	series := collectedSeries(t, `{"device":{"type":"sat","protocol":"ATA"},"model_family":"Hitachi/HGST Ultrastar 7K4000 ","model_name":"HGST HUS724020ALE640","serial_number":"PN1234","firmware_version":"MJAOA5E0","wwn":{"naa":5,"oui":3274,"id":1234567890}}`)
+	// Labels by name: firmware_version, model_family, model_name,
+	// serial_number, type and wwn.
+	key := "smartctl_device_info{MJAOA5E0,Hitachi/HGST Ultrastar 7K4000,HGST HUS724020ALE640,PN1234,sat,0x5000cca0499602d2}"
+	if series[key] != 1 {
+		t.Errorf("%s missing", key)
+	}
+
+	// Fields the device does not report are empty.
+	series = collectedSeries(t, `{"device":{"type":"nvme","protocol":"NVMe"},"model_name":"KXG60ZNV512G","serial_number":"X1"}`)
+	key = "smartctl_device_info{,,KXG60ZNV512G,X1,nvme,}"
+	if series[key] != 1 {
+		t.Errorf("%s missing", key)
+	}
+}
+
+func TestSerialLabel(t *testing.T) {
+	defer kingpin.CommandLine.Parse(nil)
+	for _, tt := range []struct {
+		mode, serial, want string
+	}{
+		{"full", "PN1234", "PN1234"},
+		{"hashed", "PN1234", "1022dba1a1be6902"},
+		{"hashed", "", ""},
+		{"omit", "PN1234", ""},
+	} {
+		if _, err := kingpin.CommandLine.Parse([]string{"--smartctl.serial-mode=" + tt.mode}); err != nil {
+			t.Fatal(err)
+		}
+		if got := serialLabel(tt.serial); got != tt.want {
+			t.Errorf("%s: serialLabel(%q) = %q, want %q", tt.mode, tt.serial, got, tt.want)
+		}
+	}
+
+	// The device metrics carry the label of the mode.
+	series := collectedSeries(t, `{"device":{"type":"sat","protocol":"ATA"},"model_name":"M","serial_number":"PN1234"}`)
+	for key := range series {
+		if strings.Contains(key, "PN1234") {
+			t.Errorf("%s exports the serial number in omit mode", key)
+		}
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--smartctl.serial-mode=hidden"}); err == nil {
+		t.Error("unknown serial mode accepted")
+	}
+}
+
+func TestAttributeFlags(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	series := collectedSeries(t, attributesJSON)
+	// Labels by name: attribute_id, attribute_name, auto_keep, error_rate,
+	// event_count, performance, prefailure and updated_online.
+	for _, key := range []string{
+		"smartctl_device_attribute_flags{5,Reallocated_Sector_Ct,true,false,true,false,true,true}",
+		"smartctl_device_attribute_flags{9,Power_On_Hours,true,false,true,false,false,true}",
+	} {
+		if series[key] != 1 {
+			t.Errorf("%s missing", key)
+		}
+	}
+
+	// Flags missing from older smartctl output are false.
+	if got := strings.Join(attributeFlags(parseJSON(`{"value":3}`)), ","); got != "false,false,false,false,false,false" {
+		t.Errorf("flags without names = %s, want all false", got)
+	}
+}
+
+func TestPowerOnAndCycleFallbacks(t *testing.T) {
+	tests := []struct {
+		name          string
+		json          string
+		seconds       float64
+		cycles        float64
+		hasPowerOn    bool
+		hasPowerCycle bool
+	}{
+		{
+			"top-level fields preferred",
+			`{"power_on_time":{"hours":10,"minutes":30},"power_cycle_count":7,
+			"ata_smart_attributes":{"table":[{"id":9,"name":"Power_On_Hours","raw":{"value":99}},{"id":12,"name":"Power_Cycle_Count","raw":{"value":99}}]}}`,
+			10*3600 + 30*60, 7, true, true,
+		},
+		{
+			"NVMe health log",
+			`{"nvme_smart_health_information_log":{"power_on_hours":20,"power_cycles":3}}`,
+			20 * 3600, 3, true, true,
+		},
+		{
+			"ATA attributes",
+			`{"ata_smart_attributes":{"table":[{"id":9,"name":"Power_On_Hours","raw":{"value":30}},{"id":12,"name":"Power_Cycle_Count","raw":{"value":4}}]}}`,
+			30 * 3600, 4, true, true,
+		},
+		{
+			"SCSI start-stop cycles",
+			`{"scsi_start_stop_cycle_counter":{"accumulated_start_stop_cycles":5}}`,
+			0, 5, false, true,
+		},
+		{"not reported", `{}`, 0, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := collectedSeries(t, tt.json)
+			if got, ok := series["smartctl_device_power_on_seconds"]; ok != tt.hasPowerOn || got != tt.seconds {
+				t.Errorf("power-on seconds = %v (%t), want %v (%t)", got, ok, tt.seconds, tt.hasPowerOn)
+			}
+			if got, ok := series["smartctl_device_power_cycle_count"]; ok != tt.hasPowerCycle || got != tt.cycles {
+				t.Errorf("power cycles = %v (%t), want %v (%t)", got, ok, tt.cycles, tt.hasPowerCycle)
+			}
+		})
+	}
+}
+
+func TestSectorHealth(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want map[string]float64
+	}{
+		{
+			"ATA by id, first of duplicates",
+			`{"ata_smart_attributes":{"table":[{"id":5,"name":"Retired_Block_Count","raw":{"value":4}},{"id":5,"raw":{"value":9}},{"id":197,"raw":{"value":2}}]}}`,
+			map[string]float64{"reallocated": 4, "pending": 2},
+		},
+		{
+			"SCSI",
+			`{"scsi_grown_defect_list":7,"scsi_error_counter_log":{"read":{"total_uncorrected_errors":1},"verify":{"total_uncorrected_errors":2}}}`,
+			map[string]float64{"reallocated": 7, "uncorrectable": 3},
+		},
+		{
+			"SCSI without error counters",
+			`{"scsi_grown_defect_list":0}`,
+			map[string]float64{"reallocated": 0},
+		},
+		{
+			"NVMe",
+			`{"nvme_smart_health_information_log":{"media_errors":5}}`,
+			map[string]float64{"uncorrectable": 5},
+		},
+		{"not reported", `{}`, map[string]float64{}},
+	}
+	for _, tt := range tests {
+		if got := sectorHealth(parseJSON(tt.json)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: sector health %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	series := collectedSeries(t, `{"device":{"type":"nvme","protocol":"NVMe"},"nvme_smart_health_information_log":{"media_errors":5}}`)
+	if got, ok := series["smartctl_device_uncorrectable_sectors"]; !ok || got != 5 {
+		t.Errorf("uncorrectable sectors = %v (%t), want 5", got, ok)
+	}
+	if _, ok := series["smartctl_device_pending_sectors"]; ok {
+		t.Error("pending sectors exported for NVMe")
+	}
+}
+
+func TestRotationRate(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want float64
+		ok   bool
+	}{
+		{"HDD", `{"rotation_rate":7200}`, 7200, true},
+		{"SSD", `{"rotation_rate":0}`, 0, true},
+		{"not reported", `{"device":{"type":"nvme","protocol":"NVMe"}}`, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := collectedSeries(t, tt.json)["smartctl_device_rotation_rate"]; ok != tt.ok || got != tt.want {
+			t.Errorf("%s: rotation rate %v (%t), want %v (%t)", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	series := collectedSeries(t, `{"logical_block_size":512,"physical_block_size":4096}`)
+	for key, want := range map[string]float64{
+		"smartctl_device_block_size{logical}":  512,
+		"smartctl_device_block_size{physical}": 4096,
+	} {
+		if got, ok := series[key]; !ok || got != want {
+			t.Errorf("%s = %v (%t), want %v", key, got, ok, want)
+		}
+	}
+}
@@ -15,7 +15,10 @@ package main
 
 import (
 	"fmt"
+	"sync"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tidwall/gjson"
 )
@@ -43,17 +46,24 @@ func (smart *SMARTctlInfo) SetJSON(json gjson.Result) {
 	}
 }
 
-// Collect metrics
+// Collect metrics. The version of the smartctl that printed the device output
+// is preferred, it differs from the local binary for remote targets. Without
+// any, e.g. before a device was read, the local binary is reported instead.
 func (smart *SMARTctlInfo) Collect() {
-	if smart.Ready {
-		smart.mineVersion()
+	if smart.Ready && smart.mineVersion() {
+		return
 	}
+	collectSMARTctlVersion(smart.ch)
 }
 
-func (smart *SMARTctlInfo) mineVersion() {
+// mineVersion sends the version of the device output, if it has one.
+func (smart *SMARTctlInfo) mineVersion() bool {
 	smartctlJSON := smart.json.Get("smartctl")
 	smartctlVersion := smartctlJSON.Get("version").Array()
 	jsonVersion := smart.json.Get("json_format_version").Array()
+	if len(jsonVersion) < 2 || len(smartctlVersion) < 2 {
+		return false
+	}
 	smart.ch <- prometheus.MustNewConstMetric(
 		metricSmartctlVersion,
 		prometheus.GaugeValue,
@@ -63,4 +73,74 @@ func (smart *SMARTctlInfo) mineVersion() {
 		smartctlJSON.Get("svn_revision").String(),
 		smartctlJSON.Get("build_info").String(),
 	)
+	return true
+}
+
+// SMARTctlVersion is the version of the smartctl binary, as reported by
+// smartctl --version.
+type SMARTctlVersion struct {
+	JSONFormatVersion string
+	Version           string
+	SVNRevision       string
+	BuildInfo         string
+}
+
+var (
+	smartctlBinaryVersion      *SMARTctlVersion
+	smartctlBinaryVersionMutex sync.Mutex
+)
+
+// refreshSMARTctlVersion runs smartctl --version, at startup and when the
+// configuration is reloaded.
+func refreshSMARTctlVersion(logger log.Logger) {
+	out, err := runSmartctl("--json", "--version")
+	if err != nil {
+		level.Warn(logger).Log("msg", "smartctl version reading", "err", err)
+	}
+	json := parseJSON(string(out))
+	var version *SMARTctlVersion
+	jsonUnsupported := false
+	if v := json.Get("smartctl.version").Array(); len(v) >= 2 {
+		version = &SMARTctlVersion{
+			Version:     fmt.Sprintf("%d.%d", v[0].Int(), v[1].Int()),
+			SVNRevision: json.Get("smartctl.svn_revision").String(),
+			BuildInfo:   json.Get("smartctl.build_info").String(),
+		}
+		if f := json.Get("json_format_version").Array(); len(f) >= 2 {
+			version.JSONFormatVersion = fmt.Sprintf("%d.%d", f[0].Int(), f[1].Int())
+		}
+	} else if match := textVersionRe.FindStringSubmatch(string(out)); match != nil {
+		// smartctl before 7.0 rejects --json, still printing its version.
+		version = &SMARTctlVersion{Version: match[1] + "." + match[2]}
+		jsonUnsupported = true
+		if *smartctlTextFallback {
+			level.Info(logger).Log("msg", "smartctl does not support --json, reading its text output", "version", version.Version)
+		} else {
+			level.Warn(logger).Log("msg", "smartctl does not support --json, see smartctl.text-fallback", "version", version.Version)
+		}
+	}
+	smartctlBinaryVersionMutex.Lock()
+	smartctlBinaryVersion = version
+	smartctlBinaryVersionMutex.Unlock()
+	smartctlJSONUnsupported.Store(jsonUnsupported)
+}
+
+// collectSMARTctlVersion sends the version of the smartctl binary, if known,
+// as smartctl_version. smartctl before 7.0 has no JSON format version.
+func collectSMARTctlVersion(ch chan<- prometheus.Metric) {
+	smartctlBinaryVersionMutex.Lock()
+	version := smartctlBinaryVersion
+	smartctlBinaryVersionMutex.Unlock()
+	if version == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricSmartctlVersion,
+		prometheus.GaugeValue,
+		1,
+		version.JSONFormatVersion,
+		version.Version,
+		version.SVNRevision,
+		version.BuildInfo,
+	)
 }
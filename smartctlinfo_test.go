@@ -0,0 +1,135 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSMARTctlVersion(t *testing.T) {
+	smartctlBinaryVersionMutex.Lock()
+	smartctlBinaryVersion = &SMARTctlVersion{Version: "6.2"}
+	smartctlBinaryVersionMutex.Unlock()
+	defer func() {
+		smartctlBinaryVersionMutex.Lock()
+		smartctlBinaryVersion = nil
+		smartctlBinaryVersionMutex.Unlock()
+	}()
+
+	versions := func(json string) []map[string]string {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			info := NewSMARTctlInfo(ch)
+			if json != "" {
+				info.SetJSON(parseJSON(json))
+			}
+			info.Collect()
+			close(ch)
+		}()
+		series := []map[string]string{}
+		for metric := range ch {
+			if metric.Desc() != metricSmartctlVersion {
+				t.Errorf("unexpected metric %s", metric.Desc())
+			}
+			var m dto.Metric
+			if err := metric.Write(&m); err != nil {
+				t.Fatal(err)
+			}
+			labels := map[string]string{}
+			for _, label := range m.Label {
+				labels[label.GetName()] = label.GetValue()
+			}
+			series = append(series, labels)
+		}
+		return series
+	}
+
+	tests := []struct {
+		name        string
+		json        string
+		version     string
+		jsonVersion string
+	}{
+		{"binary before a device was read", "", "6.2", ""},
+		{"device output", `{"json_format_version":[1,0],"smartctl":{"version":[7,3]}}`, "7.3", "1.0"},
+		{"text device output", `{"smartctl":{"version":[6,2]}}`, "6.2", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := versions(tt.json)
+			if len(series) != 1 {
+				t.Fatalf("%d series, want 1", len(series))
+			}
+			if series[0]["smartctl_version"] != tt.version || series[0]["json_format_version"] != tt.jsonVersion {
+				t.Errorf("labels = %v, want smartctl_version %q and json_format_version %q", series[0], tt.version, tt.jsonVersion)
+			}
+		})
+	}
+}
+
+func TestRefreshSMARTctlVersion(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	defer func() {
+		*smartctlPath = saved
+		smartctlBinaryVersionMutex.Lock()
+		smartctlBinaryVersion = nil
+		smartctlBinaryVersionMutex.Unlock()
+		smartctlJSONUnsupported.Store(false)
+	}()
+
+	tests := []struct {
+		name            string
+		script          string
+		want            *SMARTctlVersion
+		jsonUnsupported bool
+	}{
+		{
+			"json",
+			`echo '{"json_format_version":[1,0],"smartctl":{"version":[7,4],"svn_revision":"5530","build_info":"(local build)"}}'`,
+			&SMARTctlVersion{JSONFormatVersion: "1.0", Version: "7.4", SVNRevision: "5530", BuildInfo: "(local build)"},
+			false,
+		},
+		{
+			"before 7.0",
+			"echo 'smartctl 6.2 2013-07-26 r3841 [x86_64-linux-3.10.0] (local build)'\necho\necho '=======> UNRECOGNIZED OPTION: json'\nexit 1",
+			&SMARTctlVersion{Version: "6.2"},
+			true,
+		},
+		{"not runnable", "exit 127", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*smartctlPath = writeShim(t, t.TempDir(), "smartctl", tt.script)
+			refreshSMARTctlVersion(log.NewNopLogger())
+			smartctlBinaryVersionMutex.Lock()
+			version := smartctlBinaryVersion
+			smartctlBinaryVersionMutex.Unlock()
+			if !reflect.DeepEqual(version, tt.want) {
+				t.Errorf("version = %+v, want %+v", version, tt.want)
+			}
+			if got := smartctlJSONUnsupported.Load(); got != tt.jsonUnsupported {
+				t.Errorf("json unsupported = %t, want %t", got, tt.jsonUnsupported)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+)
+
+// successWindow is a ring buffer of the last collection results of a device.
+type successWindow struct {
+	results []bool
+	next    int
+}
+
+func (w *successWindow) add(success bool, size int) {
+	if size < 1 {
+		size = 1
+	}
+	if len(w.results) < size {
+		w.results = append(w.results, success)
+		return
+	}
+	w.results[w.next%len(w.results)] = success
+	w.next = (w.next + 1) % len(w.results)
+}
+
+func (w *successWindow) ratio() float64 {
+	if len(w.results) == 0 {
+		return 0
+	}
+	succeeded := 0
+	for _, success := range w.results {
+		if success {
+			succeeded++
+		}
+	}
+	return float64(succeeded) / float64(len(w.results))
+}
+
+// successRatios tracks collection success windows keyed by serial number, so
+// the history follows the drive when its device name changes. Failed
+// collections carry no serial and are attributed to the serial last seen
+// on the device name.
+type successRatios struct {
+	mutex   sync.Mutex
+	serials map[string]string
+	windows map[string]*successWindow
+}
+
+func newSuccessRatios() *successRatios {
+	return &successRatios{
+		serials: map[string]string{},
+		windows: map[string]*successWindow{},
+	}
+}
+
+// key returns the window key of the device, guarded by mutex.
+func (s *successRatios) key(device string) string {
+	if serial, ok := s.serials[device]; ok {
+		return serial
+	}
+	return device
+}
+
+// observe records a collection attempt of the device.
+func (s *successRatios) observe(device, serial string, success bool, size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if serial != "" {
+		s.serials[device] = serial
+	}
+	key := s.key(device)
+	window, ok := s.windows[key]
+	if !ok {
+		window = &successWindow{}
+		s.windows[key] = window
+	}
+	window.add(success, size)
+}
+
+// ratio returns the success ratio of the device, if any collection attempt
+// was recorded.
+func (s *successRatios) ratio(device string) (float64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	window, ok := s.windows[s.key(device)]
+	if !ok {
+		return 0, false
+	}
+	return window.ratio(), true
+}
+
+// forget drops the window of a device no longer collected. A window followed
+// by another device name, as the drive moved, is kept.
+func (s *successRatios) forget(device string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := s.key(device)
+	delete(s.serials, device)
+	for _, serial := range s.serials {
+		if serial == key {
+			return
+		}
+	}
+	delete(s.windows, key)
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+// writeShim writes an executable shell script to the directory.
+func writeShim(t *testing.T, dir, name, script string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSudo(t *testing.T) {
+	dir := t.TempDir()
+	smartctl := writeShim(t, dir, "smartctl", `echo '{"smartctl":{"exit_status":0},"json_format_version":[1,0],"device":{"name":"'"$1"'"}}'`+"\n")
+
+	sudo, sudoPath, path, helperPath := *smartctlSudo, *smartctlSudoPath, *smartctlPath, *smartctlHelperPath
+	defer func() {
+		*smartctlSudo, *smartctlSudoPath, *smartctlPath, *smartctlHelperPath = sudo, sudoPath, path, helperPath
+	}()
+	*smartctlSudo, *smartctlPath, *smartctlHelperPath = true, smartctl, ""
+
+	t.Run("allowed", func(t *testing.T) {
+		// Runs the command if called with -n, like sudo with a NOPASSWD entry.
+		*smartctlSudoPath = writeShim(t, dir, "sudo-allowed", `[ "$1" = -n ] || exit 1; shift; exec "$@"`+"\n")
+		out, err := runSmartctl("/dev/sda", "--json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := parseJSON(string(out)).Get("device.name").String(); got != "/dev/sda" {
+			t.Errorf("smartctl got device %q, want /dev/sda", got)
+		}
+	})
+
+	t.Run("password required", func(t *testing.T) {
+		*smartctlSudoPath = writeShim(t, dir, "sudo-password", "echo 'sudo: a password is required' >&2; exit 1\n")
+		_, err := readSMARTctl(log.NewNopLogger(), Device{Name: "/dev/sda", Info_Name: "sda"})
+		var collectErr *CollectError
+		if !errors.As(err, &collectErr) || collectErr.Reason != CollectReasonSudo {
+			t.Errorf("readSMARTctl() error = %v, want reason %q", err, CollectReasonSudo)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var nvmeControllerRe = regexp.MustCompile(`^/dev/nvme[0-9]+$`)
+
+// deviceNumber returns the kernel major and minor number of the block device.
+// Devices without a block device node of their own are reported as not found:
+// RAID controllers, disks behind them, whose name is the node of the
+// controller or of its logical drive, and devices of a remote target.
+func deviceNumber(device Device) (uint32, uint32, bool) {
+	if device.Target != "" || strings.Contains(device.Type, CcissType) || strings.Contains(device.Type, MegaraidType) {
+		return 0, 0, false
+	}
+	name := blockDeviceName(device.Name)
+	var stat unix.Stat_t
+	if err := unix.Stat(name, &stat); err != nil {
+		return 0, 0, false
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return 0, 0, false
+	}
+	return unix.Major(uint64(stat.Rdev)), unix.Minor(uint64(stat.Rdev)), true
+}
+
+// blockDeviceName returns the block device of the device. smartctl addresses
+// NVMe drives by the controller character device, the kernel keeps the block
+// device information for the first namespace.
+func blockDeviceName(name string) string {
+	if nvmeControllerRe.MatchString(name) {
+		return name + "n1"
+	}
+	return name
+}
+
+// isVirtualDevice returns whether sysfs places the block device below the
+// virtual devices, i.e. it is backed by a file, memory or device-mapper
+// rather than by hardware (loop, dm, md, zram, ...).
+func isVirtualDevice(name string) bool {
+	path, err := filepath.EvalSymlinks(filepath.Join("/sys/class/block", filepath.Base(name)))
+	if err != nil {
+		return false
+	}
+	return strings.Contains(path, "/devices/virtual/")
+}
+
+// lvmVolumes returns the LVM logical volumes using the device or one of its
+// partitions, as found in the slaves of the device-mapper block devices.
+func lvmVolumes(name string) []LVMVolume {
+	disk := filepath.Base(blockDeviceName(name))
+	mappers, _ := filepath.Glob("/sys/block/dm-*")
+	volumes := []LVMVolume{}
+	for _, mapper := range mappers {
+		uuid, err := os.ReadFile(filepath.Join(mapper, "dm", "uuid"))
+		if err != nil || !strings.HasPrefix(string(uuid), "LVM-") {
+			continue
+		}
+		slaves, _ := os.ReadDir(filepath.Join(mapper, "slaves"))
+		for _, slave := range slaves {
+			if parentDisk(slave.Name()) != disk {
+				continue
+			}
+			dmName, err := os.ReadFile(filepath.Join(mapper, "dm", "name"))
+			if err != nil {
+				break
+			}
+			vg, lv := splitDMName(strings.TrimSpace(string(dmName)))
+			volumes = append(volumes, LVMVolume{VG: vg, LV: lv})
+			break
+		}
+	}
+	return volumes
+}
+
+// parentDisk returns the disk of a partition, other block devices are
+// returned as is.
+func parentDisk(block string) string {
+	path, err := filepath.EvalSymlinks(filepath.Join("/sys/class/block", block))
+	if err != nil {
+		return block
+	}
+	if _, err := os.Stat(filepath.Join(path, "partition")); err != nil {
+		return block
+	}
+	return filepath.Base(filepath.Dir(path))
+}
+
+// splitDMName splits the device-mapper name of a logical volume into the
+// volume group and logical volume. The parts are joined by a single dash,
+// dashes within the names are doubled.
+func splitDMName(name string) (string, string) {
+	for i := 0; i < len(name); i++ {
+		if name[i] != '-' {
+			continue
+		}
+		if i+1 < len(name) && name[i+1] == '-' {
+			i++
+			continue
+		}
+		return strings.ReplaceAll(name[:i], "--", "-"), strings.ReplaceAll(name[i+1:], "--", "-")
+	}
+	return strings.ReplaceAll(name, "--", "-"), ""
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDeviceNumber(t *testing.T) {
+	blocks, _ := filepath.Glob("/sys/class/block/*")
+	name := ""
+	for _, block := range blocks {
+		if _, _, ok := deviceNumber(Device{Name: "/dev/" + filepath.Base(block)}); ok {
+			name = "/dev/" + filepath.Base(block)
+			break
+		}
+	}
+	if name == "" {
+		t.Skip("no block device node")
+	}
+	for _, device := range []Device{
+		{Name: name, Type: "megaraid,3"},
+		{Name: name, Type: "sat+megaraid,3"},
+		{Name: name, Type: "cciss,0"},
+		{Name: name, Target: "host1"},
+	} {
+		if major, minor, ok := deviceNumber(device); ok {
+			t.Errorf("%+v numbered %d:%d, want none", device, major, minor)
+		}
+	}
+}
+
+func TestIsVirtualDevice(t *testing.T) {
+	if isVirtualDevice("/dev/nonexistent") {
+		t.Error("nonexistent device virtual")
+	}
+	loops, _ := filepath.Glob("/sys/class/block/loop*")
+	if len(loops) == 0 {
+		t.Skip("no loop device")
+	}
+	if name := "/dev/" + filepath.Base(loops[0]); !isVirtualDevice(name) {
+		t.Errorf("%s not virtual", name)
+	}
+}
+
+func TestSplitDMName(t *testing.T) {
+	for name, want := range map[string][2]string{
+		"vg0-root":              {"vg0", "root"},
+		"data--vg-lv--home":     {"data-vg", "lv-home"},
+		"my--vg-my--long--lv":   {"my-vg", "my-long-lv"},
+		"ubuntu--vg-ubuntu--lv": {"ubuntu-vg", "ubuntu-lv"},
+		"vg--only":              {"vg-only", ""},
+	} {
+		if vg, lv := splitDMName(name); vg != want[0] || lv != want[1] {
+			t.Errorf("splitDMName(%q) = %q, %q, want %q, %q", name, vg, lv, want[0], want[1])
+		}
+	}
+}
+
+func TestParentDisk(t *testing.T) {
+	if got := parentDisk("nonexistent1"); got != "nonexistent1" {
+		t.Errorf("parent of a missing block device %q, want it unchanged", got)
+	}
+	partitions, _ := filepath.Glob("/sys/class/block/*/partition")
+	if len(partitions) == 0 {
+		t.Skip("no partition")
+	}
+	partition := filepath.Base(filepath.Dir(partitions[0]))
+	if got := parentDisk(partition); got == partition || got == "" {
+		t.Errorf("parent of partition %s = %q", partition, got)
+	}
+}
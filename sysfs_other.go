@@ -0,0 +1,41 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package main
+
+// deviceNumber is only implemented on Linux.
+func deviceNumber(device Device) (uint32, uint32, bool) {
+	return 0, 0, false
+}
+
+// isVirtualDevice is only implemented on Linux.
+func isVirtualDevice(name string) bool {
+	return false
+}
+
+// lvmVolumes is only implemented on Linux.
+func lvmVolumes(name string) []LVMVolume {
+	return nil
+}
+
+// blockDeviceName is only implemented on Linux.
+func blockDeviceName(name string) string {
+	return name
+}
+
+// parentDisk is only implemented on Linux.
+func parentDisk(block string) string {
+	return block
+}
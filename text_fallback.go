@@ -0,0 +1,252 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// The text fallback reads devices with smartctl versions lacking --json. The
+// text output of smartctl -a is converted into the JSON fields the metrics
+// are read from, only a reduced set: the device information, the health
+// status, temperature, power-on time, the ATA attributes, the SCSI grown
+// defect list and the NVMe health log.
+
+var (
+	textVersionRe      = regexp.MustCompile(`(?m)^smartctl (\d+)\.(\d+)`)
+	textFieldRe        = regexp.MustCompile(`(?m)^([A-Za-z][^:\n]*?):\s+(.*\S)\s*$`)
+	textAttributeRe    = regexp.MustCompile(`(?m)^\s*(\d+)\s+(\S+)\s+0x([0-9a-fA-F]+)\s+(\d+)\s+(\d+)\s+(\S+)\s+\S+\s+\S+\s+\S+\s+(.*\S)\s*$`)
+	textSCSIPowerOnRe  = regexp.MustCompile(`(?m)^\s*Accumulated power on time, hours:minutes (\d+):(\d+)`)
+	textNumberRe       = regexp.MustCompile(`^-?[\d,]+`)
+	textScanRe         = regexp.MustCompile(`(?m)^(\S+) -d (\S+) # (.+), (\S+) device`)
+	textMegaraidDiskRe = regexp.MustCompile(`megaraid,(\d+)`)
+)
+
+// textNVMeHealthFields maps the NVMe health log lines of the text output to
+// the nvme_smart_health_information_log fields.
+var textNVMeHealthFields = map[string]string{
+	"Critical Warning":                "critical_warning",
+	"Temperature":                     "temperature",
+	"Available Spare":                 "available_spare",
+	"Available Spare Threshold":       "available_spare_threshold",
+	"Percentage Used":                 "percentage_used",
+	"Data Units Read":                 "data_units_read",
+	"Data Units Written":              "data_units_written",
+	"Host Read Commands":              "host_reads",
+	"Host Write Commands":             "host_writes",
+	"Controller Busy Time":            "controller_busy_time",
+	"Power Cycles":                    "power_cycles",
+	"Power On Hours":                  "power_on_hours",
+	"Unsafe Shutdowns":                "unsafe_shutdowns",
+	"Media and Data Integrity Errors": "media_errors",
+	"Error Information Log Entries":   "num_err_log_entries",
+}
+
+// textNumber parses the leading number of the text, ignoring thousands
+// separators, e.g. 1,234 [632 GB] or 12345h+05m. Hexadecimal values like
+// 0x00 are supported as well.
+func textNumber(text string) (int64, bool) {
+	if hex, ok := strings.CutPrefix(text, "0x"); ok {
+		value, err := strconv.ParseInt(strings.TrimSpace(strings.SplitN(hex, " ", 2)[0]), 16, 64)
+		return value, err == nil
+	}
+	match := textNumberRe.FindString(text)
+	if match == "" {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(strings.ReplaceAll(match, ",", ""), 10, 64)
+	return value, err == nil
+}
+
+// textFlags returns the attribute flags of the FLAG column, in the JSON
+// format of smartctl --format=brief.
+func textFlags(value int64) map[string]any {
+	flags := map[string]any{"value": value}
+	short := []byte("POSRCK")
+	for i, name := range attributeFlagNames {
+		set := value&(1<<i) != 0
+		flags[name] = set
+		if !set {
+			short[i] = '-'
+		}
+	}
+	flags["string"] = string(short) + " "
+	return flags
+}
+
+// parseSMARTctlText converts the output of smartctl -a for the device into
+// the JSON smartctl --json would print, as far as the text has the fields.
+func parseSMARTctlText(device Device, text string, exitStatus int) gjson.Result {
+	fields := map[string]string{}
+	for _, match := range textFieldRe.FindAllStringSubmatch(text, -1) {
+		if _, ok := fields[match[1]]; !ok {
+			fields[match[1]] = match[2]
+		}
+	}
+	field := func(names ...string) (string, bool) {
+		for _, name := range names {
+			if value, ok := fields[name]; ok {
+				return value, true
+			}
+		}
+		return "", false
+	}
+
+	smartctl := map[string]any{"exit_status": exitStatus}
+	if match := textVersionRe.FindStringSubmatch(text); match != nil {
+		major, _ := strconv.Atoi(match[1])
+		minor, _ := strconv.Atoi(match[2])
+		smartctl["version"] = []int{major, minor}
+	}
+	infoName := device.Name
+	if match := textMegaraidDiskRe.FindStringSubmatch(device.Type); match != nil {
+		disk, _ := strconv.Atoi(match[1])
+		infoName = fmt.Sprintf("%s [megaraid_disk_%02d]", device.Name, disk)
+	}
+	result := map[string]any{
+		"smartctl": smartctl,
+		"device":   map[string]any{"name": device.Name, "info_name": infoName},
+	}
+
+	protocol, deviceType := "ATA", "sat"
+	switch {
+	case strings.Contains(text, "SMART/Health Information (NVMe Log"):
+		protocol, deviceType = "NVMe", "nvme"
+	case strings.Contains(text, "Transport protocol:") || strings.Contains(text, "SMART Health Status:"):
+		protocol, deviceType = "SCSI", "scsi"
+	}
+	if device.Type != "" && device.Type != "auto" {
+		deviceType = device.Type
+	}
+	result["device"].(map[string]any)["type"] = deviceType
+	result["device"].(map[string]any)["protocol"] = protocol
+
+	for key, names := range map[string][]string{
+		"model_family":     {"Model Family"},
+		"model_name":       {"Device Model", "Model Number", "Product"},
+		"serial_number":    {"Serial Number", "Serial number"},
+		"firmware_version": {"Firmware Version", "Revision"},
+	} {
+		if value, ok := field(names...); ok {
+			result[key] = value
+		}
+	}
+	if value, ok := field("User Capacity", "Total NVM Capacity"); ok {
+		if bytes, ok := textNumber(value); ok {
+			result["user_capacity"] = map[string]any{"bytes": bytes}
+		}
+	}
+	if value, ok := field("Rotation Rate"); ok {
+		rate, _ := textNumber(value)
+		result["rotation_rate"] = rate
+	}
+
+	if value, ok := field("SMART overall-health self-assessment test result"); ok {
+		result["smart_status"] = map[string]any{"passed": value == "PASSED"}
+	} else if value, ok := field("SMART Health Status"); ok {
+		result["smart_status"] = map[string]any{"passed": value == "OK"}
+	}
+
+	if value, ok := field("Current Drive Temperature"); ok {
+		if current, ok := textNumber(value); ok {
+			result["temperature"] = map[string]any{"current": current}
+		}
+	}
+	if match := textSCSIPowerOnRe.FindStringSubmatch(text); match != nil {
+		hours, _ := strconv.Atoi(match[1])
+		minutes, _ := strconv.Atoi(match[2])
+		result["power_on_time"] = map[string]any{"hours": hours, "minutes": minutes}
+	}
+	if value, ok := field("Elements in grown defect list"); ok {
+		if defects, ok := textNumber(value); ok {
+			result["scsi_grown_defect_list"] = defects
+		}
+	}
+
+	if protocol == "NVMe" {
+		health := map[string]any{}
+		for name, key := range textNVMeHealthFields {
+			if value, ok := fields[name]; ok {
+				if number, ok := textNumber(value); ok {
+					health[key] = number
+				}
+			}
+		}
+		result["nvme_smart_health_information_log"] = health
+		if temperature, ok := health["temperature"]; ok {
+			result["temperature"] = map[string]any{"current": temperature}
+		}
+		if hours, ok := health["power_on_hours"]; ok {
+			result["power_on_time"] = map[string]any{"hours": hours}
+		}
+	}
+
+	// The ATA attribute table, the power-on hours and power cycles are
+	// read from it like for old smartctl versions.
+	var table []map[string]any
+	for _, match := range textAttributeRe.FindAllStringSubmatch(text, -1) {
+		id, _ := strconv.Atoi(match[1])
+		flags, _ := strconv.ParseInt(match[3], 16, 64)
+		value, _ := strconv.Atoi(match[4])
+		worst, _ := strconv.Atoi(match[5])
+		thresh, _ := strconv.Atoi(match[6])
+		raw, _ := textNumber(match[7])
+		table = append(table, map[string]any{
+			"id":     id,
+			"name":   match[2],
+			"value":  value,
+			"worst":  worst,
+			"thresh": thresh,
+			"flags":  textFlags(flags),
+			"raw":    map[string]any{"value": raw, "string": match[7]},
+		})
+		if _, ok := result["temperature"]; !ok && (id == 194 || id == 190) {
+			result["temperature"] = map[string]any{"current": raw}
+		}
+	}
+	if table != nil {
+		result["ata_smart_attributes"] = map[string]any{"table": table}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return gjson.Result{}
+	}
+	return gjson.ParseBytes(data)
+}
+
+// parseSMARTctlScanText converts the output of smartctl --scan into the JSON
+// smartctl --json --scan would print.
+func parseSMARTctlScanText(text string) gjson.Result {
+	devices := []map[string]string{}
+	for _, match := range textScanRe.FindAllStringSubmatch(text, -1) {
+		devices = append(devices, map[string]string{
+			"name":      match[1],
+			"info_name": match[3],
+			"type":      match[2],
+			"protocol":  match[4],
+		})
+	}
+	data, err := json.Marshal(map[string]any{"devices": devices})
+	if err != nil {
+		return gjson.Result{}
+	}
+	return gjson.ParseBytes(data)
+}
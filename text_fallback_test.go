@@ -0,0 +1,261 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseSMARTctlText(t *testing.T) {
+	text, err := os.ReadFile("testdata/text/ata.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json := parseSMARTctlText(Device{Name: "/dev/sda", Info_Name: "sda"}, string(text), 0)
+
+	for path, want := range map[string]string{
+		"device.name":                               "/dev/sda",
+		"device.type":                               "sat",
+		"device.protocol":                           "ATA",
+		"smartctl.version":                          "[6,2]",
+		"model_family":                              "Seagate Constellation ES.3",
+		"model_name":                                "ST1000NM0033-9ZM173",
+		"serial_number":                             "Z1W1ABCD",
+		"user_capacity.bytes":                       "1000204886016",
+		"rotation_rate":                             "7200",
+		"smart_status.passed":                       "true",
+		"temperature.current":                       "34",
+		"ata_smart_attributes.table.#":              "6",
+		"ata_smart_attributes.table.1.name":         "Reallocated_Sector_Ct",
+		"ata_smart_attributes.table.1.thresh":       "10",
+		"ata_smart_attributes.table.1.raw.value":    "8",
+		"ata_smart_attributes.table.1.flags.string": "PO--CK ",
+	} {
+		if got := json.Get(path).String(); got != want {
+			t.Errorf("%s = %s, want %s", path, got, want)
+		}
+	}
+
+	smart := NewSMARTctl(log.NewNopLogger(), json, make(chan<- prometheus.Metric, 1))
+	if raw := smart.ataAttributeRaw(9, "Power_On_Hours").Int(); raw != 48523 {
+		t.Errorf("Power_On_Hours = %d, want 48523", raw)
+	}
+}
+
+func TestTextNumber(t *testing.T) {
+	for text, want := range map[string]int64{
+		"1,000,204,886,016 bytes [1.00 TB]": 1000204886016,
+		"12345h+05m+10.123s":                12345,
+		"0x04":                              4,
+		"0x0a (spare below threshold)":      10,
+		"-1":                                -1,
+		"36 Celsius":                        36,
+	} {
+		if got, ok := textNumber(text); !ok || got != want {
+			t.Errorf("textNumber(%q) = %d (%t), want %d", text, got, ok, want)
+		}
+	}
+	for _, text := range []string{"", "Solid State Device", "0xzz", "[No Information Found]"} {
+		if got, ok := textNumber(text); ok {
+			t.Errorf("textNumber(%q) = %d, want no number", text, got)
+		}
+	}
+}
+
+func TestParseSMARTctlTextEdgeCases(t *testing.T) {
+	tests := []struct {
+		name   string
+		device Device
+		text   string
+		want   map[string]string
+	}{
+		{
+			"NVMe health log",
+			Device{Name: "/dev/nvme0"},
+			`smartctl 6.6 2017-11-05 r4594 [x86_64-linux-4.15.0] (local build)
+Model Number:                       Samsung SSD 970 EVO 500GB
+Total NVM Capacity:                 500,107,862,016 [500 GB]
+
+SMART overall-health self-assessment test result: FAILED!
+
+SMART/Health Information (NVMe Log 0x02, NSID 0xffffffff)
+Critical Warning:                   0x04
+Temperature:                        41 Celsius
+Percentage Used:                    12%
+Data Units Read:                    1,234,567 [632 GB]
+Power On Hours:                     1,501
+Media and Data Integrity Errors:    0
+`,
+			map[string]string{
+				"device.type":         "nvme",
+				"device.protocol":     "NVMe",
+				"model_name":          "Samsung SSD 970 EVO 500GB",
+				"user_capacity.bytes": "500107862016",
+				"smart_status.passed": "false",
+				"temperature.current": "41",
+				"power_on_time.hours": "1501",
+				"nvme_smart_health_information_log.critical_warning": "4",
+				"nvme_smart_health_information_log.percentage_used":  "12",
+				"nvme_smart_health_information_log.data_units_read":  "1234567",
+				"nvme_smart_health_information_log.media_errors":     "0",
+				"ata_smart_attributes":                               "",
+			},
+		},
+		{
+			"SCSI behind megaraid",
+			Device{Name: "/dev/bus/0", Type: "megaraid,4"},
+			`smartctl 6.2 2013-07-26 r3841 [x86_64-linux-3.10.0] (local build)
+Vendor:               SEAGATE
+Product:              ST600MM0006
+Revision:             0003
+Transport protocol:   SAS (SPL-3)
+SMART Health Status: OK
+Current Drive Temperature:     30 C
+Elements in grown defect list: 3
+    Accumulated power on time, hours:minutes 25033:47
+`,
+			map[string]string{
+				"device.info_name":       "/dev/bus/0 [megaraid_disk_04]",
+				"device.type":            "megaraid,4",
+				"device.protocol":        "SCSI",
+				"model_name":             "ST600MM0006",
+				"firmware_version":       "0003",
+				"smart_status.passed":    "true",
+				"temperature.current":    "30",
+				"scsi_grown_defect_list": "3",
+				"power_on_time.hours":    "25033",
+				"power_on_time.minutes":  "47",
+			},
+		},
+		{
+			"ATA airflow temperature",
+			Device{Name: "/dev/sdb", Type: "auto"},
+			`ID# ATTRIBUTE_NAME          FLAG     VALUE WORST THRESH TYPE      UPDATED  WHEN_FAILED RAW_VALUE
+190 Airflow_Temperature_Cel 0x0022   063   045   045    Old_age   Always   In_the_past 37 (Min/Max 22/55)
+`,
+			map[string]string{
+				"device.type":         "sat",
+				"smart_status":        "",
+				"temperature.current": "37",
+				"ata_smart_attributes.table.0.flags.string": "-O---K ",
+				"ata_smart_attributes.table.0.raw.string":   "37 (Min/Max 22/55)",
+			},
+		},
+		{
+			"no output",
+			Device{Name: "/dev/sdc"},
+			"",
+			map[string]string{
+				"smartctl.exit_status": "2",
+				"smartctl.version":     "",
+				"device.protocol":      "ATA",
+				"model_name":           "",
+				"temperature":          "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json := parseSMARTctlText(tt.device, tt.text, 2)
+			for path, want := range tt.want {
+				if got := json.Get(path).String(); got != want {
+					t.Errorf("%s = %q, want %q", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSMARTctlScanText(t *testing.T) {
+	text, err := os.ReadFile("testdata/text/scan.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices, _ := parseScannedDevices(log.NewNopLogger(), parseSMARTctlScanText(string(text)))
+	want := []Device{
+		{Name: "/dev/sda", Info_Name: "sda", Type: "scsi", TypeSource: TypeSourceScan},
+		{Name: "/dev/bus/0", Info_Name: "bus_0_megaraid_disk_04", Type: "megaraid,4", TypeSource: TypeSourceScan},
+		{Name: "/dev/nvme0", Info_Name: "nvme0", Type: "nvme", TypeSource: TypeSourceScan},
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("devices = %+v, want %+v", devices, want)
+	}
+}
+
+// TestTextFallbackRuns checks that smartctl is run once per read when its
+// version is known to lack --json, and twice otherwise.
+func TestTextFallbackRuns(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	text, err := filepath.Abs("testdata/text/ata.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	smartctl := filepath.Join(dir, "smartctl")
+	script := "#!/bin/sh\necho \"$*\" >> " + runs + "\n" +
+		"if [ \"$1\" = --json ]; then echo 'smartctl 6.2 2017-02-27 r4394'; echo '=======> UNRECOGNIZED OPTION: json'; exit 1; fi\n" +
+		"cat " + text + "\n"
+	if err := os.WriteFile(smartctl, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := *smartctlPath
+	*smartctlPath, *smartctlTextFallback = smartctl, true
+	defer func() {
+		*smartctlPath, *smartctlTextFallback = saved, false
+		smartctlJSONUnsupported.Store(false)
+		smartctlBinaryVersionMutex.Lock()
+		smartctlBinaryVersion = nil
+		smartctlBinaryVersionMutex.Unlock()
+	}()
+	device := Device{Name: "/dev/sda", Info_Name: "sda", Type: "sat"}
+	defer forgetDevice(device)
+
+	read := func() (int, uint64) {
+		os.Remove(runs)
+		total := smartctlSubprocessTotal.Load()
+		json, err := readSMARTctl(log.NewNopLogger(), device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := json.Get("model_name").String(); got != "ST1000NM0033-9ZM173" {
+			t.Errorf("model_name = %q", got)
+		}
+		data, err := os.ReadFile(runs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(data), "\n"), smartctlSubprocessTotal.Load() - total
+	}
+	if runs, counted := read(); runs != 2 || counted != 2 {
+		t.Errorf("unknown version: %d runs, %d counted, want 2", runs, counted)
+	}
+	refreshSMARTctlVersion(log.NewNopLogger())
+	if !smartctlJSONUnsupported.Load() {
+		t.Fatal("smartctl 6.2 not known to lack --json")
+	}
+	if runs, counted := read(); runs != 1 || counted != 1 {
+		t.Errorf("known version: %d runs, %d counted, want 1", runs, counted)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-kit/log"
+)
+
+// verifyDevices collects every device once and writes a pass/fail report.
+// It returns the process exit code: 0 if at least minRatio of the devices
+// were read successfully, 1 otherwise.
+func verifyDevices(logger log.Logger, devices []Device, minRatio float64, w io.Writer) int {
+	passed := 0
+	for _, device := range devices {
+		result := "FAIL"
+		if readData(logger, device).Exists() {
+			result = "PASS"
+			passed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result, device.Info_Name, device.Name, device.Type)
+	}
+	fmt.Fprintf(w, "%d/%d devices passed\n", passed, len(devices))
+
+	if len(devices) == 0 || float64(passed)/float64(len(devices)) < minRatio {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+)
+
+func TestVerifyDevices(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	// Only /dev/sda can be read.
+	smartctl := writeShim(t, t.TempDir(), "smartctl", `case "$*" in
+*/dev/sda*) echo '{"smartctl":{"exit_status":0},"device":{"name":"/dev/sda","protocol":"ATA"}}' ;;
+*) echo '{"smartctl":{"exit_status":2,"messages":[{"string":"No such device","severity":"error"}]}}'; exit 2 ;;
+esac
+`)
+	saved := *smartctlPath
+	*smartctlPath = smartctl
+	defer func() { *smartctlPath = saved }()
+	devices := []Device{
+		{Name: "/dev/sda", Info_Name: "sda", Type: "sat"},
+		{Name: "/dev/sdb", Info_Name: "sdb", Type: "sat"},
+	}
+	for _, device := range devices {
+		defer forgetDevice(device)
+	}
+
+	tests := []struct {
+		devices  []Device
+		minRatio float64
+		code     int
+	}{
+		{devices, 1, 1},
+		{devices, 0.5, 0},
+		{devices[:1], 1, 0},
+		{nil, 0, 1},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		if code := verifyDevices(log.NewNopLogger(), test.devices, test.minRatio, &out); code != test.code {
+			t.Errorf("%d devices, min ratio %v: exit code %d, want %d\n%s", len(test.devices), test.minRatio, code, test.code, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	verifyDevices(log.NewNopLogger(), devices, 1, &out)
+	want := "PASS\tsda\t/dev/sda\tsat\nFAIL\tsdb\t/dev/sdb\tsat\n1/2 devices passed\n"
+	if out.String() != want {
+		t.Errorf("report %q, want %q", out.String(), want)
+	}
+}